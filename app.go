@@ -3,38 +3,78 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net"
+	"net/http"
 	"os"
+	"path/filepath"
+	"regexp"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/dreamsxin/go-netsniffer/capture"
+	"github.com/dreamsxin/go-netsniffer/cert"
 	"github.com/dreamsxin/go-netsniffer/events"
+	"github.com/dreamsxin/go-netsniffer/filter"
 	"github.com/dreamsxin/go-netsniffer/models"
+	"github.com/dreamsxin/go-netsniffer/pipeline"
 	"github.com/dreamsxin/go-netsniffer/proxy"
 	"github.com/google/gopacket"
-	"github.com/google/martian/v3"
 	"github.com/wailsapp/wails/v2/pkg/runtime"
 
 	//"net/http/cookiejar"
 
 	"github.com/dreamsxin/go-netsniffer/proxy/handler"
+	"github.com/dreamsxin/go-netsniffer/storage"
 	"github.com/google/gopacket/layers"
 	"github.com/google/gopacket/pcap"
 )
 
 const authorityName string = "GoNetSniffer Proxy Authority"
 
+// 解密 TLS 时抓取完整的数据包
+const maxSnaplen = 65535
+
+// 启动时新建的会话以此开头，没有数据时关闭后删除
+const autoSessionPrefix = "auto-"
+
+const (
+	pipelineSize = 4096
+	// 每次批量发送到界面的间隔和最多等待的数量，超出的只保存到会话中
+	emitInterval = 100 * time.Millisecond
+	maxBatch     = 2000
+	// 退出时等待网卡读取结束的时间
+	stopTimeout = 3 * time.Second
+)
+
 // App struct
 type App struct {
-	ctx       context.Context
-	config    models.Config
-	serve     *martian.Proxy
-	lock      sync.Mutex
-	dataChan  chan *models.Packet
-	tcphandle *pcap.Handle
+	ctx     context.Context
+	config  models.Config
+	serve   *proxy.Proxy
+	logger  *handler.RequestLogger // 代理停止后等待正在记录的内容
+	lock    sync.Mutex
+	pipe    *pipeline.Pipeline
+	bodies  *storage.BodyStore
+	session *storage.Session // 正在记录的会话，数据包由 writer 写入
+	writer  *storage.Writer
+	// 保护 session，切换会话时持有写锁，查询时持有读锁，RunLoop 和 writer 不使用
+	sessionLock sync.RWMutex
+	loopDone    chan struct{}
+	emitDone    chan struct{}
+	httpBatch   *pipeline.Batch[models.HTTPPacket] // 等待发送到界面的数据包
+	ipBatch     *pipeline.Batch[models.IPPacket]
+	filter      atomic.Pointer[filter.Filter] // HTTP.Filter 开启时按 HTTP.FilterQuery 过滤显示的数据包
+	passphrase  atomic.Pointer[string]        // 根证书私钥密码，为 nil 时从环境变量或保存的文件中读取
+	tcphandle   *pcap.Handle
+	ipDone      chan struct{} // 网卡读取结束时关闭，退出时等待后再关闭队列
+	watchOnce   sync.Once
+	// 上游客户端证书密码，按主机保存在内存中，没有时从环境变量或保存的文件中读取
+	upstreamPasswords sync.Map
 }
 
 // NewApp creates a new App application struct
@@ -53,15 +93,25 @@ func NewApp() *App {
 				Timeout: 1000,
 				Filter:  "tcp and port 80",
 			},
+			Cert: models.Cert{
+				LeafCache: true,
+			},
 		},
-		dataChan: make(chan *models.Packet, 1000),
+		pipe:      pipeline.New(pipelineSize),
+		loopDone:  make(chan struct{}),
+		emitDone:  make(chan struct{}),
+		httpBatch: pipeline.NewBatch[models.HTTPPacket](maxBatch),
+		ipBatch:   pipeline.NewBatch[models.IPPacket](maxBatch),
 	}
+	a.bodies = storage.NewBodyStore(a.config.Body)
+	a.writer = storage.NewWriter(a.bodies)
 
 	go a.RunLoop()
 	return a
 }
 
 func (a *App) RunLoop() {
+	defer close(a.loopDone)
 
 	file, err := os.OpenFile(fmt.Sprintf("log%s.txt", time.Now().Format(time.DateOnly)), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
@@ -69,17 +119,17 @@ func (a *App) RunLoop() {
 	}
 	defer file.Close()
 
-	// 循环读取 dataChan
-	for packet := range a.dataChan {
+	// 保存并筛选数据包，界面由 emitLoop 批量发送，关闭后读取完剩余的数据包结束
+	for packet := range a.pipe.Packets() {
 		if packet.PacketType == models.PacketType_HTTP {
+			// 会话中保存所有数据包，过滤条件只影响显示，修改后可以从会话中重新读取
+			a.writer.SaveHTTP(&packet.HTTP)
 			// 处理数据
-			if a.config.HTTP.FilterHost != "" {
-				if !strings.Contains(packet.HTTP.Host, a.config.HTTP.FilterHost) {
-					continue
-				}
+			if !a.filter.Load().Match(&packet.HTTP) {
+				continue
 			}
 
-			runtime.EventsEmit(a.ctx, "HTTPPacket", packet.HTTP)
+			a.httpBatch.Add(packet.HTTP)
 			if a.config.HTTP.SaveLogFile {
 				b, err := json.Marshal(packet.HTTP)
 				if err != nil {
@@ -91,7 +141,8 @@ func (a *App) RunLoop() {
 				file.WriteString("\n\n")
 			}
 		} else if packet.PacketType == models.PacketType_IP {
-			runtime.EventsEmit(a.ctx, "IPPacket", packet.IP)
+			a.writer.SaveIP(&packet.IP)
+			a.ipBatch.Add(packet.IP)
 		} else {
 			runtime.EventsEmit(a.ctx, "Packet", packet)
 
@@ -99,8 +150,76 @@ func (a *App) RunLoop() {
 	}
 }
 
+// 定时批量发送数据包，丢弃数量变化时发送统计，RunLoop 结束后发送剩余的数据包
+func (a *App) emitLoop() {
+	defer close(a.emitDone)
+	ticker := time.NewTicker(emitInterval)
+	defer ticker.Stop()
+	var dropped uint64
+	for {
+		select {
+		case <-ticker.C:
+		case <-a.loopDone:
+			a.emitBatches()
+			return
+		}
+		a.emitBatches()
+		if stats := a.GetPipelineStats(); totalDropped(stats) != dropped {
+			dropped = totalDropped(stats)
+			runtime.EventsEmit(a.ctx, "PipelineStats", stats)
+		}
+	}
+}
+
+func (a *App) emitBatches() {
+	if packets := a.httpBatch.Take(); len(packets) > 0 {
+		runtime.EventsEmit(a.ctx, "HTTPPackets", packets)
+	}
+	if packets := a.ipBatch.Take(); len(packets) > 0 {
+		runtime.EventsEmit(a.ctx, "IPPackets", packets)
+	}
+}
+
+func totalDropped(stats models.PipelineStats) uint64 {
+	n := stats.UIDropped
+	for _, s := range stats.Sources {
+		n += s.Dropped
+	}
+	return n
+}
+
+// 各来源发送和丢弃的数据包数量
+func (a *App) GetPipelineStats() models.PipelineStats {
+	stats := a.pipe.Stats()
+	stats.UIDropped = a.httpBatch.Dropped() + a.ipBatch.Dropped()
+	return stats
+}
+
 func (a *App) startup(ctx context.Context) {
 	a.ctx = ctx
+	go a.emitLoop()
+	a.loadConfig()
+	a.bodies.SetConfig(a.config.Body)
+	a.setFilter()
+	if err := a.newSession(); err != nil {
+		log.Println("newSession", err)
+	}
+
+	if store, err := a.certStore(); err == nil {
+		if err = store.MigrateLegacy(); err != nil {
+			log.Println("MigrateLegacy", err)
+		}
+	}
+}
+
+// 前端加载完成后才能收到事件，页面刷新时不重复启动
+func (a *App) domReady(ctx context.Context) {
+	a.watchOnce.Do(func() {
+		go a.watchCertExpiry()
+	})
+}
+
+func (a *App) loadConfig() {
 	b, err := os.ReadFile("config.json")
 	if err != nil {
 		log.Println("Read config.json", err)
@@ -111,13 +230,73 @@ func (a *App) startup(ctx context.Context) {
 		log.Println("Unmarshal config.json", err)
 		return
 	}
+	var legacy struct {
+		HTTP     struct{ FilterHost, FilterFingerprint string }
+		Cert     struct{ Passphrase string }
+		Upstream []struct{ Host, ClientPassword string }
+	}
+	if json.Unmarshal(b, &legacy) != nil {
+		return
+	}
+	// 旧版本的 HTTP.FilterHost 转换为过滤表达式
+	if legacy.HTTP.FilterHost != "" && a.config.HTTP.FilterQuery == "" {
+		a.config.HTTP.FilterQuery = fmt.Sprintf("host contains %q", legacy.HTTP.FilterHost)
+		a.config.HTTP.Filter = true
+	}
+	// 旧版本的 HTTP.FilterFingerprint 不受过滤开关影响，转换为 JA3 完全匹配或 JA4 前缀匹配的条件
+	if fp := strings.TrimSpace(legacy.HTTP.FilterFingerprint); fp != "" {
+		query := fmt.Sprintf("(ja3 == %q || ja4 ~ %q)", fp, "^"+regexp.QuoteMeta(fp))
+		if a.config.HTTP.Filter && a.config.HTTP.FilterQuery != "" {
+			query = fmt.Sprintf("(%s) && %s", a.config.HTTP.FilterQuery, query)
+		} else if a.config.HTTP.FilterQuery != "" {
+			log.Println("未开启的过滤表达式被指纹条件替换", a.config.HTTP.FilterQuery)
+		}
+		a.config.HTTP.FilterQuery = query
+		a.config.HTTP.Filter = true
+	}
+	// 旧版本明文保存的私钥密码改为加密保存，退出时写入的配置文件中不再包含密码
+	if passphrase := legacy.Cert.Passphrase; passphrase != "" {
+		if event := a.SetCertPassphrase(passphrase, true); event != nil {
+			log.Println("SetCertPassphrase", event.Message)
+		}
+	}
+	for _, u := range legacy.Upstream {
+		if u.ClientPassword != "" {
+			if event := a.SetUpstreamPassword(u.Host, u.ClientPassword, true); event != nil {
+				log.Println("SetUpstreamPassword", event.Message)
+			}
+		}
+	}
 }
 
 func (a *App) shutdown(ctx context.Context) {
+	// 先停止所有来源，再关闭队列，保存剩余的数据包
 	a.StopProxy()
 	a.StopIPCapture()
-	close(a.dataChan)
-	a.dataChan = nil
+	a.lock.Lock()
+	ipDone := a.ipDone
+	a.lock.Unlock()
+	if ipDone != nil {
+		select {
+		case <-ipDone:
+		case <-time.After(stopTimeout):
+			log.Println("等待网卡读取结束超时")
+		}
+	}
+	a.pipe.Close()
+	<-a.loopDone
+	<-a.emitDone
+	a.sessionLock.Lock()
+	a.writer.Sync(func(current *storage.Session) (*storage.Session, error) {
+		a.closeSession(current)
+		return nil, nil
+	})
+	a.session = nil
+	a.sessionLock.Unlock()
+	a.writer.Close()
+	if err := a.bodies.Close(); err != nil {
+		log.Println("BodyStore.Close", err)
+	}
 	b, err := json.Marshal(a.config)
 	if err != nil {
 		log.Println("Marshal config.json", err)
@@ -134,6 +313,11 @@ func (a *App) FireEvent(code int, msg string) {
 	runtime.EventsEmit(a.ctx, events.EVENT_TYPE_RESPONSE, &events.Event{Type: events.GENERAL, Code: code, Message: msg})
 }
 
+func (a *App) FireNoticeEvent(code int, msg string) {
+	log.Println("FireNoticeEvent", code, msg)
+	runtime.EventsEmit(a.ctx, events.EVENT_TYPE_NOTICE, &events.Event{Type: events.NOTICE, Code: code, Message: msg})
+}
+
 func (a *App) FireErrorEvent(code int, msg string) {
 	log.Println("FireErrorEvent", code, msg)
 	runtime.EventsEmit(a.ctx, events.EVENT_TYPE_ERROR, &events.Event{Type: events.ERROR, Code: code, Message: msg})
@@ -145,18 +329,477 @@ func (a *App) GetConfig() models.Config {
 
 func (a *App) SetConfig(field string, config models.Config) {
 	a.config = config
-	log.Println("SetConfig", field, config)
+	log.Println("SetConfig", field)
 	if field == "HTTP.AutoProxy" {
 		if a.config.HTTP.AutoProxy {
 			a.EnableProxy()
 		} else {
 			a.DisableProxy()
 		}
+	} else if field == "HTTP.PAC.Enable" && a.config.HTTP.AutoProxy {
+		a.EnableProxy()
+	} else if field == "Upstream" {
+		a.lock.Lock()
+		defer a.lock.Unlock()
+		if a.serve != nil {
+			if err := a.serve.SetUpstream(a.upstreamConfig()); err != nil {
+				a.FireErrorEvent(1, err.Error())
+			}
+		}
+	} else if field == "HTTP.KeyLogFile" {
+		a.lock.Lock()
+		defer a.lock.Unlock()
+		if a.serve != nil {
+			if err := a.serve.SetKeyLogFile(a.config.HTTP.KeyLogFile); err != nil {
+				a.FireErrorEvent(1, err.Error())
+			}
+		}
+	} else if strings.HasPrefix(field, "Capture") {
+		a.lock.Lock()
+		defer a.lock.Unlock()
+		if a.serve != nil {
+			a.serve.SetCapture(a.config.Capture)
+		}
+	} else if strings.HasPrefix(field, "Body") {
+		a.bodies.SetConfig(a.config.Body)
+	} else if field == "HTTP.Filter" || field == "HTTP.FilterQuery" {
+		a.setFilter()
+	} else if field == "Cert.Dir" {
+		// 从新的目录中读取保存的密码
+		a.passphrase.Store(nil)
+	}
+}
+
+// 编译过滤表达式，语法错误时继续使用之前的条件
+func (a *App) setFilter() {
+	if !a.config.HTTP.Filter {
+		a.filter.Store(nil)
+		return
+	}
+	f, err := filter.Parse(a.config.HTTP.FilterQuery)
+	if err != nil {
+		a.FireErrorEvent(1, err.Error())
+		return
+	}
+	a.filter.Store(f)
+}
+
+// 读取请求或响应的完整内容，part 为 request、response 或 response-raw，每次最多 1MB
+// encoding 为 base64 时返回 Base64 编码的数据，用于二进制内容
+func (a *App) GetBody(id, part string, offset, length int64, encoding string) (*models.BodyRange, error) {
+	return a.bodies.Range(id, part, offset, length, encoding)
+}
+
+// 清除保存的请求和响应内容
+func (a *App) ClearBodies() {
+	a.bodies.Clear()
+}
+
+// 关闭会话，没有数据的自动会话直接删除，在 Writer.Sync 中调用，之前的数据已经写入
+func (a *App) closeSession(session *storage.Session) {
+	if session == nil {
+		return
+	}
+	a.bodies.SetSession(nil)
+	empty := session.Empty()
+	if err := session.Close(); err != nil {
+		log.Println("Session.Close", err)
+	}
+	if empty && strings.HasPrefix(session.Name, autoSessionPrefix) {
+		storage.RemoveSession(session.Path)
+	}
+}
+
+// 切换到 path 的会话，清除内存中的内容
+func (a *App) switchSession(path string) error {
+	session, err := storage.OpenSession(path)
+	if err != nil {
+		return err
+	}
+	a.sessionLock.Lock()
+	defer a.sessionLock.Unlock()
+	a.writer.Sync(func(current *storage.Session) (*storage.Session, error) {
+		a.closeSession(current)
+		a.bodies.Clear()
+		a.bodies.SetSession(session)
+		return session, nil
+	})
+	a.session = session
+	return nil
+}
+
+func (a *App) currentSession() *storage.Session {
+	a.sessionLock.RLock()
+	defer a.sessionLock.RUnlock()
+	return a.session
+}
+
+func (a *App) sessionPath(name string) (string, error) {
+	dir, err := storage.SessionDir(a.config.Session.Dir)
+	if err != nil {
+		return "", err
+	}
+	return storage.SessionPath(dir, name)
+}
+
+// 新建以时间命名的自动会话
+func (a *App) newSession() error {
+	path, err := a.sessionPath(autoSessionPrefix + time.Now().Format("20060102-150405"))
+	if err != nil {
+		return err
+	}
+	return a.switchSession(path)
+}
+
+// 会话目录中的所有会话
+func (a *App) ListSessions() ([]models.SessionInfo, error) {
+	dir, err := storage.SessionDir(a.config.Session.Dir)
+	if err != nil {
+		return nil, err
+	}
+	list, err := storage.ListSessions(dir)
+	if err != nil {
+		return nil, err
+	}
+	a.sessionLock.RLock()
+	defer a.sessionLock.RUnlock()
+	for i := range list {
+		list[i].Current = a.session != nil && list[i].Name == a.session.Name
+	}
+	return list, nil
+}
+
+// 开始新的会话，之前的会话保留在会话目录中
+func (a *App) NewSession() *events.Event {
+	if err := a.newSession(); err != nil {
+		return &events.Event{Type: events.ERROR, Code: 1, Message: err.Error()}
+	}
+	return nil
+}
+
+// 打开保存的会话，之后抓取的数据包继续写入该会话，界面通过 QueryHTTPPackets 读取
+func (a *App) OpenSession(name string) *events.Event {
+	path, err := a.sessionPath(name)
+	if err != nil {
+		return &events.Event{Type: events.ERROR, Code: 1, Message: err.Error()}
+	}
+	if _, err = os.Stat(path); err != nil {
+		return &events.Event{Type: events.ERROR, Code: 1, Message: fmt.Sprintf("会话 %s 不存在", name)}
+	}
+	if err = a.switchSession(path); err != nil {
+		return &events.Event{Type: events.ERROR, Code: 1, Message: err.Error()}
+	}
+	return nil
+}
+
+// 当前会话另存为 name 并继续在其中记录，原来的自动会话删除
+// 同名会话已经存在时返回 Code 为 2 的错误，界面确认后以 overwrite 为 true 再次调用
+func (a *App) SaveSession(name string, overwrite bool) *events.Event {
+	path, err := a.sessionPath(name)
+	if err != nil {
+		return &events.Event{Type: events.ERROR, Code: 1, Message: err.Error()}
+	}
+	a.sessionLock.Lock()
+	defer a.sessionLock.Unlock()
+	if a.session == nil {
+		return &events.Event{Type: events.ERROR, Code: 1, Message: "没有正在记录的会话"}
+	}
+	// 写入暂停时复制，之后的数据包写入新的会话
+	saved := a.session
+	err = a.writer.Sync(func(current *storage.Session) (*storage.Session, error) {
+		if current.Path == path {
+			return current, nil
+		}
+		if _, err := os.Stat(path); err == nil && !overwrite {
+			return nil, fmt.Errorf("%w: %s", storage.ErrSessionExists, name)
+		}
+		if err := current.SaveAs(path); err != nil {
+			return nil, err
+		}
+		var err error
+		if saved, err = storage.OpenSession(path); err != nil {
+			return nil, err
+		}
+		// 接收完成的内容已经保存，没有完成的之后写入新的会话，不需要清除
+		a.bodies.SetSession(saved)
+		current.Close()
+		if strings.HasPrefix(current.Name, autoSessionPrefix) {
+			storage.RemoveSession(current.Path)
+		}
+		return saved, nil
+	})
+	if errors.Is(err, storage.ErrSessionExists) {
+		return &events.Event{Type: events.ERROR, Code: 2, Message: err.Error()}
+	}
+	if err != nil {
+		return &events.Event{Type: events.ERROR, Code: 1, Message: err.Error()}
+	}
+	a.session = saved
+	return nil
+}
+
+// 删除保存的会话，不能删除正在记录的会话
+func (a *App) DeleteSession(name string) *events.Event {
+	path, err := a.sessionPath(name)
+	if err != nil {
+		return &events.Event{Type: events.ERROR, Code: 1, Message: err.Error()}
+	}
+	a.sessionLock.RLock()
+	current := a.session != nil && a.session.Path == path
+	a.sessionLock.RUnlock()
+	if current {
+		return &events.Event{Type: events.ERROR, Code: 1, Message: "不能删除正在记录的会话"}
+	}
+	if err = storage.RemoveSession(path); err != nil {
+		return &events.Event{Type: events.ERROR, Code: 1, Message: err.Error()}
+	}
+	return nil
+}
+
+// 分页读取当前会话中的 HTTP 数据包，limit 最大 1000
+func (a *App) QueryHTTPPackets(offset, limit int) (*models.HTTPPacketPage, error) {
+	a.sessionLock.RLock()
+	defer a.sessionLock.RUnlock()
+	if a.session == nil {
+		return &models.HTTPPacketPage{Offset: offset}, nil
 	}
+	return a.session.HTTPPackets(offset, limit)
+}
+
+// 按过滤表达式分页读取当前会话中的 HTTP 数据包，query 为空时读取全部
+func (a *App) FilterHTTPPackets(query string, offset, limit int) (*models.HTTPPacketPage, error) {
+	f, err := filter.Parse(query)
+	if err != nil {
+		a.FireErrorEvent(1, err.Error())
+		return nil, err
+	}
+	if f == nil {
+		return a.QueryHTTPPackets(offset, limit)
+	}
+	// 在只读连接上扫描，不持有 sessionLock，简单条件在数据库中预筛选，完全可以转换时在数据库中分页
+	session := a.currentSession()
+	if session == nil {
+		return &models.HTTPPacketPage{Offset: offset}, nil
+	}
+	where, args, exact := f.SQL()
+	match := f.Match
+	if exact {
+		match = nil
+	}
+	return session.FindHTTPPackets(where, args, match, offset, limit)
+}
+
+// 在当前会话的 URL、Header、文本内容和 IP 数据包中搜索，返回匹配的请求 ID 和片段
+func (a *App) Search(opts models.SearchOptions) ([]models.SearchResult, error) {
+	// 在只读连接上搜索已经写入的数据，内容由 writer 在接收完成后写入
+	session := a.currentSession()
+	if session == nil {
+		return nil, nil
+	}
+	return session.Search(opts)
+}
+
+// 分页读取当前会话中的 IP 数据包
+func (a *App) QueryIPPackets(offset, limit int) (*models.IPPacketPage, error) {
+	a.sessionLock.RLock()
+	defer a.sessionLock.RUnlock()
+	if a.session == nil {
+		return &models.IPPacketPage{Offset: offset}, nil
+	}
+	return a.session.IPPackets(offset, limit)
+}
+
+// 导出会话为 zip 归档，name 为空时导出当前会话，filename 为空时弹出保存对话框
+func (a *App) ExportSession(name, filename string) *events.Event {
+	if filename == "" {
+		var err error
+		filename, err = runtime.SaveFileDialog(a.ctx, runtime.SaveDialogOptions{
+			DefaultFilename: "netsniffer-session.zip",
+			Title:           "导出会话",
+		})
+		if err != nil || filename == "" {
+			return nil
+		}
+	}
+	manifest, err := a.exportSession(name, filename)
+	log.Println("ExportSession", filename, manifest, err)
+	if err != nil {
+		return &events.Event{Type: events.ERROR, Code: 1, Message: err.Error()}
+	}
+	return nil
+}
+
+func (a *App) exportSession(name, filename string) (*models.SessionManifest, error) {
+	a.sessionLock.Lock()
+	current := a.session
+	if current != nil && (name == "" || name == current.Name) {
+		// 当前会话先复制一份，导出时不阻塞 RunLoop 写入
+		tmp := filepath.Join(os.TempDir(), fmt.Sprintf("netsniffer-export-%d%s", time.Now().UnixNano(), filepath.Ext(current.Path)))
+		err := a.writer.Sync(func(current *storage.Session) (*storage.Session, error) {
+			return current, current.SaveAs(tmp)
+		})
+		a.sessionLock.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		defer storage.RemoveSession(tmp)
+		session, err := storage.OpenSession(tmp)
+		if err != nil {
+			return nil, err
+		}
+		defer session.Close()
+		session.Name = current.Name
+		return session.ExportArchive(filename)
+	}
+	a.sessionLock.Unlock()
+
+	if name == "" {
+		return nil, fmt.Errorf("没有正在记录的会话")
+	}
+	path, err := a.sessionPath(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = os.Stat(path); err != nil {
+		return nil, fmt.Errorf("会话 %s 不存在", name)
+	}
+	session, err := storage.OpenSession(path)
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+	return session.ExportArchive(filename)
+}
+
+// 导入会话归档，保存为 name，为空时使用归档文件名，filename 为空时弹出选择对话框，返回导入的会话名称
+func (a *App) ImportSession(filename, name string) (string, error) {
+	if filename == "" {
+		var err error
+		filename, err = runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
+			Title:   "导入会话",
+			Filters: []runtime.FileFilter{{DisplayName: "会话归档 (*.zip)", Pattern: "*.zip"}},
+		})
+		if err != nil || filename == "" {
+			return "", err
+		}
+	}
+	return a.importSession(filename, name)
+}
+
+func (a *App) importSession(filename, name string) (string, error) {
+	if name == "" {
+		name = strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+	}
+	path, err := a.sessionPath(name)
+	if err != nil {
+		return "", err
+	}
+	manifest, err := storage.ImportArchive(filename, path)
+	log.Println("ImportSession", filename, name, manifest, err)
+	if err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// 根证书存储位置
+func (a *App) certStore() (*proxy.CertStore, error) {
+	store, err := proxy.NewCertStore(a.config.Cert.Dir, "")
+	if err != nil {
+		return nil, err
+	}
+	if passphrase := a.passphrase.Load(); passphrase != nil {
+		store.Passphrase = *passphrase
+		return store, nil
+	}
+	// 读取失败时不使用密码，加密的私钥读取时返回错误，由界面输入密码
+	passphrase, err := store.LoadPassphrase()
+	if err != nil {
+		log.Println("LoadPassphrase", err)
+		return store, nil
+	}
+	a.passphrase.Store(&passphrase)
+	store.Passphrase = passphrase
+	return store, nil
+}
+
+// 设置私钥密码，只保存在内存中，remember 为 true 时使用系统的数据保护接口加密保存，否则删除保存的密码
+// 之后生成和读取的证书生效
+func (a *App) SetCertPassphrase(passphrase string, remember bool) *events.Event {
+	a.passphrase.Store(&passphrase)
+	store, err := a.certStore()
+	if err != nil {
+		return &events.Event{Type: events.ERROR, Code: 1, Message: err.Error()}
+	}
+	if !remember {
+		passphrase = ""
+	}
+	if err = store.SavePassphrase(passphrase); err != nil {
+		return &events.Event{Type: events.ERROR, Code: 1, Message: fmt.Sprintf("%s，请设置环境变量 %s", err, proxy.PassphraseEnv)}
+	}
+	return nil
+}
+
+// 上游设置加上客户端证书密码
+func (a *App) upstreamConfig() []models.Upstream {
+	if len(a.config.Upstream) == 0 {
+		return nil
+	}
+	store, err := proxy.NewCertStore(a.config.Cert.Dir, "")
+	if err != nil {
+		log.Println("NewCertStore", err)
+	}
+	upstream := make([]models.Upstream, len(a.config.Upstream))
+	for i, u := range a.config.Upstream {
+		if u.ClientCert != "" {
+			if password, ok := a.upstreamPasswords.Load(u.Host); ok {
+				u.ClientPassword = password.(string)
+			} else if store != nil {
+				if u.ClientPassword, err = store.LoadUpstreamPassword(u.Host); err != nil {
+					log.Println("LoadUpstreamPassword", u.Host, err)
+				}
+			}
+		}
+		upstream[i] = u
+	}
+	return upstream
+}
+
+// 设置上游 host 的客户端证书密码，只保存在内存中，remember 为 true 时和私钥密码一样加密保存，否则删除保存的密码
+// 代理已经启动时立即生效
+func (a *App) SetUpstreamPassword(host string, password string, remember bool) *events.Event {
+	a.upstreamPasswords.Store(host, password)
+	a.lock.Lock()
+	if a.serve != nil {
+		if err := a.serve.SetUpstream(a.upstreamConfig()); err != nil {
+			a.lock.Unlock()
+			return &events.Event{Type: events.ERROR, Code: 1, Message: err.Error()}
+		}
+	}
+	a.lock.Unlock()
+	store, err := proxy.NewCertStore(a.config.Cert.Dir, "")
+	if err != nil {
+		return &events.Event{Type: events.ERROR, Code: 1, Message: err.Error()}
+	}
+	if !remember {
+		password = ""
+	}
+	if err = store.SaveUpstreamPassword(host, password); err != nil {
+		return &events.Event{Type: events.ERROR, Code: 1, Message: fmt.Sprintf("%s，请设置环境变量 %s", err, proxy.UpstreamPasswordEnvName(host))}
+	}
+	return nil
 }
 
 func (a *App) GenerateCert() *events.Event {
-	err := proxy.GenerateCert(authorityName)
+	store, err := a.certStore()
+	if err != nil {
+		return &events.Event{Type: events.ERROR, Code: 1, Message: err.Error()}
+	}
+	keyType, err := cert.ParseKeyType(a.config.Cert.KeyType)
+	if err != nil {
+		return &events.Event{Type: events.ERROR, Code: 1, Message: err.Error()}
+	}
+	err = proxy.GenerateCert(store, authorityName, keyType)
 	log.Println("GenerateCert", err)
 
 	if err != nil {
@@ -165,8 +808,112 @@ func (a *App) GenerateCert() *events.Event {
 	return nil
 }
 
+// 启动时和之后每天检查根证书有效期
+func (a *App) watchCertExpiry() {
+	ticker := time.NewTicker(24 * time.Hour)
+	defer ticker.Stop()
+	for {
+		if store, err := a.certStore(); err == nil {
+			warnDays := a.config.Cert.WarnDays
+			if warnDays <= 0 {
+				warnDays = 30
+			}
+			if msg := proxy.CheckCertExpiry(store, warnDays); msg != "" {
+				a.FireNoticeEvent(1, msg)
+			}
+		}
+		<-ticker.C
+	}
+}
+
+// 查看根证书信息
+func (a *App) InspectCert() (*models.CertInfo, error) {
+	store, err := a.certStore()
+	if err != nil {
+		return nil, err
+	}
+	return proxy.InspectCert(store)
+}
+
+// 轮换根证书，install 时安装新证书，removeOld 时按指纹卸载旧证书，代理运行中时立即使用新证书
+func (a *App) RotateCert(install, removeOld bool) *events.Event {
+	store, err := a.certStore()
+	if err != nil {
+		return &events.Event{Type: events.ERROR, Code: 1, Message: err.Error()}
+	}
+	keyType, err := cert.ParseKeyType(a.config.Cert.KeyType)
+	if err != nil {
+		return &events.Event{Type: events.ERROR, Code: 1, Message: err.Error()}
+	}
+	crt, privKey, err := proxy.RotateCert(store, authorityName, keyType, install, removeOld)
+	log.Println("RotateCert", err)
+
+	if crt != nil {
+		a.lock.Lock()
+		if a.serve != nil {
+			if serr := a.serve.SetAuthority(crt, privKey); serr != nil && err == nil {
+				err = serr
+			}
+		}
+		a.lock.Unlock()
+	}
+	if err != nil {
+		return &events.Event{Type: events.ERROR, Code: 1, Message: err.Error()}
+	}
+	return nil
+}
+
+// 导入已有的根证书，certFile 为 PEM 或 PKCS#12，代理运行中时立即使用新的根证书签发站点证书
+func (a *App) ImportCert(certFile, keyFile, password string) *events.Event {
+	store, err := a.certStore()
+	if err != nil {
+		return &events.Event{Type: events.ERROR, Code: 1, Message: err.Error()}
+	}
+	crt, privKey, err := proxy.ImportCert(store, certFile, keyFile, password)
+	log.Println("ImportCert", certFile, err)
+	if err != nil {
+		return &events.Event{Type: events.ERROR, Code: 1, Message: err.Error()}
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.serve != nil {
+		if err = a.serve.SetAuthority(crt, privKey); err != nil {
+			return &events.Event{Type: events.ERROR, Code: 1, Message: err.Error()}
+		}
+	}
+	return nil
+}
+
+// 导出根证书，格式为 pem、der 或 mobileconfig，filename 为空时弹出保存对话框
+func (a *App) ExportCert(format, filename string) *events.Event {
+	store, err := a.certStore()
+	if err != nil {
+		return &events.Event{Type: events.ERROR, Code: 1, Message: err.Error()}
+	}
+	if filename == "" {
+		filename, err = runtime.SaveFileDialog(a.ctx, runtime.SaveDialogOptions{
+			DefaultFilename: "netsniffer-ca." + format,
+			Title:           "导出根证书",
+		})
+		if err != nil || filename == "" {
+			return nil
+		}
+	}
+	err = proxy.ExportCert(store, format, filename)
+	log.Println("ExportCert", filename, err)
+	if err != nil {
+		return &events.Event{Type: events.ERROR, Code: 1, Message: err.Error()}
+	}
+	return nil
+}
+
 func (a *App) InstallCert() *events.Event {
-	err := proxy.InstallCert(authorityName)
+	store, err := a.certStore()
+	if err != nil {
+		return &events.Event{Type: events.ERROR, Code: 1, Message: err.Error()}
+	}
+	err = proxy.InstallCert(store, authorityName)
 	log.Println("InstallCert", err)
 	if err != nil {
 		return &events.Event{Type: events.ERROR, Code: 1, Message: err.Error()}
@@ -175,7 +922,11 @@ func (a *App) InstallCert() *events.Event {
 }
 
 func (a *App) UninstallCert() *events.Event {
-	err := proxy.UninstallCert(authorityName)
+	store, err := a.certStore()
+	if err != nil {
+		return &events.Event{Type: events.ERROR, Code: 1, Message: err.Error()}
+	}
+	err = proxy.UninstallCert(store, authorityName)
 	log.Println("UninstallCert", err)
 	if err != nil {
 		return &events.Event{Type: events.ERROR, Code: 1, Message: err.Error()}
@@ -185,7 +936,7 @@ func (a *App) UninstallCert() *events.Event {
 
 func (a *App) EnableProxy() *events.Event {
 	a.config.HTTP.AutoProxy = true
-	if err := proxy.EnableProxy(a.config.HTTP.Port); err != nil { // todo do after serve
+	if err := a.enableSystemProxy(); err != nil { // todo do after serve
 
 		return &events.Event{Type: events.ERROR, Code: 1, Message: err.Error()}
 
@@ -193,6 +944,29 @@ func (a *App) EnableProxy() *events.Event {
 	return nil
 }
 
+// 设置系统代理，PAC 模式下只有匹配的主机经过代理
+func (a *App) enableSystemProxy() error {
+	if a.config.HTTP.PAC.Enable {
+		return proxy.EnablePAC(proxy.PACURL(a.config.HTTP.Port))
+	}
+	return proxy.EnableProxy(a.config.HTTP.Port)
+}
+
+// 代理自身提供的接口
+func (a *App) newLocalHandler() *proxy.LocalHandler {
+	local := proxy.NewLocalHandler(a.config.HTTP.Port)
+	local.Handle(proxy.PACPath, func(req *http.Request, header http.Header) (string, []byte, error) {
+		pac := a.config.HTTP.PAC
+		// 使用设备访问代理的地址，局域网设备也可以使用
+		script := proxy.PACScript(proxy.PACProxyAddr(req.Host, req.RemoteAddr, a.config.HTTP.Port), pac.Include, pac.Exclude)
+		return proxy.PACContentType, []byte(script), nil
+	})
+	if store, err := a.certStore(); err == nil {
+		proxy.HandleCertRoutes(local, store)
+	}
+	return local
+}
+
 func (a *App) DisableProxy() *events.Event {
 	a.config.HTTP.AutoProxy = false
 	if err := proxy.DisableProxy(); err != nil { // todo do after serve
@@ -209,16 +983,37 @@ func (a *App) StartProxy() *events.Event {
 	if a.serve != nil {
 		return &events.Event{Type: events.ERROR, Code: 1, Message: "代理服务已经启动"}
 	}
-	serve, err := proxy.New(authorityName, handler.NewRequestLogger(a.ctx, a.dataChan))
+	store, err := a.certStore()
+	if err != nil {
+		return &events.Event{Type: events.ERROR, Code: 1, Message: err.Error()}
+	}
+	logger := handler.NewRequestLogger(a.ctx, func(p *models.Packet) bool {
+		return a.pipe.Publish(pipeline.SourceProxy, p)
+	}, a.bodies)
+	serve, err := proxy.New(store, authorityName, a.config.Cert, a.newLocalHandler(), logger)
+	if err == nil {
+		err = serve.SetUpstream(a.upstreamConfig())
+	}
+	if err == nil {
+		err = serve.SetKeyLogFile(a.config.HTTP.KeyLogFile)
+	}
+	if err == nil {
+		serve.SetCapture(a.config.Capture)
+	}
 
 	if err != nil {
 		return &events.Event{Type: events.ERROR, Code: 1, Message: err.Error()}
 	} else {
 		a.serve = serve
+		a.logger = logger
 		go func() {
 
 			// listen proxy
-			l, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", a.config.HTTP.Port))
+			host := "127.0.0.1"
+			if a.config.HTTP.AllowLAN {
+				host = ""
+			}
+			l, err := net.Listen("tcp", fmt.Sprintf("%s:%d", host, a.config.HTTP.Port))
 			if err != nil {
 				runtime.EventsEmit(a.ctx, events.EVENT_TYPE_ERROR, &events.Event{Type: events.ERROR, Code: 1, Message: fmt.Sprintf("启动代理失败: %s", err.Error())})
 				return
@@ -226,7 +1021,7 @@ func (a *App) StartProxy() *events.Event {
 
 			// serve proxy
 			if a.config.HTTP.AutoProxy {
-				if err := proxy.EnableProxy(a.config.HTTP.Port); err != nil { // todo do after serve
+				if err := a.enableSystemProxy(); err != nil { // todo do after serve
 
 					runtime.EventsEmit(a.ctx, events.EVENT_TYPE_ERROR, &events.Event{Type: events.ERROR, Code: 1, Message: fmt.Sprintf("启动代理失败: %s", err.Error())})
 					return
@@ -258,6 +1053,11 @@ func (a *App) StopProxy() *events.Event {
 		a.config.HTTP.Status = 0
 		a.serve.Close()
 		a.serve = nil
+		// 关闭队列和 BodyStore 之前等待记录协程发送完数据包
+		if !a.logger.Wait(stopTimeout) {
+			log.Println("等待代理记录结束超时")
+		}
+		a.logger = nil
 	} else {
 		return &events.Event{Type: events.ERROR, Code: 1, Message: "代理服务已经停止"}
 	}
@@ -297,7 +1097,12 @@ func (a *App) StartIPCapture(device string) {
 	a.lock.Lock()
 	defer a.lock.Unlock()
 	a.config.IP.Device = device
-	handle, err := pcap.OpenLive(a.config.IP.Device, a.config.IP.Snaplen, a.config.IP.Promisc, time.Duration(a.config.IP.Timeout)*time.Millisecond)
+	snaplen := a.config.IP.Snaplen
+	if a.config.IP.KeyLogFile != "" && snaplen < maxSnaplen {
+		// 截断的数据包无法重组
+		snaplen = maxSnaplen
+	}
+	handle, err := pcap.OpenLive(a.config.IP.Device, snaplen, a.config.IP.Promisc, time.Duration(a.config.IP.Timeout)*time.Millisecond)
 	if err != nil {
 		a.FireErrorEvent(2, fmt.Sprintf("数据抓包开启失败: %s", err.Error()))
 		return
@@ -312,15 +1117,26 @@ func (a *App) StartIPCapture(device string) {
 	a.tcphandle = handle
 	// Use the handle as a packet source to process all packets
 	packetSource := gopacket.NewPacketSource(handle, handle.LinkType())
+	// 重组 TCP 连接计算 TLS 客户端指纹，设置了密钥日志时再解密并解析 HTTP
+	decoder := capture.NewDecoder(nil, nil, nil)
+	if a.config.IP.KeyLogFile != "" {
+		decoder = capture.NewDecoder(capture.NewKeyLog(a.config.IP.KeyLogFile),
+			a.pipe.Publisher(pipeline.SourceDecoder), a.pipe.Dropper(pipeline.SourceDecoder))
+	}
+	done := make(chan struct{})
+	a.ipDone = done
 	go func() {
+		defer close(done)
 		for packet := range packetSource.Packets() {
 			// Process packet here
 			data := printPacketInfo(packet)
-			a.dataChan <- &models.Packet{
+			data.ClientTLS = decoder.Decode(packet)
+			a.pipe.Publish(pipeline.SourceCapture, &models.Packet{
 				PacketType: models.PacketType_IP,
 				IP:         data,
-			}
+			})
 		}
+		decoder.Close()
 		a.config.IP.Status = 0
 	}()
 }
@@ -342,7 +1158,11 @@ func (a *App) StopIPCapture() *events.Event {
 func printPacketInfo(packet gopacket.Packet) models.IPPacket {
 
 	data := models.IPPacket{}
-	data.Date = time.Now().Format(time.DateTime)
+	data.DateTime = packet.Metadata().Timestamp
+	if data.DateTime.IsZero() {
+		data.DateTime = time.Now()
+	}
+	data.Date = data.DateTime.Format(time.DateTime)
 
 	// Iterate over all layers, printing out each layer type
 	fmt.Println("------------------All packet layers:---------------------")
@@ -0,0 +1,239 @@
+package capture
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dreamsxin/go-netsniffer/cert"
+	"github.com/dreamsxin/go-netsniffer/models"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+type segment struct {
+	fromClient bool
+	data       []byte
+}
+
+// recordConn 按发送顺序记录双方写入的数据
+type recordConn struct {
+	net.Conn
+	fromClient bool
+	lock       *sync.Mutex
+	segments   *[]segment
+}
+
+func (c *recordConn) Write(b []byte) (int, error) {
+	c.lock.Lock()
+	*c.segments = append(*c.segments, segment{c.fromClient, append([]byte(nil), b...)})
+	c.lock.Unlock()
+	return c.Conn.Write(b)
+}
+
+// 在内存中完成一次 HTTPS 请求，返回双方发送的数据和密钥日志
+func exchange(t *testing.T, version uint16, suite uint16) ([]segment, *KeyLog) {
+	root, rootKey, err := cert.NewRootCA(cert.WithCommonName("Test Root"), cert.WithKeyType(cert.KeyTypeECDSA))
+	if err != nil {
+		t.Fatalf("NewRootCA failed: %s", err.Error())
+	}
+	leaf, leafKey, err := cert.NewLeafCert(root, rootKey, cert.WithSANs("example.com"), cert.WithKeyType(cert.KeyTypeRSA))
+	if err != nil {
+		t.Fatalf("NewLeafCert failed: %s", err.Error())
+	}
+
+	var lock sync.Mutex
+	var segments []segment
+	var keylog bytes.Buffer
+	c, s := net.Pipe()
+	client := tls.Client(&recordConn{c, true, &lock, &segments}, &tls.Config{
+		ServerName:         "example.com",
+		InsecureSkipVerify: true,
+		MinVersion:         version,
+		MaxVersion:         version,
+		CipherSuites:       []uint16{suite},
+		KeyLogWriter:       &keylog,
+	})
+	server := tls.Server(&recordConn{s, false, &lock, &segments}, &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{leaf.Raw}, PrivateKey: leafKey}},
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer server.Close()
+		req, err := http.ReadRequest(bufio.NewReader(server))
+		if err != nil {
+			t.Errorf("server ReadRequest failed: %s", err.Error())
+			return
+		}
+		body := "hello " + req.URL.Path + strings.Repeat(".", 4000)
+		server.Write([]byte("HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nContent-Length: " +
+			strconv.Itoa(len(body)) + "\r\n\r\n" + body))
+		// 读取客户端的 close_notify，net.Pipe 没有缓冲
+		io.Copy(io.Discard, server)
+	}()
+
+	client.Write([]byte("GET /index.html HTTP/1.1\r\nHost: example.com\r\n\r\n"))
+	res, err := http.ReadResponse(bufio.NewReader(client), nil)
+	if err != nil {
+		t.Fatalf("client ReadResponse failed: %s", err.Error())
+	}
+	res.Body.Close()
+	client.Close()
+	<-done
+
+	k, err := ParseKeyLog(&keylog)
+	if err != nil {
+		t.Fatalf("ParseKeyLog failed: %s", err.Error())
+	}
+	return segments, k
+}
+
+// 把双方发送的数据转换为 TCP 数据包，每个数据包最多 mss 字节
+// 抓包时间从 captureStart 开始每个数据包增加 1 毫秒
+var captureStart = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+func tcpPackets(t *testing.T, segments []segment, mss int) []gopacket.Packet {
+	clientIP, serverIP := net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2)
+	seq := map[bool]uint32{true: 1000, false: 5000}
+	var packets []gopacket.Packet
+	add := func(fromClient bool, tcp *layers.TCP, payload []byte) {
+		ip := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolTCP, SrcIP: clientIP, DstIP: serverIP}
+		tcp.SrcPort, tcp.DstPort = 50000, 443
+		if !fromClient {
+			ip.SrcIP, ip.DstIP = serverIP, clientIP
+			tcp.SrcPort, tcp.DstPort = 443, 50000
+		}
+		tcp.Seq = seq[fromClient]
+		tcp.Ack = seq[!fromClient]
+		tcp.Window = 65535
+		tcp.SetNetworkLayerForChecksum(ip)
+		buf := gopacket.NewSerializeBuffer()
+		err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}, ip, tcp, gopacket.Payload(payload))
+		if err != nil {
+			t.Fatalf("SerializeLayers failed: %s", err.Error())
+		}
+		packet := gopacket.NewPacket(buf.Bytes(), layers.LayerTypeIPv4, gopacket.Default)
+		packet.Metadata().Timestamp = captureStart.Add(time.Duration(len(packets)) * time.Millisecond)
+		packets = append(packets, packet)
+		seq[fromClient] += uint32(len(payload))
+		if tcp.SYN || tcp.FIN {
+			seq[fromClient]++
+		}
+	}
+
+	add(true, &layers.TCP{SYN: true}, nil)
+	add(false, &layers.TCP{SYN: true, ACK: true}, nil)
+	for _, s := range segments {
+		for data := s.data; len(data) > 0; {
+			n := min(len(data), mss)
+			add(s.fromClient, &layers.TCP{ACK: true, PSH: true}, data[:n])
+			data = data[n:]
+		}
+	}
+	add(true, &layers.TCP{FIN: true, ACK: true}, nil)
+	add(false, &layers.TCP{FIN: true, ACK: true}, nil)
+	return packets
+}
+
+func TestDecodeTLS(t *testing.T) {
+	tests := []struct {
+		name    string
+		version uint16
+		suite   uint16
+	}{
+		{"TLS13", tls.VersionTLS13, tls.TLS_AES_128_GCM_SHA256},
+		{"TLS12-GCM", tls.VersionTLS12, tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384},
+		{"TLS12-ChaCha20", tls.VersionTLS12, tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			segments, keylog := exchange(t, tt.version, tt.suite)
+
+			var lock sync.Mutex
+			var result []*models.Packet
+			decoder := NewDecoder(keylog, func(p *models.Packet) {
+				lock.Lock()
+				result = append(result, p)
+				lock.Unlock()
+			}, nil)
+			for _, packet := range tcpPackets(t, segments, 1000) {
+				decoder.Decode(packet)
+			}
+			decoder.Close()
+
+			if len(result) != 2 {
+				t.Fatalf("expected request and response, got %d packets", len(result))
+			}
+			req, res := result[0].HTTP, result[1].HTTP
+			if req.HTTPPacketType != models.HTTPPacketType_REQUEST {
+				req, res = res, req
+			}
+			if req.URL != "https://example.com/index.html" || req.ClientTLS == nil || req.ClientTLS.ServerName != "example.com" {
+				t.Errorf("unexpected request: %s %+v", req.URL, req.ClientTLS)
+			}
+			if res.StatusCode != 200 || !strings.HasPrefix(res.Body, "hello /index.html") || res.URL != req.URL {
+				t.Errorf("unexpected response: %d %s %.20s", res.StatusCode, res.URL, res.Body)
+			}
+			// 时间取自数据包，响应在请求之后
+			if !req.DateTime.After(captureStart) || !res.DateTime.After(req.DateTime) || res.DateTime.Sub(captureStart) > time.Second {
+				t.Errorf("unexpected time: request %s response %s", req.DateTime, res.DateTime)
+			}
+		})
+	}
+}
+
+func TestDecodeFingerprint(t *testing.T) {
+	segments, _ := exchange(t, tls.VersionTLS13, tls.TLS_AES_128_GCM_SHA256)
+	// ClientHello 分成多个数据包，最后一个数据包返回指纹
+	decoder := NewDecoder(nil, nil, nil)
+	var found []int
+	var hello *models.ClientFingerprint
+	for i, packet := range tcpPackets(t, segments, 100) {
+		if fp := decoder.Decode(packet); fp != nil {
+			found = append(found, i)
+			hello = fp
+		}
+	}
+	decoder.Close()
+	if len(found) != 1 || found[0] < 3 || hello.ServerName != "example.com" || hello.JA4 == "" {
+		t.Fatalf("fingerprint in packets %v: %+v", found, hello)
+	}
+}
+
+func TestStreamBuffer(t *testing.T) {
+	b := newStreamBuffer(8)
+	if !b.write([]byte("hello")) || b.write([]byte("world")) {
+		t.Fatal("write over limit accepted")
+	}
+	go b.close()
+	data, err := io.ReadAll(b)
+	if err != nil || string(data) != "hello" {
+		t.Fatalf("read %q %v", data, err)
+	}
+}
+
+// 解析跟不上时丢弃这个方向的剩余数据并计数，不阻塞写入
+func TestHTTPHalfDropped(t *testing.T) {
+	dropped := 0
+	h := httpHalf{buf: newStreamBuffer(8), dropped: func() { dropped++ }}
+	valid := func([]byte) bool { return true }
+	for _, data := range []string{"hello", "world", "again"} {
+		h.write([]byte(data), time.Now(), valid)
+	}
+	if dropped != 1 || !h.closed {
+		t.Fatalf("dropped %d closed %v", dropped, h.closed)
+	}
+	if data, err := io.ReadAll(h.buf); err != nil || string(data) != "hello" {
+		t.Fatalf("read %q %v", data, err)
+	}
+}
@@ -0,0 +1,378 @@
+package capture
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dreamsxin/go-netsniffer/codec"
+	"github.com/dreamsxin/go-netsniffer/models"
+	"github.com/dreamsxin/go-netsniffer/parser"
+)
+
+const (
+	// 每个请求或响应最多保存的内容长度
+	maxBodyLen = 1 << 20
+
+	// 收到响应时等待对应请求解析完成的时间
+	requestWait = 100 * time.Millisecond
+
+	// 每个方向等待解析的数据上限，超过时丢弃这个方向的剩余数据，不阻塞抓包
+	maxBuffered = 4 << 20
+)
+
+var httpMethods = []string{"GET ", "POST ", "PUT ", "DELETE ", "HEAD ", "OPTIONS ", "PATCH ", "CONNECT ", "TRACE "}
+
+// 判断数据是否以 HTTP/1.x 请求行开头，HTTP/2 的连接前言不属于
+func IsHTTPRequest(data []byte) bool {
+	for _, method := range httpMethods {
+		if bytes.HasPrefix(data, []byte(method)) {
+			return true
+		}
+	}
+	return false
+}
+
+func isHTTPResponse(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("HTTP/1."))
+}
+
+// httpHalf 一个方向的明文数据，由单独的协程解析
+type httpHalf struct {
+	buf     *streamBuffer
+	dropped func()
+	started bool
+	closed  bool
+	written int64
+	times   timeline
+}
+
+func (h *httpHalf) write(data []byte, ts time.Time, valid func([]byte) bool) {
+	if h.closed {
+		return
+	}
+	if !h.started {
+		h.started = true
+		if !valid(data) {
+			h.close()
+			return
+		}
+	}
+	h.times.add(h.written, ts)
+	h.written += int64(len(data))
+	if !h.buf.write(data) {
+		// 丢失数据后无法找到下一个消息的开始，解析完已缓冲的数据后结束
+		h.close()
+		if h.dropped != nil {
+			h.dropped()
+		}
+	}
+}
+
+func (h *httpHalf) close() {
+	if !h.closed {
+		h.closed = true
+		h.buf.close()
+	}
+}
+
+// streamBuffer 等待解析的数据，写入不阻塞，读取时等待新数据或关闭
+type streamBuffer struct {
+	lock   sync.Mutex
+	cond   sync.Cond
+	data   []byte
+	limit  int
+	closed bool
+}
+
+func newStreamBuffer(limit int) *streamBuffer {
+	b := &streamBuffer{limit: limit}
+	b.cond.L = &b.lock
+	return b
+}
+
+// 复制数据，超过上限时不写入并返回 false
+func (b *streamBuffer) write(data []byte) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.closed || len(b.data)+len(data) > b.limit {
+		return false
+	}
+	b.data = append(b.data, data...)
+	b.cond.Signal()
+	return true
+}
+
+func (b *streamBuffer) close() {
+	b.lock.Lock()
+	b.closed = true
+	b.cond.Signal()
+	b.lock.Unlock()
+}
+
+// 关闭后读取完剩余数据返回 io.EOF
+func (b *streamBuffer) Read(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for len(b.data) == 0 && !b.closed {
+		b.cond.Wait()
+	}
+	if len(b.data) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, b.data)
+	b.data = b.data[n:]
+	if len(b.data) == 0 {
+		b.data = nil
+	}
+	return n, nil
+}
+
+// timeline 记录每段数据在流中的位置和抓包时间，解析协程按消息开始的位置查找时间
+type timeline struct {
+	lock  sync.Mutex
+	marks []timeMark
+}
+
+type timeMark struct {
+	offset int64
+	ts     time.Time
+}
+
+func (t *timeline) add(offset int64, ts time.Time) {
+	t.lock.Lock()
+	t.marks = append(t.marks, timeMark{offset, ts})
+	t.lock.Unlock()
+}
+
+// 包含 offset 位置数据的那一段的时间，之前的记录不再需要
+// 只能在读到 offset 位置的数据之后调用
+func (t *timeline) at(offset int64) time.Time {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	i := 0
+	for i+1 < len(t.marks) && t.marks[i+1].offset <= offset {
+		i++
+	}
+	if i >= len(t.marks) {
+		return time.Now()
+	}
+	t.marks = t.marks[i:]
+	return t.marks[0].ts
+}
+
+// countReader 记录已经从管道读取的长度，减去缓冲中未解析的长度就是消息开始的位置
+type countReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+func (r *countReader) offset(br *bufio.Reader) int64 {
+	return r.n - int64(br.Buffered())
+}
+
+// httpConn 从一个连接的明文数据中解析 HTTP/1.x 请求和响应
+type httpConn struct {
+	scheme    string
+	clientTLS *models.ClientFingerprint
+	emit      func(*models.Packet)
+	req       httpHalf
+	res       httpHalf
+	requests  chan *http.Request // 已经解析的请求，用于匹配响应
+}
+
+func newHTTPConn(scheme string, clientTLS *models.ClientFingerprint, emit func(*models.Packet), dropped func(), done func()) *httpConn {
+	c := &httpConn{
+		scheme:    scheme,
+		clientTLS: clientTLS,
+		emit:      emit,
+		requests:  make(chan *http.Request, 64),
+	}
+	c.req.buf = newStreamBuffer(maxBuffered)
+	c.res.buf = newStreamBuffer(maxBuffered)
+	c.req.dropped = dropped
+	c.res.dropped = dropped
+	go func() {
+		c.readRequests(c.req.buf)
+		done()
+	}()
+	go func() {
+		c.readResponses(c.res.buf)
+		done()
+	}()
+	return c
+}
+
+// ts 为数据所在数据包的抓包时间
+func (c *httpConn) write(fromClient bool, data []byte, ts time.Time) {
+	if fromClient {
+		c.req.write(data, ts, IsHTTPRequest)
+	} else {
+		c.res.write(data, ts, isHTTPResponse)
+	}
+}
+
+func (c *httpConn) close() {
+	c.req.close()
+	c.res.close()
+}
+
+// 读取失败后丢弃剩余数据，直到连接关闭
+func (c *httpConn) readRequests(r io.Reader) {
+	defer close(c.requests)
+	cr := &countReader{r: r}
+	br := bufio.NewReader(cr)
+	for {
+		start := cr.offset(br)
+		req, err := http.ReadRequest(br)
+		if err != nil {
+			break
+		}
+		ts := c.req.times.at(start)
+		body := readBody(req.Body)
+		req.Body.Close()
+		if req.URL.Host == "" {
+			req.URL.Host = req.Host
+		}
+		if req.URL.Scheme == "" {
+			req.URL.Scheme = c.scheme
+		}
+
+		var data models.Packet
+		data.PacketType = models.PacketType_HTTP
+		data.HTTP.HTTPPacketType = models.HTTPPacketType_REQUEST
+		data.HTTP.DateTime = ts
+		data.HTTP.Date = data.HTTP.DateTime.Format(time.DateTime)
+		data.HTTP.Proto = req.Proto
+		data.HTTP.ProtoMajor = req.ProtoMajor
+		data.HTTP.ProtoMinor = req.ProtoMinor
+		data.HTTP.Method = req.Method
+		data.HTTP.Host = req.Host
+		data.HTTP.Path = req.URL.Path
+		data.HTTP.URL = req.URL.String()
+		data.HTTP.Header = req.Header
+		data.HTTP.ContentLength = req.ContentLength
+		data.HTTP.ClientTLS = c.clientTLS
+		data.HTTP.Body = bodyText(req.Header, body)
+		data.HTTP.Parsed = parseBody(req.Header, body)
+		c.emit(&data)
+
+		// 不能丢弃请求，否则之后的响应都会对应到错误的请求，响应解析结束后由 readResponses 继续接收
+		c.requests <- req
+	}
+	io.Copy(io.Discard, br)
+}
+
+func (c *httpConn) readResponses(r io.Reader) {
+	cr := &countReader{r: r}
+	br := bufio.NewReader(cr)
+	for {
+		// 收到响应的数据后等待对应的请求解析完成，HEAD 请求的响应没有内容需要按请求解析
+		if _, err := br.Peek(1); err != nil {
+			break
+		}
+		start := cr.offset(br)
+		ts := c.res.times.at(start)
+		var req *http.Request
+		select {
+		case req = <-c.requests:
+		case <-time.After(requestWait):
+		}
+		res, err := http.ReadResponse(br, req)
+		if err != nil {
+			break
+		}
+		body := readBody(res.Body)
+		res.Body.Close()
+
+		var data models.Packet
+		data.PacketType = models.PacketType_HTTP
+		data.HTTP.HTTPPacketType = models.HTTPPacketType_RESPONSE
+		data.HTTP.DateTime = ts
+		data.HTTP.Date = data.HTTP.DateTime.Format(time.DateTime)
+		data.HTTP.Proto = res.Proto
+		data.HTTP.ProtoMajor = res.ProtoMajor
+		data.HTTP.ProtoMinor = res.ProtoMinor
+		if req != nil {
+			data.HTTP.Method = req.Method
+			data.HTTP.Host = req.Host
+			data.HTTP.Path = req.URL.Path
+			data.HTTP.URL = req.URL.String()
+		}
+		data.HTTP.Header = res.Header
+		data.HTTP.Status = res.Status
+		data.HTTP.StatusCode = res.StatusCode
+		data.HTTP.ContentType = res.Header.Get("Content-Type")
+		data.HTTP.ContentLength = res.ContentLength
+		data.HTTP.ClientTLS = c.clientTLS
+		data.HTTP.Body = bodyText(res.Header, body)
+		data.HTTP.Parsed = parseBody(res.Header, body)
+		c.emit(&data)
+	}
+	// 继续接收请求，避免 readRequests 阻塞
+	drained := make(chan struct{})
+	go func() {
+		for range c.requests {
+		}
+		close(drained)
+	}()
+	io.Copy(io.Discard, br)
+	<-drained
+}
+
+// 读取全部内容，只保留前 maxBodyLen 字节
+func readBody(r io.Reader) []byte {
+	var buf bytes.Buffer
+	io.Copy(&buf, io.LimitReader(r, maxBodyLen))
+	io.Copy(io.Discard, r)
+	return buf.Bytes()
+}
+
+// 和代理记录的内容一致：只显示文本，按 Content-Encoding 解压
+func bodyText(header http.Header, body []byte) string {
+	if len(body) == 0 {
+		return "[no data]"
+	}
+	contentType := header.Get("Content-Type")
+	if contentType != "" && !strings.HasPrefix(contentType, "text/") && !strings.Contains(contentType, "json") &&
+		!strings.Contains(contentType, "form-urlencoded") {
+		return "[binary data]" + contentType
+	}
+
+	r, err := codec.Decode(bytes.NewReader(body), header.Get("Content-Encoding"), contentType)
+	if err != nil {
+		return err.Error()
+	}
+	defer r.Close()
+	data, err := io.ReadAll(io.LimitReader(r, maxBodyLen))
+	if err != nil {
+		log.Println("bodyText", err)
+		return err.Error()
+	}
+	return string(data)
+}
+
+// 解码后按内容类型解析，multipart 中的文件不保存
+func parseBody(header http.Header, body []byte) *models.ParsedBody {
+	if len(body) == 0 {
+		return nil
+	}
+	contentType := header.Get("Content-Type")
+	r, err := codec.Decode(bytes.NewReader(body), header.Get("Content-Encoding"), contentType)
+	if err != nil {
+		return nil
+	}
+	defer r.Close()
+	return parser.Parse(contentType, r, nil)
+}
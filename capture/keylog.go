@@ -0,0 +1,111 @@
+package capture
+
+import (
+	"bufio"
+	"encoding/hex"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NSS 密钥日志中的标签，https://developer.mozilla.org/en-US/docs/Mozilla/Projects/NSS/Key_Log_Format
+const (
+	labelClientRandom          = "CLIENT_RANDOM" // TLS 1.2 主密钥
+	labelClientHandshakeSecret = "CLIENT_HANDSHAKE_TRAFFIC_SECRET"
+	labelServerHandshakeSecret = "SERVER_HANDSHAKE_TRAFFIC_SECRET"
+	labelClientTrafficSecret   = "CLIENT_TRAFFIC_SECRET_0"
+	labelServerTrafficSecret   = "SERVER_TRAFFIC_SECRET_0"
+)
+
+// 文件修改后最多多久重新读取一次
+const keyLogReloadInterval = 200 * time.Millisecond
+
+type keyLogID struct {
+	label        string
+	clientRandom string
+}
+
+// KeyLog 读取浏览器或 tls.Config.KeyLogWriter 写入的 SSLKEYLOGFILE，找不到密钥时检查文件是否有更新
+type KeyLog struct {
+	lock    sync.Mutex
+	path    string
+	size    int64
+	modTime time.Time
+	checked time.Time
+	secrets map[keyLogID][]byte
+}
+
+// 打开密钥日志文件，文件可以还不存在，之后写入的密钥在查找时读取
+func NewKeyLog(path string) *KeyLog {
+	k := &KeyLog{path: path, secrets: make(map[keyLogID][]byte)}
+	k.reload()
+	return k
+}
+
+// 从内存中读取密钥日志，用于测试或导入
+func ParseKeyLog(r io.Reader) (*KeyLog, error) {
+	k := &KeyLog{secrets: make(map[keyLogID][]byte)}
+	if err := k.parse(r); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// 查找客户端随机数对应的密钥，没有找到或 k 为 nil 时返回 nil
+func (k *KeyLog) Secret(label string, clientRandom []byte) []byte {
+	if k == nil {
+		return nil
+	}
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	id := keyLogID{label: label, clientRandom: string(clientRandom)}
+	if secret, ok := k.secrets[id]; ok {
+		return secret
+	}
+	if k.path == "" || time.Since(k.checked) < keyLogReloadInterval {
+		return nil
+	}
+	k.reload()
+	return k.secrets[id]
+}
+
+// 文件大小或修改时间变化时重新读取，需要持有锁
+func (k *KeyLog) reload() {
+	k.checked = time.Now()
+	info, err := os.Stat(k.path)
+	if err != nil || (info.Size() == k.size && info.ModTime().Equal(k.modTime)) {
+		return
+	}
+	f, err := os.Open(k.path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	if k.parse(f) == nil {
+		k.size = info.Size()
+		k.modTime = info.ModTime()
+	}
+}
+
+// 每行格式为 <标签> <客户端随机数十六进制> <密钥十六进制>，无法识别的行忽略
+func (k *KeyLog) parse(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		random, err := hex.DecodeString(fields[1])
+		if err != nil || len(random) != 32 {
+			continue
+		}
+		secret, err := hex.DecodeString(fields[2])
+		if err != nil || len(secret) == 0 {
+			continue
+		}
+		k.secrets[keyLogID{label: fields[0], clientRandom: string(random)}] = secret
+	}
+	return scanner.Err()
+}
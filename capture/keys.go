@@ -0,0 +1,127 @@
+package capture
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+	"hash"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/cryptobyte"
+	"golang.org/x/crypto/hkdf"
+)
+
+// 支持解密的加密套件，只支持 AEAD 套件
+type suiteInfo struct {
+	keyLen int
+	ivLen  int // TLS 1.2 GCM 为隐式部分的 4 字节
+	hash   crypto.Hash
+	aead   func(key []byte) (cipher.AEAD, error)
+}
+
+var suites = map[uint16]suiteInfo{
+	// TLS 1.3
+	0x1301: {16, 12, crypto.SHA256, newGCM}, // TLS_AES_128_GCM_SHA256
+	0x1302: {32, 12, crypto.SHA384, newGCM}, // TLS_AES_256_GCM_SHA384
+	0x1303: {32, 12, crypto.SHA256, chacha20poly1305.New},
+	// TLS 1.2
+	0x009c: {16, 4, crypto.SHA256, newGCM}, // TLS_RSA_WITH_AES_128_GCM_SHA256
+	0x009d: {32, 4, crypto.SHA384, newGCM}, // TLS_RSA_WITH_AES_256_GCM_SHA384
+	0xc02b: {16, 4, crypto.SHA256, newGCM}, // TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256
+	0xc02c: {32, 4, crypto.SHA384, newGCM}, // TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384
+	0xc02f: {16, 4, crypto.SHA256, newGCM}, // TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256
+	0xc030: {32, 4, crypto.SHA384, newGCM}, // TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384
+	0xcca8: {32, 12, crypto.SHA256, chacha20poly1305.New},
+	0xcca9: {32, 12, crypto.SHA256, chacha20poly1305.New},
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (s suiteInfo) newHash() func() hash.Hash {
+	if s.hash == crypto.SHA384 {
+		return sha512.New384
+	}
+	return sha256.New
+}
+
+// TLS 1.2 PRF，RFC 5246 第 5 节
+func prf12(h func() hash.Hash, secret []byte, label string, seed []byte, n int) []byte {
+	labelSeed := append([]byte(label), seed...)
+	mac := hmac.New(h, secret)
+	mac.Write(labelSeed)
+	a := mac.Sum(nil)
+
+	out := make([]byte, 0, n)
+	for len(out) < n {
+		mac.Reset()
+		mac.Write(a)
+		mac.Write(labelSeed)
+		out = mac.Sum(out)
+
+		mac.Reset()
+		mac.Write(a)
+		a = mac.Sum(a[:0])
+	}
+	return out[:n]
+}
+
+// TLS 1.2 从主密钥计算双方的密钥，AEAD 套件没有 MAC 密钥
+func keys12(s suiteInfo, master, clientRandom, serverRandom []byte) (clientKey, serverKey, clientIV, serverIV []byte) {
+	seed := append(append([]byte(nil), serverRandom...), clientRandom...)
+	block := prf12(s.newHash(), master, "key expansion", seed, 2*s.keyLen+2*s.ivLen)
+	clientKey, block = block[:s.keyLen], block[s.keyLen:]
+	serverKey, block = block[:s.keyLen], block[s.keyLen:]
+	clientIV, block = block[:s.ivLen], block[s.ivLen:]
+	serverIV = block[:s.ivLen]
+	return
+}
+
+// HKDF-Expand-Label，RFC 8446 第 7.1 节
+func expandLabel(h func() hash.Hash, secret []byte, label string, context []byte, n int) []byte {
+	var b cryptobyte.Builder
+	b.AddUint16(uint16(n))
+	b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddBytes([]byte("tls13 " + label))
+	})
+	b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddBytes(context)
+	})
+	out := make([]byte, n)
+	if _, err := hkdf.Expand(h, secret, b.BytesOrPanic()).Read(out); err != nil {
+		panic(fmt.Errorf("hkdf: %w", err))
+	}
+	return out
+}
+
+// TLS 1.3 从流量密钥计算记录层密钥
+func keys13(s suiteInfo, secret []byte) (key, iv []byte) {
+	h := s.newHash()
+	return expandLabel(h, secret, "key", nil, s.keyLen), expandLabel(h, secret, "iv", nil, s.ivLen)
+}
+
+// TLS 1.3 KeyUpdate 后的下一个流量密钥
+func nextTrafficSecret(s suiteInfo, secret []byte) []byte {
+	return expandLabel(s.newHash(), secret, "traffic upd", nil, s.hash.Size())
+}
+
+// 记录序号与 IV 异或得到 nonce，用于 TLS 1.3 和 ChaCha20-Poly1305
+func xorNonce(iv []byte, seq uint64) []byte {
+	nonce := append([]byte(nil), iv...)
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], seq)
+	for i := range b {
+		nonce[len(nonce)-8+i] ^= b[i]
+	}
+	return nonce
+}
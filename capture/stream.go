@@ -0,0 +1,197 @@
+package capture
+
+import (
+	"sync"
+	"time"
+
+	"github.com/dreamsxin/go-netsniffer/fingerprint"
+	"github.com/dreamsxin/go-netsniffer/models"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/reassembly"
+)
+
+const (
+	// 按数据包时间定期关闭长时间没有数据的连接
+	flushInterval = time.Minute
+	streamTimeout = 2 * time.Minute
+
+	// 乱序等待重组的数据页数量上限，每页约 1900 字节
+	maxPagesPerConnection = 1024
+	maxPagesTotal         = 16384
+)
+
+// Decoder 重组抓到的 TCP 数据包，计算 TLS 客户端指纹，解密 TLS 后从明文中解析 HTTP 请求和响应
+// 只能在一个协程中调用 Decode，解析结果通过 emit 在其它协程中发送
+type Decoder struct {
+	keylog    *KeyLog
+	emit      func(*models.Packet)
+	dropped   func() // 解析跟不上时丢弃一个方向的剩余数据
+	assembler *reassembly.Assembler
+	lastFlush time.Time
+	wg        sync.WaitGroup
+	hello     *models.ClientFingerprint // 正在处理的数据包完成的 ClientHello
+}
+
+// keylog 为 nil 时不解密 TLS，只解析明文 HTTP，emit 也为 nil 时只计算 TLS 客户端指纹
+// 解析跟不上抓包时丢弃连接一个方向的剩余数据，每次调用 dropped，可以为 nil
+func NewDecoder(keylog *KeyLog, emit func(*models.Packet), dropped func()) *Decoder {
+	d := &Decoder{keylog: keylog, emit: emit, dropped: dropped}
+	d.assembler = reassembly.NewAssembler(reassembly.NewStreamPool(&streamFactory{decoder: d}))
+	d.assembler.MaxBufferedPagesPerConnection = maxPagesPerConnection
+	d.assembler.MaxBufferedPagesTotal = maxPagesTotal
+	return d
+}
+
+type captureContext struct {
+	ci gopacket.CaptureInfo
+}
+
+func (c *captureContext) GetCaptureInfo() gopacket.CaptureInfo {
+	return c.ci
+}
+
+// 处理一个数据包，不是 TCP 的数据包忽略
+// 这个数据包和之前的数据包重组后组成完整的 ClientHello 时返回客户端指纹
+func (d *Decoder) Decode(packet gopacket.Packet) *models.ClientFingerprint {
+	tcp, ok := packet.Layer(layers.LayerTypeTCP).(*layers.TCP)
+	if !ok || packet.NetworkLayer() == nil {
+		return nil
+	}
+	d.hello = nil
+	ci := packet.Metadata().CaptureInfo
+	if ci.Timestamp.IsZero() {
+		ci.Timestamp = time.Now()
+	}
+	d.assembler.AssembleWithContext(packet.NetworkLayer().NetworkFlow(), tcp, &captureContext{ci: ci})
+
+	if d.lastFlush.IsZero() {
+		d.lastFlush = ci.Timestamp
+	} else if ci.Timestamp.Sub(d.lastFlush) > flushInterval {
+		d.assembler.FlushCloseOlderThan(ci.Timestamp.Add(-streamTimeout))
+		d.lastFlush = ci.Timestamp
+	}
+	return d.hello
+}
+
+// 结束所有连接，等待解析完成
+func (d *Decoder) Close() {
+	d.assembler.FlushAll()
+	d.wg.Wait()
+}
+
+type streamFactory struct {
+	decoder *Decoder
+}
+
+func (f *streamFactory) New(netFlow, tcpFlow gopacket.Flow, tcp *layers.TCP, ac reassembly.AssemblerContext) reassembly.Stream {
+	return &tcpStream{decoder: f.decoder}
+}
+
+const (
+	streamUnknown = iota
+	streamTLS
+	streamHTTP
+	streamOther
+)
+
+// tcpStream 一个 TCP 连接，根据第一个数据判断是 TLS 还是 HTTP
+type tcpStream struct {
+	decoder   *Decoder
+	kind      int
+	clientDir reassembly.TCPFlowDirection
+	tls       *tlsConn
+	http      *httpConn
+	hello     bool      // 已经返回过客户端指纹
+	ts        time.Time // 正在处理的数据所在数据包的抓包时间
+}
+
+// 开始抓包前建立的连接也接收，根据内容判断能否解析
+func (s *tcpStream) Accept(tcp *layers.TCP, ci gopacket.CaptureInfo, dir reassembly.TCPFlowDirection, nextSeq reassembly.Sequence, start *bool, ac reassembly.AssemblerContext) bool {
+	*start = true
+	return true
+}
+
+func (s *tcpStream) ReassembledSG(sg reassembly.ScatterGather, ac reassembly.AssemblerContext) {
+	dir, _, _, skip := sg.Info()
+	length, _ := sg.Lengths()
+	if length == 0 || s.kind == streamOther {
+		return
+	}
+	data := sg.Fetch(length)
+	s.ts = ac.GetCaptureInfo().Timestamp
+
+	if s.kind == streamUnknown {
+		switch {
+		case fingerprint.IsClientHello(data):
+			s.kind = streamTLS
+			s.tls = newTLSConn(s.decoder.keylog, s.plaintext)
+		case s.decoder.emit != nil && IsHTTPRequest(data):
+			s.kind = streamHTTP
+			s.http = s.newHTTPConn("http", nil)
+		default:
+			s.kind = streamOther
+			return
+		}
+		s.clientDir = dir
+	} else if skip > 0 {
+		// 有数据包丢失，之后的数据无法继续解析
+		s.close()
+		s.kind = streamOther
+		return
+	}
+
+	fromClient := dir == s.clientDir
+	if s.kind == streamTLS {
+		if !s.decrypt() && !fromClient {
+			// ClientHello 在服务器响应之前发送完
+			s.kind = streamOther
+			return
+		}
+		s.tls.feed(fromClient, data)
+		if s.tls.hello != nil && !s.hello {
+			s.hello = true
+			s.decoder.hello = s.tls.hello.Fingerprint()
+		}
+		if s.hello && !s.decrypt() {
+			s.kind = streamOther
+		}
+	} else {
+		s.http.write(fromClient, data, s.ts)
+	}
+}
+
+// 有密钥日志并且需要解析 HTTP 时继续处理 TLS 记录，否则只需要 ClientHello
+func (s *tcpStream) decrypt() bool {
+	return s.decoder.keylog != nil && s.decoder.emit != nil
+}
+
+func (s *tcpStream) plaintext(fromClient bool, data []byte) {
+	if s.http == nil {
+		var clientTLS *models.ClientFingerprint
+		if s.tls.hello != nil {
+			clientTLS = s.tls.hello.Fingerprint()
+		}
+		s.http = s.newHTTPConn("https", clientTLS)
+	}
+	s.http.write(fromClient, data, s.ts)
+}
+
+func (s *tcpStream) newHTTPConn(scheme string, clientTLS *models.ClientFingerprint) *httpConn {
+	s.decoder.wg.Add(2)
+	return newHTTPConn(scheme, clientTLS, s.decoder.emit, s.decoder.dropped, s.decoder.wg.Done)
+}
+
+func (s *tcpStream) close() {
+	if s.tls != nil {
+		s.tls.flush()
+	}
+	if s.http != nil {
+		s.http.close()
+	}
+}
+
+func (s *tcpStream) ReassemblyComplete(ac reassembly.AssemblerContext) bool {
+	s.close()
+	return true
+}
@@ -0,0 +1,354 @@
+package capture
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"log"
+
+	"github.com/dreamsxin/go-netsniffer/fingerprint"
+	"golang.org/x/crypto/cryptobyte"
+)
+
+const (
+	recordHeaderLen = 5
+	maxRecordLen    = 1<<14 + 2048 // 加密记录的最大长度
+
+	recordTypeChangeCipherSpec = 20
+	recordTypeAlert            = 21
+	recordTypeHandshake        = 22
+	recordTypeApplicationData  = 23
+
+	handshakeClientHello = 1
+	handshakeServerHello = 2
+	handshakeFinished    = 20
+	handshakeKeyUpdate   = 24
+
+	extSupportedVersions = 0x002b
+
+	// 找不到密钥时每个方向最多暂存的记录数，超过后丢弃
+	maxPendingRecords = 256
+)
+
+// ServerHello 随机数为该值时是 HelloRetryRequest
+var helloRetryRequestRandom = []byte{
+	0xcf, 0x21, 0xad, 0x74, 0xe5, 0x9a, 0x61, 0x11, 0xbe, 0x1d, 0x8c, 0x02, 0x1e, 0x65, 0xb8, 0x91,
+	0xc2, 0xa2, 0x11, 0x16, 0x7a, 0xbb, 0x8c, 0x5e, 0x07, 0x9e, 0x09, 0xe2, 0xc8, 0xa8, 0x33, 0x9c,
+}
+
+var errUnsupported = errors.New("unsupported TLS connection")
+
+// 判断数据是否以 TLS 记录开头
+func IsTLS(data []byte) bool {
+	return len(data) >= 3 && data[0] >= recordTypeChangeCipherSpec && data[0] <= recordTypeApplicationData && data[1] == 3
+}
+
+// tlsHalf 一个方向的记录层状态
+type tlsHalf struct {
+	buf       []byte // 还不是完整记录的数据
+	hs        []byte // 还不是完整消息的握手数据
+	encrypted bool   // 之后的记录是加密的
+	label     string // 当前使用的密钥日志标签
+	secret    []byte // TLS 1.3 当前流量密钥
+	aead      cipher.AEAD
+	iv        []byte
+	seq       uint64
+	pending   [][]byte // 还没有找到密钥的加密记录
+}
+
+// tlsConn 使用密钥日志解密一个 TCP 连接中的 TLS 1.2/1.3 记录
+type tlsConn struct {
+	keylog       *KeyLog
+	clientRandom []byte
+	serverRandom []byte
+	version      uint16
+	suite        suiteInfo
+	hello        *fingerprint.ClientHello
+	client       tlsHalf
+	server       tlsHalf
+	err          error
+	onData       func(fromClient bool, data []byte) // 解密后的应用数据
+}
+
+func newTLSConn(keylog *KeyLog, onData func(fromClient bool, data []byte)) *tlsConn {
+	return &tlsConn{keylog: keylog, onData: onData}
+}
+
+func (c *tlsConn) half(fromClient bool) *tlsHalf {
+	if fromClient {
+		return &c.client
+	}
+	return &c.server
+}
+
+// 写入一个方向重组后的 TCP 数据
+func (c *tlsConn) feed(fromClient bool, data []byte) {
+	if c.err != nil {
+		return
+	}
+	h := c.half(fromClient)
+	h.buf = append(h.buf, data...)
+	for c.err == nil && len(h.buf) >= recordHeaderLen {
+		n := int(binary.BigEndian.Uint16(h.buf[3:5]))
+		if !IsTLS(h.buf) || n > maxRecordLen {
+			c.fail(errUnsupported)
+			return
+		}
+		if len(h.buf) < recordHeaderLen+n {
+			break
+		}
+		record := append([]byte(nil), h.buf[:recordHeaderLen+n]...)
+		h.buf = h.buf[recordHeaderLen+n:]
+		c.record(fromClient, record)
+	}
+	if len(h.buf) == 0 {
+		h.buf = nil
+	}
+}
+
+func (c *tlsConn) fail(err error) {
+	c.err = err
+	c.client = tlsHalf{}
+	c.server = tlsHalf{}
+}
+
+// 连接结束前再尝试解密暂存的记录
+func (c *tlsConn) flush() {
+	for _, fromClient := range []bool{true, false} {
+		if c.err == nil {
+			c.decryptPending(fromClient)
+		}
+	}
+}
+
+func (c *tlsConn) record(fromClient bool, record []byte) {
+	h := c.half(fromClient)
+	typ := record[0]
+	if typ == recordTypeChangeCipherSpec {
+		// TLS 1.3 为了兼容发送的 ChangeCipherSpec 不切换密钥
+		if c.version != 0x0304 {
+			h.encrypted = true
+			h.label = labelClientRandom
+			h.seq = 0
+		}
+		return
+	}
+	if !h.encrypted {
+		c.plaintext(fromClient, typ, record[recordHeaderLen:])
+		return
+	}
+	if len(h.pending) >= maxPendingRecords {
+		log.Println("TLS 解密密钥未找到，丢弃记录", len(h.pending))
+		return
+	}
+	h.pending = append(h.pending, record)
+	c.decryptPending(fromClient)
+}
+
+// 按顺序解密暂存的记录，找不到密钥时继续暂存
+func (c *tlsConn) decryptPending(fromClient bool) {
+	h := c.half(fromClient)
+	for len(h.pending) > 0 && c.err == nil {
+		if h.aead == nil && !c.installKeys(fromClient) {
+			return
+		}
+		record := h.pending[0]
+		h.pending = h.pending[1:]
+		typ, data, err := c.decrypt(h, record)
+		if err != nil {
+			log.Println("TLS 记录解密失败", err)
+			continue
+		}
+		c.plaintext(fromClient, typ, data)
+	}
+	if len(h.pending) == 0 {
+		h.pending = nil
+	}
+}
+
+func (c *tlsConn) decrypt(h *tlsHalf, record []byte) (byte, []byte, error) {
+	typ, body := record[0], record[recordHeaderLen:]
+	seq := h.seq
+	h.seq++
+	if c.version == 0x0304 {
+		data, err := h.aead.Open(nil, xorNonce(h.iv, seq), body, record[:recordHeaderLen])
+		if err != nil {
+			return 0, nil, err
+		}
+		// 去掉填充，最后一个非零字节是实际的记录类型
+		i := len(data) - 1
+		for i >= 0 && data[i] == 0 {
+			i--
+		}
+		if i < 0 {
+			return 0, nil, errors.New("missing inner content type")
+		}
+		return data[i], data[:i], nil
+	}
+
+	var nonce []byte
+	if len(h.iv) == 4 {
+		// GCM 的 nonce 后 8 字节在记录开头
+		if len(body) < 8 {
+			return 0, nil, errors.New("record too short")
+		}
+		nonce = append(append([]byte(nil), h.iv...), body[:8]...)
+		body = body[8:]
+	} else {
+		nonce = xorNonce(h.iv, seq)
+	}
+	if len(body) < h.aead.Overhead() {
+		return 0, nil, errors.New("record too short")
+	}
+	ad := make([]byte, 13)
+	binary.BigEndian.PutUint64(ad, seq)
+	copy(ad[8:], record[:3])
+	binary.BigEndian.PutUint16(ad[11:], uint16(len(body)-h.aead.Overhead()))
+	data, err := h.aead.Open(nil, nonce, body, ad)
+	return typ, data, err
+}
+
+// 从密钥日志中查找当前方向的密钥
+func (c *tlsConn) installKeys(fromClient bool) bool {
+	h := c.half(fromClient)
+	if c.clientRandom == nil || c.suite.aead == nil {
+		return false
+	}
+	secret := c.keylog.Secret(h.label, c.clientRandom)
+	if secret == nil {
+		return false
+	}
+
+	var key, iv []byte
+	if c.version == 0x0304 {
+		h.secret = secret
+		key, iv = keys13(c.suite, secret)
+	} else {
+		clientKey, serverKey, clientIV, serverIV := keys12(c.suite, secret, c.clientRandom, c.serverRandom)
+		key, iv = serverKey, serverIV
+		if fromClient {
+			key, iv = clientKey, clientIV
+		}
+	}
+	return c.setKey(h, key, iv)
+}
+
+func (c *tlsConn) setKey(h *tlsHalf, key, iv []byte) bool {
+	aead, err := c.suite.aead(key)
+	if err != nil {
+		c.fail(err)
+		return false
+	}
+	h.aead = aead
+	h.iv = iv
+	return true
+}
+
+func (c *tlsConn) plaintext(fromClient bool, typ byte, data []byte) {
+	switch typ {
+	case recordTypeHandshake:
+		h := c.half(fromClient)
+		h.hs = append(h.hs, data...)
+		for c.err == nil && len(h.hs) >= 4 {
+			n := int(h.hs[1])<<16 | int(h.hs[2])<<8 | int(h.hs[3])
+			if len(h.hs) < 4+n {
+				break
+			}
+			msg := h.hs[:4+n]
+			h.hs = h.hs[4+n:]
+			c.handshake(fromClient, msg)
+		}
+		if len(h.hs) == 0 {
+			h.hs = nil
+		}
+	case recordTypeApplicationData:
+		if len(data) > 0 && c.onData != nil {
+			c.onData(fromClient, data)
+		}
+	case recordTypeAlert:
+	}
+}
+
+func (c *tlsConn) handshake(fromClient bool, msg []byte) {
+	h := c.half(fromClient)
+	switch msg[0] {
+	case handshakeClientHello:
+		if !fromClient || len(msg) < 4+2+32 {
+			return
+		}
+		c.clientRandom = append([]byte(nil), msg[6:38]...)
+		if hello, err := fingerprint.Parse(msg); err == nil {
+			c.hello = hello
+		}
+	case handshakeServerHello:
+		if fromClient {
+			return
+		}
+		if err := c.serverHello(msg); err != nil {
+			c.fail(err)
+		}
+	case handshakeFinished:
+		if c.version != 0x0304 {
+			return
+		}
+		// TLS 1.3 Finished 之后的记录使用应用流量密钥
+		h.label = labelServerTrafficSecret
+		if fromClient {
+			h.label = labelClientTrafficSecret
+		}
+		h.aead = nil
+		h.seq = 0
+	case handshakeKeyUpdate:
+		if c.version != 0x0304 || h.secret == nil {
+			return
+		}
+		h.secret = nextTrafficSecret(c.suite, h.secret)
+		key, iv := keys13(c.suite, h.secret)
+		c.setKey(h, key, iv)
+		h.seq = 0
+	}
+}
+
+func (c *tlsConn) serverHello(msg []byte) error {
+	s := cryptobyte.String(msg[4:])
+	var version, suite uint16
+	var random, sessionID cryptobyte.String
+	var compression uint8
+	if !s.ReadUint16(&version) || !s.ReadBytes((*[]byte)(&random), 32) ||
+		!s.ReadUint8LengthPrefixed(&sessionID) || !s.ReadUint16(&suite) || !s.ReadUint8(&compression) {
+		return errors.New("malformed ServerHello")
+	}
+	if bytes.Equal(random, helloRetryRequestRandom) {
+		// 客户端会重新发送 ClientHello，等待真正的 ServerHello
+		return nil
+	}
+	var exts cryptobyte.String
+	if !s.Empty() && !s.ReadUint16LengthPrefixed(&exts) {
+		return errors.New("malformed ServerHello")
+	}
+	for !exts.Empty() {
+		var typ uint16
+		var data cryptobyte.String
+		if !exts.ReadUint16(&typ) || !exts.ReadUint16LengthPrefixed(&data) {
+			return errors.New("malformed ServerHello")
+		}
+		if typ == extSupportedVersions && !data.ReadUint16(&version) {
+			return errors.New("malformed ServerHello")
+		}
+	}
+
+	info, ok := suites[suite]
+	if !ok || version < 0x0303 {
+		return errUnsupported
+	}
+	c.serverRandom = append([]byte(nil), random...)
+	c.version = version
+	c.suite = info
+	if version == 0x0304 {
+		// ServerHello 之后双方都使用握手流量密钥
+		c.server.encrypted, c.server.label = true, labelServerHandshakeSecret
+		c.client.encrypted, c.client.label = true, labelClientHandshakeSecret
+	}
+	return nil
+}
@@ -1,15 +1,13 @@
 package cert
 
 import (
+	"crypto"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
-	"crypto/x509/pkix"
 	"encoding/pem"
-	"math/big"
-	"net"
+	"fmt"
 	"os"
-	"time"
 )
 
 const (
@@ -36,81 +34,52 @@ func GrantCert(template, parent *x509.Certificate, publicKey *rsa.PublicKey, pri
 }
 
 // 生成Root证书
-func GenRootCA() (*x509.Certificate, []byte, *rsa.PrivateKey, error) {
-
-	var rootTemplate = x509.Certificate{
-		SerialNumber: big.NewInt(1),
-		Subject: pkix.Name{
-			Country:      []string{"CN"},
-			Organization: []string{"Company Co."},
-			CommonName:   RootCommonName,
-		},
-		NotBefore:             time.Now().Add(-10 * time.Second),
-		NotAfter:              time.Now().AddDate(10, 0, 0),
-		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
-		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
-		BasicConstraintsValid: true,
-		IsCA:                  true,
-		MaxPathLen:            2,
-		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
-	}
-	priv, err := rsa.GenerateKey(rand.Reader, 2048)
-	if err != nil {
-		return nil, nil, nil, err
-	}
-	rootCert, rootPEM, err := GrantCert(&rootTemplate, &rootTemplate, &priv.PublicKey, priv)
-	return rootCert, rootPEM, priv, err
+func GenRootCA(opts ...Option) (*x509.Certificate, []byte, *rsa.PrivateKey, error) {
+	opts = append([]Option{
+		WithCountry("CN"),
+		WithOrganization("Company Co."),
+		WithCommonName(RootCommonName),
+		WithMaxPathLen(2),
+	}, opts...)
+	opts = append(opts, WithKeyType(KeyTypeRSA))
+	rootCert, priv, err := NewRootCA(opts...)
+	return rsaResult(rootCert, priv, err)
 }
 
 // 根据Root证书私钥生成中级证书
-func GenIntermediateCA(RootCert *x509.Certificate, RootKey *rsa.PrivateKey) (*x509.Certificate, []byte, *rsa.PrivateKey, error) {
-	priv, err := rsa.GenerateKey(rand.Reader, 2048)
-	if err != nil {
-		return nil, nil, nil, err
-	}
+func GenIntermediateCA(RootCert *x509.Certificate, RootKey *rsa.PrivateKey, opts ...Option) (*x509.Certificate, []byte, *rsa.PrivateKey, error) {
+	opts = append([]Option{
+		WithCountry("CN"),
+		WithOrganization("Company Co."),
+		WithCommonName(IntermediateCommonName),
+		WithMaxPathLen(1),
+	}, opts...)
+	opts = append(opts, WithKeyType(KeyTypeRSA))
+	DCACert, priv, err := NewIntermediateCA(RootCert, RootKey, opts...)
+	return rsaResult(DCACert, priv, err)
+}
 
-	var CATemplate = x509.Certificate{
-		SerialNumber: big.NewInt(1),
-		Subject: pkix.Name{
-			Country:      []string{"CN"},
-			Organization: []string{"Company Co."},
-			CommonName:   IntermediateCommonName,
-		},
-		NotBefore:             time.Now().Add(-10 * time.Second),
-		NotAfter:              time.Now().AddDate(10, 0, 0),
-		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
-		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
-		BasicConstraintsValid: true,
-		IsCA:                  true,
-		MaxPathLenZero:        false,
-		MaxPathLen:            1,
-		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
-	}
-	DCACert, DCAPEM, err := GrantCert(&CATemplate, RootCert, &priv.PublicKey, RootKey)
-	return DCACert, DCAPEM, priv, err
+// 根据中级证书私钥生成用户证书，默认用于 localhost 和 127.0.0.1
+func GenUserCert(CACert *x509.Certificate, CAKey *rsa.PrivateKey, opts ...Option) (*x509.Certificate, []byte, *rsa.PrivateKey, error) {
+	opts = append([]Option{
+		WithCommonName("localhost"),
+		WithSANs("localhost", "127.0.0.1"),
+		WithExtKeyUsage(x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth),
+	}, opts...)
+	opts = append(opts, WithKeyType(KeyTypeRSA))
+	userCert, priv, err := NewLeafCert(CACert, CAKey, opts...)
+	return rsaResult(userCert, priv, err)
 }
 
-// 根据中级证书私钥生成用户证书
-func GenUserCert(CACert *x509.Certificate, CAKey *rsa.PrivateKey) (*x509.Certificate, []byte, *rsa.PrivateKey, error) {
-	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+func rsaResult(crt *x509.Certificate, key crypto.Signer, err error) (*x509.Certificate, []byte, *rsa.PrivateKey, error) {
 	if err != nil {
 		return nil, nil, nil, err
 	}
-
-	var UserTemplate = x509.Certificate{
-		SerialNumber:   big.NewInt(1),
-		NotBefore:      time.Now().Add(-10 * time.Second),
-		NotAfter:       time.Now().AddDate(10, 0, 0),
-		KeyUsage:       x509.KeyUsageCRLSign,
-		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
-		IsCA:           false,
-		MaxPathLenZero: true,
-		IPAddresses:    []net.IP{net.ParseIP("127.0.0.1")},
+	priv, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("unexpected key type: %T", key)
 	}
-
-	userCert, userPEM, err := GrantCert(&UserTemplate, CACert, &priv.PublicKey, CAKey)
-	return userCert, userPEM, priv, err
-
+	return crt, EncodeCertPEM(crt), priv, nil
 }
 
 func VerifyCA(root *x509.Certificate, ca *x509.Certificate, intermediates ...*x509.Certificate) (chains [][]*x509.Certificate, err error) {
@@ -130,6 +99,18 @@ func VerifyCA(root *x509.Certificate, ca *x509.Certificate, intermediates ...*x5
 	return
 }
 
+// 解析 PEM 格式证书
+func ParseCertificatePEM(pemBytes []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found")
+	}
+	if block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("unsupported PEM type: %s", block.Type)
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
 func WriteCertToFile(cert *x509.Certificate, certFilePath string) error {
 	// open cert file
 	certOut, err := os.OpenFile(certFilePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
@@ -174,6 +155,25 @@ func SaveBlockToFile(filename string, block *pem.Block) error {
 	return nil
 }
 
+// 保存私钥，写入前限制只有当前用户可以访问，多个 PEM 块依次写入
+func SaveKeyToFile(filename string, blocks ...*pem.Block) error {
+	outFile, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer outFile.Close()
+
+	if err = restrictFile(filename); err != nil {
+		return err
+	}
+	for _, block := range blocks {
+		if err = pem.Encode(outFile, block); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func SaveToFile(filename string, data []byte) {
 	outFile, err := os.Create(filename)
 	if err != nil {
@@ -40,3 +40,21 @@ func UninstallCert(authorityName string) error {
 	}
 	return nil
 }
+
+// 根据 SHA-1 指纹判断证书是否已安装到受信任的根证书
+func IsCertInstalled(thumbprint string) bool {
+	return cmd.Command("certutil.exe", "-store", "Root", thumbprint).Run() == nil
+}
+
+// 根据 SHA-1 指纹卸载证书，不会误删同名的其他证书
+func UninstallCertByThumbprint(thumbprint string) error {
+	// Remove certificate from Trusted Root
+	err := cmd.Command("certutil.exe", "-f", "-delstore", "Root", thumbprint).Run()
+	if err != nil {
+		return err
+	}
+
+	// TrustedPublisher may not contain it
+	cmd.Command("certutil.exe", "-f", "-delstore", "TrustedPublisher", thumbprint).Run()
+	return nil
+}
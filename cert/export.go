@@ -0,0 +1,116 @@
+package cert
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+const (
+	ContentTypeDER          = "application/x-x509-ca-cert"
+	ContentTypePEM          = "application/x-pem-file"
+	ContentTypeMobileConfig = "application/x-apple-aspen-config"
+)
+
+func EncodeCertPEM(crt *x509.Certificate) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: crt.Raw})
+}
+
+// 证书 SHA-256 指纹，大写十六进制以冒号分隔
+func Fingerprint(crt *x509.Certificate) string {
+	sum := sha256.Sum256(crt.Raw)
+	hex := fmt.Sprintf("%X", sum[:])
+	var parts []string
+	for i := 0; i < len(hex); i += 2 {
+		parts = append(parts, hex[i:i+2])
+	}
+	return strings.Join(parts, ":")
+}
+
+// 证书 SHA-1 指纹，Windows 证书存储使用它作为证书标识
+func Thumbprint(crt *x509.Certificate) string {
+	sum := sha1.Sum(crt.Raw)
+	return fmt.Sprintf("%x", sum[:])
+}
+
+// 根据证书内容生成固定的 UUID，重复安装同一证书时 iOS 会替换而不是新增描述文件
+func certUUID(crt *x509.Certificate, salt string) string {
+	sum := sha256.Sum256(append([]byte(salt), crt.Raw...))
+	sum[6] = (sum[6] & 0x0f) | 0x50
+	sum[8] = (sum[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%X-%X-%X-%X-%X", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+var mobileConfigTemplate = template.Must(template.New("mobileconfig").Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>PayloadContent</key>
+	<array>
+		<dict>
+			<key>PayloadCertificateFileName</key>
+			<string>{{.FileName}}</string>
+			<key>PayloadContent</key>
+			<data>{{.Content}}</data>
+			<key>PayloadDescription</key>
+			<string>Adds a CA root certificate</string>
+			<key>PayloadDisplayName</key>
+			<string>{{.Name}}</string>
+			<key>PayloadIdentifier</key>
+			<string>com.apple.security.root.{{.CertUUID}}</string>
+			<key>PayloadType</key>
+			<string>com.apple.security.root</string>
+			<key>PayloadUUID</key>
+			<string>{{.CertUUID}}</string>
+			<key>PayloadVersion</key>
+			<integer>1</integer>
+		</dict>
+	</array>
+	<key>PayloadDisplayName</key>
+	<string>{{.Name}}</string>
+	<key>PayloadIdentifier</key>
+	<string>{{.Identifier}}</string>
+	<key>PayloadRemovalDisallowed</key>
+	<false/>
+	<key>PayloadType</key>
+	<string>Configuration</string>
+	<key>PayloadUUID</key>
+	<string>{{.ProfileUUID}}</string>
+	<key>PayloadVersion</key>
+	<integer>1</integer>
+</dict>
+</plist>
+`))
+
+// 生成 iOS/macOS 描述文件，安装后还需要在“证书信任设置”中开启完全信任
+func MobileConfig(crt *x509.Certificate, identifier string) ([]byte, error) {
+	name := crt.Subject.CommonName
+	if name == "" {
+		name = identifier
+	}
+	var b bytes.Buffer
+	err := mobileConfigTemplate.Execute(&b, map[string]string{
+		"FileName":    "ca.crt",
+		"Content":     base64.StdEncoding.EncodeToString(crt.Raw),
+		"Name":        templateEscape(name),
+		"Identifier":  identifier,
+		"CertUUID":    certUUID(crt, "certificate"),
+		"ProfileUUID": certUUID(crt, "profile"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func templateEscape(s string) string {
+	var b strings.Builder
+	template.HTMLEscape(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,100 @@
+package cert
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"time"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// 解析 PEM 中的所有证书，第一个为证书本身，其余为证书链
+func ParseCertificatesPEM(pemBytes []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, pemBytes = pem.Decode(pemBytes)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		crt, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, crt)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificate found")
+	}
+	return certs, nil
+}
+
+// 从 PEM 中找到私钥，证书和私钥可以在同一个文件中
+func ParsePrivateKeyFromPEM(pemBytes []byte, passphrase []byte) (crypto.Signer, error) {
+	for {
+		var block *pem.Block
+		block, pemBytes = pem.Decode(pemBytes)
+		if block == nil {
+			return nil, fmt.Errorf("no private key found")
+		}
+		switch block.Type {
+		case PEMTypeRSAPrivateKey, PEMTypeECPrivateKey, PEMTypePrivateKey, PEMTypeEncryptedPrivateKey:
+			return ParsePrivateKey(pem.EncodeToMemory(block), passphrase)
+		}
+	}
+}
+
+// 是否为 PEM 格式，否则按 DER/PKCS#12 处理
+func IsPEM(data []byte) bool {
+	return bytes.Contains(data, []byte("-----BEGIN "))
+}
+
+// 解析 PKCS#12 (.p12/.pfx) 证书包
+func DecodePKCS12(data []byte, password string) (crypto.Signer, *x509.Certificate, []*x509.Certificate, error) {
+	key, crt, chain, err := pkcs12.DecodeChain(data, password)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("unsupported private key algorithm: %T", key)
+	}
+	if KeyTypeOf(signer) == "" {
+		return nil, nil, nil, fmt.Errorf("unsupported private key algorithm: %T", key)
+	}
+	return signer, crt, chain, nil
+}
+
+// 检查证书可以作为签发站点证书的根证书，并且与私钥匹配
+func ValidateCA(crt *x509.Certificate, key crypto.Signer) error {
+	if !crt.BasicConstraintsValid || !crt.IsCA {
+		return errors.New("certificate is not a CA: basic constraints CA flag not set")
+	}
+	if crt.KeyUsage != 0 && crt.KeyUsage&x509.KeyUsageCertSign == 0 {
+		return errors.New("certificate is not allowed to sign certificates: missing keyCertSign usage")
+	}
+	now := time.Now()
+	if now.Before(crt.NotBefore) {
+		return fmt.Errorf("certificate is not valid before %s", crt.NotBefore.Format(time.DateTime))
+	}
+	if now.After(crt.NotAfter) {
+		return fmt.Errorf("certificate expired at %s", crt.NotAfter.Format(time.DateTime))
+	}
+	return KeyMatch(crt, key)
+}
+
+// 检查私钥与证书公钥是否匹配
+func KeyMatch(crt *x509.Certificate, key crypto.Signer) error {
+	pub, ok := key.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !pub.Equal(crt.PublicKey) {
+		return errors.New("private key does not match certificate")
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package cert
+
+import (
+	"crypto/rand"
+	"encoding/pem"
+	"testing"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// 测试导入根证书
+func TestImportCA(t *testing.T) {
+	rootCert, rootPEM, rootKey, err := GenRootCA()
+	if err != nil {
+		t.Fatalf("GenRootCA failed: %s", err.Error())
+	}
+	if err = ValidateCA(rootCert, rootKey); err != nil {
+		t.Errorf("ValidateCA failed: %s", err.Error())
+	}
+
+	otherKey, _ := GenerateKey(KeyTypeECDSA)
+	if err = ValidateCA(rootCert, otherKey); err == nil {
+		t.Errorf("ValidateCA should reject mismatched key")
+	}
+
+	userCert, _, userKey, err := GenUserCert(rootCert, rootKey)
+	if err != nil {
+		t.Fatalf("GenUserCert failed: %s", err.Error())
+	}
+	if err = ValidateCA(userCert, userKey); err == nil {
+		t.Errorf("ValidateCA should reject non-CA certificate")
+	}
+
+	block, _ := MarshalPrivateKey(rootKey, nil)
+	bundle := append(rootPEM, pem.EncodeToMemory(block)...)
+	certs, err := ParseCertificatesPEM(bundle)
+	if err != nil || len(certs) != 1 {
+		t.Fatalf("ParseCertificatesPEM failed: %v", err)
+	}
+	if _, err = ParsePrivateKeyFromPEM(bundle, nil); err != nil {
+		t.Errorf("ParsePrivateKeyFromPEM failed: %s", err.Error())
+	}
+
+	pfx, err := pkcs12.Modern.WithRand(rand.Reader).Encode(rootKey, rootCert, nil, "secret")
+	if err != nil {
+		t.Fatalf("pkcs12 Encode failed: %s", err.Error())
+	}
+	if IsPEM(pfx) {
+		t.Errorf("PKCS#12 detected as PEM")
+	}
+	key, crt, _, err := DecodePKCS12(pfx, "secret")
+	if err != nil {
+		t.Fatalf("DecodePKCS12 failed: %s", err.Error())
+	}
+	if err = ValidateCA(crt, key); err != nil {
+		t.Errorf("ValidateCA failed: %s", err.Error())
+	}
+}
@@ -0,0 +1,115 @@
+package cert
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"testing"
+)
+
+// 测试私钥加密保存和读取
+func TestMarshalPrivateKey(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %s", err.Error())
+	}
+
+	block, err := MarshalPrivateKey(priv, []byte("secret"))
+	if err != nil {
+		t.Fatalf("MarshalPrivateKey failed: %s", err.Error())
+	}
+	if block.Type != PEMTypeEncryptedPrivateKey {
+		t.Errorf("unexpected PEM type: %s", block.Type)
+	}
+	pemBytes := pem.EncodeToMemory(block)
+
+	key, err := ParsePrivateKey(pemBytes, []byte("secret"))
+	if err != nil {
+		t.Fatalf("ParsePrivateKey failed: %s", err.Error())
+	}
+	if !priv.Equal(key) {
+		t.Errorf("decrypted key does not match")
+	}
+
+	if _, err = ParsePrivateKey(pemBytes, nil); !errors.Is(err, ErrPassphraseRequired) {
+		t.Errorf("expected ErrPassphraseRequired, got %v", err)
+	}
+	if _, err = ParsePrivateKey(pemBytes, []byte("wrong")); err == nil {
+		t.Errorf("expected error with wrong passphrase")
+	}
+
+	block, err = MarshalPrivateKey(priv, nil)
+	if err != nil {
+		t.Fatalf("MarshalPrivateKey failed: %s", err.Error())
+	}
+	if _, err = ParsePrivateKey(pem.EncodeToMemory(block), nil); err != nil {
+		t.Errorf("ParsePrivateKey failed: %s", err.Error())
+	}
+}
+
+// 测试不同类型的私钥
+func TestKeyTypes(t *testing.T) {
+	for _, keyType := range []KeyType{KeyTypeRSA, KeyTypeECDSA, KeyTypeEd25519} {
+		priv, err := GenerateKey(keyType)
+		if err != nil {
+			t.Fatalf("GenerateKey %s failed: %s", keyType, err.Error())
+		}
+		if KeyTypeOf(priv) != keyType || KeyTypeOf(priv.Public()) != keyType {
+			t.Errorf("KeyTypeOf %s mismatch", keyType)
+		}
+
+		block, err := MarshalPrivateKey(priv, []byte("secret"))
+		if err != nil {
+			t.Fatalf("MarshalPrivateKey %s failed: %s", keyType, err.Error())
+		}
+		key, err := ParsePrivateKey(pem.EncodeToMemory(block), []byte("secret"))
+		if err != nil {
+			t.Fatalf("ParsePrivateKey %s failed: %s", keyType, err.Error())
+		}
+		if KeyTypeOf(key) != keyType {
+			t.Errorf("parsed key type %s, expected %s", KeyTypeOf(key), keyType)
+		}
+	}
+
+	ecKey, _ := GenerateKey(KeyTypeECDSA)
+	der, err := x509.MarshalECPrivateKey(ecKey.(*ecdsa.PrivateKey))
+	if err != nil {
+		t.Fatalf("MarshalECPrivateKey failed: %s", err.Error())
+	}
+	if _, err = ParsePrivateKey(pem.EncodeToMemory(&pem.Block{Type: PEMTypeECPrivateKey, Bytes: der}), nil); err != nil {
+		t.Errorf("ParsePrivateKey EC failed: %s", err.Error())
+	}
+}
+
+// 和 crypto/x509 自动生成的 Subject Key Identifier 一致
+func TestSubjectKeyID(t *testing.T) {
+	for _, keyType := range []KeyType{KeyTypeRSA, KeyTypeECDSA, KeyTypeEd25519} {
+		key, err := GenerateKey(keyType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		template := &x509.Certificate{
+			SerialNumber:          big.NewInt(1),
+			IsCA:                  true,
+			BasicConstraintsValid: true,
+			KeyUsage:              x509.KeyUsageCertSign,
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		crt, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyID, err := SubjectKeyID(key.Public())
+		if err != nil || !bytes.Equal(keyID, crt.SubjectKeyId) {
+			t.Errorf("%s: got %x want %x %v", keyType, keyID, crt.SubjectKeyId, err)
+		}
+	}
+}
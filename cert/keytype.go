@@ -0,0 +1,86 @@
+package cert
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+)
+
+type KeyType string
+
+const (
+	KeyTypeRSA     KeyType = "rsa"     // RSA 2048
+	KeyTypeECDSA   KeyType = "ecdsa"   // ECDSA P-256
+	KeyTypeEd25519 KeyType = "ed25519" // 大部分浏览器不支持 Ed25519 证书
+)
+
+// 解析密钥类型，为空时使用 RSA
+func ParseKeyType(s string) (KeyType, error) {
+	switch KeyType(s) {
+	case "", KeyTypeRSA:
+		return KeyTypeRSA, nil
+	case KeyTypeECDSA, "ec", "p256":
+		return KeyTypeECDSA, nil
+	case KeyTypeEd25519:
+		return KeyTypeEd25519, nil
+	}
+	return "", fmt.Errorf("unsupported key type: %s", s)
+}
+
+func GenerateKey(keyType KeyType) (crypto.Signer, error) {
+	switch keyType {
+	case "", KeyTypeRSA:
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case KeyTypeECDSA:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case KeyTypeEd25519:
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		return priv, err
+	}
+	return nil, fmt.Errorf("unsupported key type: %s", keyType)
+}
+
+func KeyTypeOf(key any) KeyType {
+	switch key.(type) {
+	case *rsa.PrivateKey, *rsa.PublicKey:
+		return KeyTypeRSA
+	case *ecdsa.PrivateKey, *ecdsa.PublicKey:
+		return KeyTypeECDSA
+	case ed25519.PrivateKey, ed25519.PublicKey:
+		return KeyTypeEd25519
+	}
+	return ""
+}
+
+// 证书中使用的密钥用途，只有 RSA 能用于密钥交换加密
+func KeyUsageFor(key any) x509.KeyUsage {
+	if KeyTypeOf(key) == KeyTypeRSA {
+		return x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
+	}
+	return x509.KeyUsageDigitalSignature
+}
+
+// RFC 5280 4.2.1.2 方法一生成 Subject Key Identifier，和 crypto/x509 一样只对 subjectPublicKey 的内容取 SHA-1
+func SubjectKeyID(pub crypto.PublicKey) ([]byte, error) {
+	pkixpub, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err = asn1.Unmarshal(pkixpub, &spki); err != nil {
+		return nil, err
+	}
+	h := sha1.Sum(spki.PublicKey.Bytes)
+	return h[:], nil
+}
@@ -0,0 +1,294 @@
+package cert
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"net/url"
+	"time"
+)
+
+// 证书序列号最大值，RFC 5280 要求不超过 20 字节
+var maxSerialNumber = new(big.Int).Lsh(big.NewInt(1), 159)
+
+// 默认有效期
+const (
+	DefaultCAValidity   = 10 * 365 * 24 * time.Hour
+	DefaultLeafValidity = 365 * 24 * time.Hour
+)
+
+// Options 签发证书的参数，通过 Option 设置
+type Options struct {
+	Subject     pkix.Name
+	DNSNames    []string
+	IPAddresses []net.IP
+	URIs        []*url.URL
+	KeyUsage    x509.KeyUsage
+	ExtKeyUsage []x509.ExtKeyUsage
+	NotBefore   time.Time // 为零值时使用当前时间
+	Validity    time.Duration
+	KeyType     KeyType
+	Key         crypto.Signer // 使用已有密钥，不生成新密钥
+	MaxPathLen  int           // 只对 CA 有效，-1 表示不限制
+}
+
+type Option func(*Options)
+
+func WithSubject(subject pkix.Name) Option {
+	return func(o *Options) {
+		o.Subject = subject
+	}
+}
+
+func WithCommonName(name string) Option {
+	return func(o *Options) {
+		o.Subject.CommonName = name
+	}
+}
+
+func WithOrganization(organization ...string) Option {
+	return func(o *Options) {
+		o.Subject.Organization = organization
+	}
+}
+
+func WithCountry(country ...string) Option {
+	return func(o *Options) {
+		o.Subject.Country = country
+	}
+}
+
+func WithDNSNames(names ...string) Option {
+	return func(o *Options) {
+		o.DNSNames = append(o.DNSNames, names...)
+	}
+}
+
+func WithIPAddresses(ips ...net.IP) Option {
+	return func(o *Options) {
+		o.IPAddresses = append(o.IPAddresses, ips...)
+	}
+}
+
+func WithURIs(uris ...*url.URL) Option {
+	return func(o *Options) {
+		o.URIs = append(o.URIs, uris...)
+	}
+}
+
+// 按内容区分 IP、URI 和域名
+func WithSANs(names ...string) Option {
+	return func(o *Options) {
+		for _, name := range names {
+			if ip := net.ParseIP(name); ip != nil {
+				o.IPAddresses = append(o.IPAddresses, ip)
+			} else if u, err := url.Parse(name); err == nil && u.Scheme != "" && u.Host != "" {
+				o.URIs = append(o.URIs, u)
+			} else {
+				o.DNSNames = append(o.DNSNames, name)
+			}
+		}
+	}
+}
+
+// 为零值时按密钥类型和证书用途选择
+func WithKeyUsage(usage x509.KeyUsage) Option {
+	return func(o *Options) {
+		o.KeyUsage = usage
+	}
+}
+
+func WithExtKeyUsage(usage ...x509.ExtKeyUsage) Option {
+	return func(o *Options) {
+		o.ExtKeyUsage = usage
+	}
+}
+
+func WithNotBefore(t time.Time) Option {
+	return func(o *Options) {
+		o.NotBefore = t
+	}
+}
+
+func WithValidity(validity time.Duration) Option {
+	return func(o *Options) {
+		o.Validity = validity
+	}
+}
+
+func WithKeyType(keyType KeyType) Option {
+	return func(o *Options) {
+		o.KeyType = keyType
+	}
+}
+
+func WithKey(key crypto.Signer) Option {
+	return func(o *Options) {
+		o.Key = key
+	}
+}
+
+func WithMaxPathLen(n int) Option {
+	return func(o *Options) {
+		o.MaxPathLen = n
+	}
+}
+
+// 生成随机序列号
+func RandomSerial() (*big.Int, error) {
+	return rand.Int(rand.Reader, maxSerialNumber)
+}
+
+func newOptions(validity time.Duration, opts []Option) *Options {
+	o := &Options{
+		Validity:   validity,
+		KeyType:    KeyTypeRSA,
+		MaxPathLen: -1,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.NotBefore.IsZero() {
+		// 留出时钟误差
+		o.NotBefore = time.Now().Add(-time.Minute)
+	}
+	return o
+}
+
+func (o *Options) key() (crypto.Signer, error) {
+	if o.Key != nil {
+		return o.Key, nil
+	}
+	return GenerateKey(o.KeyType)
+}
+
+func (o *Options) template(key crypto.Signer) (*x509.Certificate, error) {
+	serial, err := RandomSerial()
+	if err != nil {
+		return nil, err
+	}
+	keyID, err := SubjectKeyID(key.Public())
+	if err != nil {
+		return nil, err
+	}
+	return &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               o.Subject,
+		SubjectKeyId:          keyID,
+		DNSNames:              o.DNSNames,
+		IPAddresses:           o.IPAddresses,
+		URIs:                  o.URIs,
+		KeyUsage:              o.KeyUsage,
+		ExtKeyUsage:           o.ExtKeyUsage,
+		NotBefore:             o.NotBefore,
+		NotAfter:              o.NotBefore.Add(o.Validity),
+		BasicConstraintsValid: true,
+	}, nil
+}
+
+func (o *Options) caTemplate(key crypto.Signer) (*x509.Certificate, error) {
+	tmpl, err := o.template(key)
+	if err != nil {
+		return nil, err
+	}
+	tmpl.IsCA = true
+	if tmpl.KeyUsage == 0 {
+		tmpl.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature
+	}
+	if o.MaxPathLen == 0 {
+		tmpl.MaxPathLenZero = true
+	} else {
+		tmpl.MaxPathLen = o.MaxPathLen
+	}
+	return tmpl, nil
+}
+
+// 用上级证书签发证书
+func Sign(tmpl, parent *x509.Certificate, pub crypto.PublicKey, parentKey crypto.Signer) (*x509.Certificate, error) {
+	raw, err := x509.CreateCertificate(rand.Reader, tmpl, parent, pub, parentKey)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(raw)
+}
+
+// 生成自签名根证书，默认有效期 10 年
+func NewRootCA(opts ...Option) (*x509.Certificate, crypto.Signer, error) {
+	o := newOptions(DefaultCAValidity, opts)
+	key, err := o.key()
+	if err != nil {
+		return nil, nil, err
+	}
+	tmpl, err := o.caTemplate(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	crt, err := Sign(tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return crt, key, nil
+}
+
+// 用上级 CA 签发中级证书，默认有效期 10 年且不超过上级证书，默认不能再签发下级 CA
+func NewIntermediateCA(parent *x509.Certificate, parentKey crypto.Signer, opts ...Option) (*x509.Certificate, crypto.Signer, error) {
+	o := newOptions(DefaultCAValidity, append([]Option{WithMaxPathLen(0)}, opts...))
+	key, err := o.key()
+	if err != nil {
+		return nil, nil, err
+	}
+	tmpl, err := o.caTemplate(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	clampValidity(tmpl, parent)
+	crt, err := Sign(tmpl, parent, key.Public(), parentKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return crt, key, nil
+}
+
+// 用 CA 签发站点或客户端证书，默认有效期 1 年且不超过上级证书
+func NewLeafCert(parent *x509.Certificate, parentKey crypto.Signer, opts ...Option) (*x509.Certificate, crypto.Signer, error) {
+	o := newOptions(DefaultLeafValidity, opts)
+	if len(o.DNSNames) == 0 && len(o.IPAddresses) == 0 && len(o.URIs) == 0 {
+		if o.Subject.CommonName == "" {
+			return nil, nil, errors.New("certificate has no subject alternative name")
+		}
+		WithSANs(o.Subject.CommonName)(o)
+	}
+	key, err := o.key()
+	if err != nil {
+		return nil, nil, err
+	}
+	tmpl, err := o.template(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if tmpl.KeyUsage == 0 {
+		tmpl.KeyUsage = KeyUsageFor(key)
+	}
+	if len(tmpl.ExtKeyUsage) == 0 {
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	}
+	clampValidity(tmpl, parent)
+	crt, err := Sign(tmpl, parent, key.Public(), parentKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return crt, key, nil
+}
+
+func clampValidity(tmpl, parent *x509.Certificate) {
+	if tmpl.NotAfter.After(parent.NotAfter) {
+		tmpl.NotAfter = parent.NotAfter
+	}
+	if tmpl.NotBefore.Before(parent.NotBefore) {
+		tmpl.NotBefore = parent.NotBefore
+	}
+}
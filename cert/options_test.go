@@ -0,0 +1,52 @@
+package cert
+
+import (
+	"crypto/x509"
+	"testing"
+	"time"
+)
+
+// 测试按参数签发证书链
+func TestNewLeafCert(t *testing.T) {
+	root, rootKey, err := NewRootCA(WithCommonName("Test Root"), WithKeyType(KeyTypeECDSA), WithValidity(24*time.Hour))
+	if err != nil {
+		t.Fatalf("NewRootCA failed: %s", err.Error())
+	}
+	inter, interKey, err := NewIntermediateCA(root, rootKey, WithCommonName("Test Intermediate"), WithKeyType(KeyTypeEd25519))
+	if err != nil {
+		t.Fatalf("NewIntermediateCA failed: %s", err.Error())
+	}
+	if !inter.MaxPathLenZero || inter.NotAfter.After(root.NotAfter) {
+		t.Errorf("intermediate constraints not applied: maxPathLenZero=%v notAfter=%s", inter.MaxPathLenZero, inter.NotAfter)
+	}
+
+	leaf, _, err := NewLeafCert(inter, interKey,
+		WithCommonName("example.com"),
+		WithSANs("example.com", "*.example.com", "10.0.0.1", "spiffe://example.com/app"),
+	)
+	if err != nil {
+		t.Fatalf("NewLeafCert failed: %s", err.Error())
+	}
+	if len(leaf.DNSNames) != 2 || len(leaf.IPAddresses) != 1 || len(leaf.URIs) != 1 {
+		t.Errorf("unexpected SANs: %v %v %v", leaf.DNSNames, leaf.IPAddresses, leaf.URIs)
+	}
+	if leaf.SerialNumber.Cmp(inter.SerialNumber) == 0 {
+		t.Errorf("serial number reused: %s", leaf.SerialNumber)
+	}
+
+	_, err = VerifyCA(root, leaf, inter)
+	if err != nil {
+		t.Errorf("VerifyCA failed: %s", err.Error())
+	}
+	inters := x509.NewCertPool()
+	inters.AddCert(inter)
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+	if _, err = leaf.Verify(x509.VerifyOptions{DNSName: "www.example.com", Roots: roots, Intermediates: inters}); err != nil {
+		t.Errorf("Verify failed: %s", err.Error())
+	}
+
+	if _, _, err = NewLeafCert(inter, interKey); err == nil {
+		t.Errorf("NewLeafCert without SAN should fail")
+	}
+}
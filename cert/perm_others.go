@@ -0,0 +1,25 @@
+//go:build !windows
+
+package cert
+
+import (
+	"fmt"
+	"os"
+)
+
+// 限制私钥文件只有当前用户可以读写
+func restrictFile(filename string) error {
+	return os.Chmod(filename, 0600)
+}
+
+// 检查私钥文件是否能被其他用户读取
+func CheckKeyFilePermission(filename string) error {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+	if perm := info.Mode().Perm(); perm&0077 != 0 {
+		return fmt.Errorf("private key %s has insecure permissions %#o, expected 0600", filename, perm)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package cert
+
+import (
+	"fmt"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// 能读取私钥的访问权限
+const readAccess = windows.FILE_READ_DATA | windows.GENERIC_READ | windows.GENERIC_ALL
+
+// 不应该拥有私钥读取权限的用户组
+var insecureSids = []windows.WELL_KNOWN_SID_TYPE{
+	windows.WinWorldSid,
+	windows.WinAuthenticatedUserSid,
+	windows.WinBuiltinUsersSid,
+	windows.WinBuiltinGuestsSid,
+	windows.WinAnonymousSid,
+}
+
+// 限制私钥文件只有当前用户、SYSTEM 和管理员可以访问，不继承目录权限
+func restrictFile(filename string) error {
+	user, err := windows.GetCurrentProcessToken().GetTokenUser()
+	if err != nil {
+		return err
+	}
+	system, err := windows.CreateWellKnownSid(windows.WinLocalSystemSid)
+	if err != nil {
+		return err
+	}
+	admins, err := windows.CreateWellKnownSid(windows.WinBuiltinAdministratorsSid)
+	if err != nil {
+		return err
+	}
+
+	var access []windows.EXPLICIT_ACCESS
+	for _, sid := range []*windows.SID{user.User.Sid, system, admins} {
+		access = append(access, windows.EXPLICIT_ACCESS{
+			AccessPermissions: windows.GENERIC_ALL,
+			AccessMode:        windows.GRANT_ACCESS,
+			Inheritance:       windows.NO_INHERITANCE,
+			Trustee: windows.TRUSTEE{
+				TrusteeForm:  windows.TRUSTEE_IS_SID,
+				TrusteeValue: windows.TrusteeValueFromSID(sid),
+			},
+		})
+	}
+	acl, err := windows.ACLFromEntries(access, nil)
+	if err != nil {
+		return err
+	}
+	return windows.SetNamedSecurityInfo(filename, windows.SE_FILE_OBJECT,
+		windows.DACL_SECURITY_INFORMATION|windows.PROTECTED_DACL_SECURITY_INFORMATION, nil, nil, acl, nil)
+}
+
+// 检查私钥文件是否能被其他用户读取
+func CheckKeyFilePermission(filename string) error {
+	sd, err := windows.GetNamedSecurityInfo(filename, windows.SE_FILE_OBJECT, windows.DACL_SECURITY_INFORMATION)
+	if err != nil {
+		return err
+	}
+	dacl, _, err := sd.DACL()
+	if err != nil {
+		return err
+	}
+	if dacl == nil {
+		return fmt.Errorf("private key %s has no access control list, anyone can read it", filename)
+	}
+
+	var insecure []*windows.SID
+	for _, t := range insecureSids {
+		sid, err := windows.CreateWellKnownSid(t)
+		if err != nil {
+			return err
+		}
+		insecure = append(insecure, sid)
+	}
+
+	for i := uint32(0); i < uint32(dacl.AceCount); i++ {
+		var ace *windows.ACCESS_ALLOWED_ACE
+		if err := windows.GetAce(dacl, i, &ace); err != nil {
+			return err
+		}
+		if ace.Header.AceType != windows.ACCESS_ALLOWED_ACE_TYPE || ace.Mask&readAccess == 0 {
+			continue
+		}
+		sid := (*windows.SID)(unsafe.Pointer(&ace.SidStart))
+		for _, s := range insecure {
+			if sid.Equals(s) {
+				return fmt.Errorf("private key %s is readable by %s", filename, sid.String())
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,12 @@
+//go:build !windows
+
+package cert
+
+// 其他系统没有可以直接使用的数据保护接口
+func ProtectSecret(data []byte) ([]byte, error) {
+	return nil, ErrProtectUnsupported
+}
+
+func UnprotectSecret(data []byte) ([]byte, error) {
+	return nil, ErrProtectUnsupported
+}
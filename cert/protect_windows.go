@@ -0,0 +1,34 @@
+package cert
+
+import (
+	"bytes"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// 使用 DPAPI 加密，只有当前用户可以解密
+func ProtectSecret(data []byte) ([]byte, error) {
+	return cryptData(data, windows.CryptProtectData)
+}
+
+func UnprotectSecret(data []byte) ([]byte, error) {
+	return cryptData(data, func(in *windows.DataBlob, _ *uint16, entropy *windows.DataBlob, reserved uintptr, prompt *windows.CryptProtectPromptStruct, flags uint32, out *windows.DataBlob) error {
+		return windows.CryptUnprotectData(in, nil, entropy, reserved, prompt, flags, out)
+	})
+}
+
+type cryptFunc func(in *windows.DataBlob, name *uint16, entropy *windows.DataBlob, reserved uintptr, prompt *windows.CryptProtectPromptStruct, flags uint32, out *windows.DataBlob) error
+
+func cryptData(data []byte, fn cryptFunc) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	in := windows.DataBlob{Size: uint32(len(data)), Data: &data[0]}
+	var out windows.DataBlob
+	if err := fn(&in, nil, nil, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &out); err != nil {
+		return nil, err
+	}
+	defer windows.LocalFree(windows.Handle(unsafe.Pointer(out.Data)))
+	return bytes.Clone(unsafe.Slice(out.Data, out.Size)), nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/dreamsxin/go-netsniffer/storage"
+)
+
+// 命令行导出、导入会话，不启动界面，会话目录按 config.json 设置
+//
+//	go-netsniffer sessions
+//	go-netsniffer export <会话名称> <归档文件>
+//	go-netsniffer import <归档文件> [会话名称]
+var commands = map[string]func(a *App, args []string) error{
+	"sessions": listSessionsCommand,
+	"export":   exportCommand,
+	"import":   importCommand,
+}
+
+var errUsage = errors.New("用法: go-netsniffer sessions | export <会话名称> <归档文件> | import <归档文件> [会话名称]")
+
+func runCommand(command string, args []string) error {
+	var a App
+	a.loadConfig()
+	return commands[command](&a, args)
+}
+
+func listSessionsCommand(a *App, args []string) error {
+	dir, err := storage.SessionDir(a.config.Session.Dir)
+	if err != nil {
+		return err
+	}
+	list, err := storage.ListSessions(dir)
+	if err != nil {
+		return err
+	}
+	for _, s := range list {
+		fmt.Printf("%s\t%d\t%s\n", s.Name, s.Size, s.ModTime.Format("2006-01-02 15:04:05"))
+	}
+	return nil
+}
+
+func exportCommand(a *App, args []string) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+	manifest, err := a.exportSession(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	fmt.Printf("已导出 %d 个 HTTP 数据包，%d 个 IP 数据包，%d 个内容\n", manifest.HTTPPackets, manifest.IPPackets, manifest.Bodies)
+	return nil
+}
+
+func importCommand(a *App, args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return errUsage
+	}
+	var name string
+	if len(args) == 2 {
+		name = args[1]
+	}
+	name, err := a.importSession(args[0], name)
+	if err != nil {
+		return err
+	}
+	fmt.Println("已导入会话", name)
+	return nil
+}
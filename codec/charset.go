@@ -0,0 +1,59 @@
+package codec
+
+import (
+	"io"
+	"mime"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/transform"
+)
+
+// Content-Type 中声明的非 UTF-8 字符集，如 GBK、Shift_JIS、ISO-8859-1，未声明、无法识别或为 UTF-8 时返回 nil
+func Charset(contentType string) encoding.Encoding {
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil
+	}
+	name := strings.ToLower(strings.TrimSpace(params["charset"]))
+	if name == "" || name == "utf-8" || name == "utf8" {
+		return nil
+	}
+	enc, err := htmlindex.Get(name)
+	if err != nil {
+		return nil
+	}
+	if canonical, _ := htmlindex.Name(enc); canonical == "utf-8" {
+		return nil
+	}
+	return enc
+}
+
+// 按 Content-Type 中声明的字符集转换为 UTF-8
+func ToUTF8(r io.Reader, contentType string) io.Reader {
+	enc := Charset(contentType)
+	if enc == nil {
+		return r
+	}
+	return transform.NewReader(r, enc.NewDecoder())
+}
+
+// 内容是否需要解码或转换字符集才能显示
+func NeedsDecode(contentEncoding, contentType string) bool {
+	return len(Encodings(contentEncoding)) > 0 || Charset(contentType) != nil
+}
+
+// 解码并转换为 UTF-8
+func Decode(r io.Reader, contentEncoding, contentType string) (io.ReadCloser, error) {
+	dr, err := NewReader(r, contentEncoding)
+	if err != nil {
+		return nil, err
+	}
+	return readCloser{ToUTF8(dr, contentType), dr}, nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
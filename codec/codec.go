@@ -0,0 +1,127 @@
+// Package codec 按 Content-Encoding 解码请求和响应内容，并把声明的字符集转换为 UTF-8
+package codec
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/valyala/gozstd"
+)
+
+var ErrUnsupported = errors.New("unsupported content encoding")
+
+// Decoder 解码一种 Content-Encoding，返回的 Reader 关闭时释放资源
+type Decoder func(r io.Reader) (io.ReadCloser, error)
+
+var (
+	lock     sync.RWMutex
+	decoders = make(map[string]Decoder)
+)
+
+// 注册解码器，名称不区分大小写，已有的同名解码器被替换
+func Register(name string, decoder Decoder) {
+	lock.Lock()
+	defer lock.Unlock()
+	decoders[strings.ToLower(name)] = decoder
+}
+
+func Lookup(name string) (Decoder, bool) {
+	lock.RLock()
+	defer lock.RUnlock()
+	decoder, ok := decoders[strings.ToLower(name)]
+	return decoder, ok
+}
+
+func init() {
+	Register("gzip", newGzip)
+	Register("x-gzip", newGzip)
+	Register("deflate", newDeflate)
+	Register("br", func(r io.Reader) (io.ReadCloser, error) {
+		return io.NopCloser(brotli.NewReader(r)), nil
+	})
+	Register("zstd", func(r io.Reader) (io.ReadCloser, error) {
+		return &zstdReader{gozstd.NewReader(r)}, nil
+	})
+}
+
+func newGzip(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+// HTTP 的 deflate 应为 zlib 格式，部分服务器发送不带 zlib 头的原始 deflate 数据
+func newDeflate(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	head, err := br.Peek(2)
+	if err != nil && len(head) < 2 {
+		return io.NopCloser(br), err
+	}
+	if head[0]&0x0f == 8 && (uint16(head[0])<<8|uint16(head[1]))%31 == 0 {
+		return zlib.NewReader(br)
+	}
+	return flate.NewReader(br), nil
+}
+
+type zstdReader struct {
+	*gozstd.Reader
+}
+
+func (z *zstdReader) Close() error {
+	z.Release()
+	return nil
+}
+
+// 解析 Content-Encoding，忽略 identity
+func Encodings(contentEncoding string) []string {
+	var names []string
+	for _, name := range strings.Split(contentEncoding, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != "" && name != "identity" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// 按 Content-Encoding 逐层解码，多个编码按应用的相反顺序解码，如 "gzip, br" 先解 br 再解 gzip
+func NewReader(r io.Reader, contentEncoding string) (io.ReadCloser, error) {
+	names := Encodings(contentEncoding)
+	chain := &chainReader{Reader: r}
+	for i := len(names) - 1; i >= 0; i-- {
+		decoder, ok := Lookup(names[i])
+		if !ok {
+			chain.Close()
+			return nil, fmt.Errorf("%w: %s", ErrUnsupported, names[i])
+		}
+		dr, err := decoder(chain.Reader)
+		if err != nil {
+			chain.Close()
+			return nil, fmt.Errorf("%s 解码失败: %w", names[i], err)
+		}
+		chain.Reader = dr
+		chain.closers = append(chain.closers, dr)
+	}
+	return chain, nil
+}
+
+// chainReader 关闭时从外到内释放每一层解码器
+type chainReader struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (c *chainReader) Close() error {
+	var errs []error
+	for i := len(c.closers) - 1; i >= 0; i-- {
+		errs = append(errs, c.closers[i].Close())
+	}
+	c.closers = nil
+	return errors.Join(errs...)
+}
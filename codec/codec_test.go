@@ -0,0 +1,83 @@
+package codec
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+func compress(t *testing.T, name string, data []byte) []byte {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch name {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "br":
+		w = brotli.NewWriter(&buf)
+	case "zlib":
+		w = zlib.NewWriter(&buf)
+	case "flate":
+		w, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	return buf.Bytes()
+}
+
+func encode(t *testing.T, enc encoding.Encoding, s string) []byte {
+	data, err := enc.NewEncoder().Bytes([]byte(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestDecode(t *testing.T) {
+	text := []byte("hello, 世界")
+	cases := []struct {
+		name            string
+		data            []byte
+		contentEncoding string
+		contentType     string
+		want            string
+	}{
+		{"identity", text, "identity", "text/plain", string(text)},
+		{"gzip", compress(t, "gzip", text), "gzip", "", string(text)},
+		{"stacked", compress(t, "br", compress(t, "gzip", text)), "gzip, br", "", string(text)},
+		{"zlib deflate", compress(t, "zlib", text), "deflate", "", string(text)},
+		{"raw deflate", compress(t, "flate", text), "Deflate", "", string(text)},
+		{"gbk", compress(t, "gzip", encode(t, simplifiedchinese.GBK, "你好")), "gzip", "text/html; charset=GBK", "你好"},
+		{"gb2312", encode(t, simplifiedchinese.GBK, "中文"), "", "text/plain; charset=gb2312", "中文"},
+		{"shift_jis", encode(t, japanese.ShiftJIS, "こんにちは"), "", "text/plain; charset=Shift_JIS", "こんにちは"},
+		{"latin1", encode(t, charmap.ISO8859_1, "café"), "", "text/plain; charset=iso-8859-1", "café"},
+		{"utf-8", text, "", "application/json; charset=utf-8", string(text)},
+	}
+	for _, c := range cases {
+		r, err := Decode(bytes.NewReader(c.data), c.contentEncoding, c.contentType)
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		got, err := io.ReadAll(r)
+		r.Close()
+		if err != nil || string(got) != c.want {
+			t.Errorf("%s: got %q %v, want %q", c.name, got, err, c.want)
+		}
+	}
+
+	if _, err := Decode(bytes.NewReader(text), "gzip, compress", ""); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("unsupported: %v", err)
+	}
+}
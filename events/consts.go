@@ -5,4 +5,5 @@ const (
 	EVENT_TYPE_REQUEST  = "request"
 	EVENT_TYPE_RESPONSE = "response"
 	EVENT_TYPE_ERROR    = "error"
+	EVENT_TYPE_NOTICE   = "notice"
 )
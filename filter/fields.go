@@ -0,0 +1,107 @@
+package filter
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/dreamsxin/go-netsniffer/models"
+)
+
+// field 可以过滤的字段，get 返回字段的文本和是否存在
+type field struct {
+	numeric  bool
+	keyed    bool   // 需要名称，如 header["content-type"]
+	column   string // http_packets 表中对应的列，可以在数据库中预筛选
+	fallback bool   // 列为空时 get 从 Header 中读取
+	get      func(p *models.HTTPPacket, key string) (string, bool)
+}
+
+// 设置对应的列
+func (f *field) in(column string) *field {
+	f.column = column
+	return f
+}
+
+func text(get func(p *models.HTTPPacket) string) *field {
+	return &field{get: func(p *models.HTTPPacket, _ string) (string, bool) {
+		return get(p), true
+	}}
+}
+
+func number(get func(p *models.HTTPPacket) int64) *field {
+	return &field{numeric: true, get: func(p *models.HTTPPacket, _ string) (string, bool) {
+		return strconv.FormatInt(get(p), 10), true
+	}}
+}
+
+// 只在 typ 类型的数据包中存在的 Header，resp.header 也匹配流式数据
+func header(types ...models.HTTPPacketType) *field {
+	return &field{keyed: true, get: func(p *models.HTTPPacket, key string) (string, bool) {
+		if len(types) > 0 && !hasType(types, p.HTTPPacketType) {
+			return "", false
+		}
+		values := p.Header.Values(key)
+		if len(values) == 0 {
+			return "", false
+		}
+		return values[0], true
+	}}
+}
+
+func hasType(types []models.HTTPPacketType, t models.HTTPPacketType) bool {
+	for _, typ := range types {
+		if typ == t {
+			return true
+		}
+	}
+	return false
+}
+
+var packetTypes = map[models.HTTPPacketType]string{
+	models.HTTPPacketType_REQUEST:  "request",
+	models.HTTPPacketType_RESPONSE: "response",
+	models.HTTPPacketType_STREAM:   "stream",
+}
+
+var fields = map[string]*field{
+	"id":     text(func(p *models.HTTPPacket) string { return p.ID }).in("id"),
+	"type":   text(func(p *models.HTTPPacket) string { return packetTypes[p.HTTPPacketType] }),
+	"method": text(func(p *models.HTTPPacket) string { return p.Method }).in("method"),
+	"host":   text(func(p *models.HTTPPacket) string { return p.Host }).in("host"),
+	"path":   text(func(p *models.HTTPPacket) string { return p.Path }),
+	"url":    text(func(p *models.HTTPPacket) string { return p.URL }).in("url"),
+	"proto":  text(func(p *models.HTTPPacket) string { return p.Proto }),
+	"content_type": &field{column: "content_type", fallback: true, get: func(p *models.HTTPPacket, _ string) (string, bool) {
+		if p.ContentType != "" {
+			return p.ContentType, true
+		}
+		return p.Header.Get("Content-Type"), true
+	}},
+	"mime":  text(func(p *models.HTTPPacket) string { return p.MIMEType }),
+	"body":  text(func(p *models.HTTPPacket) string { return p.Body }),
+	"event": text(func(p *models.HTTPPacket) string { return p.Event }),
+	"ja3": text(func(p *models.HTTPPacket) string {
+		if p.ClientTLS == nil {
+			return ""
+		}
+		return p.ClientTLS.JA3
+	}),
+	"ja4": text(func(p *models.HTTPPacket) string {
+		if p.ClientTLS == nil {
+			return ""
+		}
+		return p.ClientTLS.JA4
+	}),
+	"status": number(func(p *models.HTTPPacket) int64 { return int64(p.StatusCode) }).in("status"),
+	"size":   number(func(p *models.HTTPPacket) int64 { return p.BodySize }),
+	// 响应完成的时间，单位毫秒
+	"duration": number(func(p *models.HTTPPacket) int64 {
+		if p.Timing == nil {
+			return 0
+		}
+		return int64(p.Timing.Done / time.Millisecond)
+	}),
+	"header":      header(),
+	"req.header":  header(models.HTTPPacketType_REQUEST),
+	"resp.header": header(models.HTTPPacketType_RESPONSE, models.HTTPPacketType_STREAM),
+}
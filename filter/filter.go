@@ -0,0 +1,263 @@
+// Package filter 实现过滤 HTTP 数据包的表达式，例如
+//
+//	host ~ "api" && status >= 500 && method == POST && resp.header["content-type"] contains "json"
+//
+// 比较运算符：== != ~（正则匹配）!~ contains（不区分大小写）> >= < <=，
+// 逻辑运算符：&& and || or ! not 和括号，只写字段名时判断字段不为空。
+// 值可以是带引号的字符串、数字或不带引号的单词。
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/dreamsxin/go-netsniffer/models"
+)
+
+// Filter 编译后的表达式，可以在多个协程中使用
+type Filter struct {
+	src  string
+	root node
+}
+
+// 编译表达式，为空时返回 nil，nil 匹配所有数据包
+func Parse(src string) (*Filter, error) {
+	if strings.TrimSpace(src) == "" {
+		return nil, nil
+	}
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	root, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, &SyntaxError{tok.pos, fmt.Sprintf("多余的 %q", tok.text)}
+	}
+	return &Filter{src: src, root: root}, nil
+}
+
+func (f *Filter) Match(p *models.HTTPPacket) bool {
+	if f == nil {
+		return true
+	}
+	return f.root.eval(p)
+}
+
+func (f *Filter) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.src
+}
+
+type node interface {
+	eval(p *models.HTTPPacket) bool
+}
+
+type andNode struct{ left, right node }
+type orNode struct{ left, right node }
+type notNode struct{ expr node }
+
+func (n andNode) eval(p *models.HTTPPacket) bool { return n.left.eval(p) && n.right.eval(p) }
+func (n orNode) eval(p *models.HTTPPacket) bool  { return n.left.eval(p) || n.right.eval(p) }
+func (n notNode) eval(p *models.HTTPPacket) bool { return !n.expr.eval(p) }
+
+// compareNode 字段和值比较，没有运算符时判断字段不为空
+type compareNode struct {
+	field *field
+	key   string // header 的名称
+	op    string
+	str   string
+	num   float64
+	re    *regexp.Regexp
+}
+
+func (n *compareNode) eval(p *models.HTTPPacket) bool {
+	v, ok := n.field.get(p, n.key)
+	switch n.op {
+	case "":
+		return ok && v != "" && v != "0"
+	case "!=":
+		return !ok || v != n.str
+	case "!~":
+		return !ok || !n.re.MatchString(v)
+	}
+	if !ok {
+		return false
+	}
+	switch n.op {
+	case "==":
+		return v == n.str
+	case "~":
+		return n.re.MatchString(v)
+	case "contains":
+		return strings.Contains(strings.ToLower(v), n.str)
+	}
+	num, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return false
+	}
+	switch n.op {
+	case ">":
+		return num > n.num
+	case ">=":
+		return num >= n.num
+	case "<":
+		return num < n.num
+	case "<=":
+		return num <= n.num
+	}
+	return false
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// 运算符或关键字，关键字不区分大小写
+func (p *parser) accept(words ...string) bool {
+	tok := p.peek()
+	if tok.kind != tokOp && tok.kind != tokIdent {
+		return false
+	}
+	for _, w := range words {
+		if tok.kind == tokOp && tok.text == w || tok.kind == tokIdent && strings.EqualFold(tok.text, w) {
+			p.pos++
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) or() (node, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||", "or") {
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) and() (node, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&&", "and") {
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) unary() (node, error) {
+	if p.accept("!", "not") {
+		expr, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{expr}, nil
+	}
+	if p.accept("(") {
+		expr, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if tok := p.peek(); !p.accept(")") {
+			return nil, &SyntaxError{tok.pos, "缺少 )"}
+		}
+		return expr, nil
+	}
+	return p.compare()
+}
+
+func (p *parser) compare() (node, error) {
+	tok := p.next()
+	if tok.kind != tokIdent {
+		return nil, &SyntaxError{tok.pos, "需要字段名"}
+	}
+	f, ok := fields[strings.ToLower(tok.text)]
+	if !ok {
+		return nil, &SyntaxError{tok.pos, fmt.Sprintf("未知的字段 %s", tok.text)}
+	}
+	n := &compareNode{field: f}
+	if f.keyed {
+		if !p.accept("[") {
+			return nil, &SyntaxError{p.peek().pos, fmt.Sprintf("%s 需要名称，如 %s[\"content-type\"]", tok.text, tok.text)}
+		}
+		key := p.next()
+		if key.kind != tokString && key.kind != tokIdent {
+			return nil, &SyntaxError{key.pos, "需要名称"}
+		}
+		n.key = key.text
+		if end := p.peek(); !p.accept("]") {
+			return nil, &SyntaxError{end.pos, "缺少 ]"}
+		}
+	}
+
+	opTok := p.peek()
+	switch {
+	case p.accept("==", "!=", "~", "!~", ">", ">=", "<", "<="):
+		n.op = opTok.text
+	case p.accept("contains"):
+		n.op = "contains"
+	case p.accept("matches"):
+		n.op = "~"
+	default:
+		return n, nil
+	}
+
+	value := p.next()
+	if value.kind != tokString && value.kind != tokNumber && value.kind != tokIdent {
+		return nil, &SyntaxError{value.pos, "需要比较的值"}
+	}
+	n.str = value.text
+	switch n.op {
+	case "~", "!~":
+		re, err := regexp.Compile(n.str)
+		if err != nil {
+			return nil, &SyntaxError{value.pos, fmt.Sprintf("正则表达式无效: %s", err)}
+		}
+		n.re = re
+	case "contains":
+		n.str = strings.ToLower(n.str)
+	case ">", ">=", "<", "<=":
+		if !f.numeric {
+			return nil, &SyntaxError{opTok.pos, fmt.Sprintf("%s 不是数字字段，不能比较大小", tok.text)}
+		}
+		num, err := strconv.ParseFloat(n.str, 64)
+		if err != nil {
+			return nil, &SyntaxError{value.pos, fmt.Sprintf("%s 不是数字", n.str)}
+		}
+		n.num = num
+	}
+	return n, nil
+}
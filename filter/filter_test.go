@@ -0,0 +1,96 @@
+package filter
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/dreamsxin/go-netsniffer/models"
+)
+
+func TestFilter(t *testing.T) {
+	response := &models.HTTPPacket{
+		HTTPPacketType: models.HTTPPacketType_RESPONSE,
+		Method:         "POST",
+		Host:           "api.example.com",
+		StatusCode:     502,
+		Header:         http.Header{"Content-Type": {"application/JSON"}},
+	}
+	request := &models.HTTPPacket{Method: "GET", Host: "www.example.com", Header: http.Header{"Content-Type": {"text/json"}}}
+
+	cases := []struct {
+		expr              string
+		response, request bool
+	}{
+		{`host ~ "api" && status >= 500 && method == POST && resp.header["content-type"] contains "json"`, true, false},
+		{`resp.header["content-type"] contains json`, true, false},
+		{`header["Content-Type"] contains json`, true, true},
+		{`req.header["x-missing"] != "a"`, true, true},
+		{`not (status >= 500 or method == GET)`, false, false},
+		{`type == request || status == 502`, true, true},
+		{`status`, true, false},
+		{`host !~ "^api\\."`, false, true},
+		{`path`, false, false},
+	}
+	for _, c := range cases {
+		f, err := Parse(c.expr)
+		if err != nil {
+			t.Errorf("%s: %v", c.expr, err)
+			continue
+		}
+		if f.Match(response) != c.response || f.Match(request) != c.request {
+			t.Errorf("%s: got %v %v", c.expr, f.Match(response), f.Match(request))
+		}
+	}
+
+	if f, err := Parse(" "); f != nil || err != nil || !f.Match(request) {
+		t.Errorf("empty filter: %v %v", f, err)
+	}
+
+	for expr, pos := range map[string]int{
+		`host ==`:          8,
+		`hots == a`:        1,
+		`host > 1`:         6,
+		`(status == 1`:     13,
+		`host ~ "("`:       8,
+		`status == 1 host`: 13,
+		`host == "a`:       9,
+		`header == "a"`:    8,
+		`status >= 1 && $`: 16,
+	} {
+		_, err := Parse(expr)
+		var syntaxErr *SyntaxError
+		if !errors.As(err, &syntaxErr) || syntaxErr.Pos != pos {
+			t.Errorf("%s: got %v", expr, err)
+		}
+	}
+}
+
+func TestSQL(t *testing.T) {
+	cases := []struct {
+		expr  string
+		where string
+		args  int
+		exact bool
+	}{
+		{`host == "a" && path ~ "x"`, `host = ?`, 1, false},
+		{`status >= 500 || method == POST`, `(status >= ?) OR (method = ?)`, 2, true},
+		{`status >= 500 || path`, ``, 0, false},
+		{`not host contains api`, ``, 0, false},
+		{`not (host == a && method == GET)`, `NOT ((host = ?) AND (method = ?))`, 2, true},
+		{`content_type contains json`, `content_type = '' OR instr(lower(content_type), ?) > 0`, 1, false},
+		{`not content_type == "text/html"`, ``, 0, false},
+		{`host contains "例子"`, ``, 0, false},
+		{`status`, `CAST(status AS TEXT) != '' AND CAST(status AS TEXT) != '0'`, 0, true},
+	}
+	for _, c := range cases {
+		f, err := Parse(c.expr)
+		if err != nil {
+			t.Fatalf("%s: %v", c.expr, err)
+		}
+		where, args, exact := f.SQL()
+		if where != c.where || len(args) != c.args || exact != c.exact {
+			t.Errorf("%s: got %q %v %v", c.expr, where, args, exact)
+		}
+	}
+}
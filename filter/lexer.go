@@ -0,0 +1,106 @@
+package filter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokOp // 比较和逻辑运算符、括号
+)
+
+type token struct {
+	kind tokenKind
+	text string // 字符串为去掉引号和转义后的内容
+	pos  int    // 在表达式中的位置，从 1 开始，用于错误提示
+}
+
+// SyntaxError 表达式的语法错误
+type SyntaxError struct {
+	Pos int
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("过滤表达式第 %d 个字符: %s", e.Pos, e.Msg)
+}
+
+// 按长度从长到短匹配
+var operators = []string{"&&", "||", "==", "!=", "!~", ">=", "<=", "~", ">", "<", "!", "(", ")", "[", "]"}
+
+func lex(src string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '"' || c == '\'':
+			end := i + 1
+			for end < len(src) && src[end] != c {
+				if src[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(src) {
+				return nil, &SyntaxError{i + 1, "字符串没有结束"}
+			}
+			text := src[i+1 : end]
+			if c == '"' {
+				s, err := strconv.Unquote(src[i : end+1])
+				if err != nil {
+					return nil, &SyntaxError{i + 1, "字符串转义无效"}
+				}
+				text = s
+			}
+			tokens = append(tokens, token{tokString, text, i + 1})
+			i = end + 1
+		case c >= '0' && c <= '9':
+			end := i
+			for end < len(src) && (src[end] >= '0' && src[end] <= '9' || src[end] == '.') {
+				end++
+			}
+			tokens = append(tokens, token{tokNumber, src[i:end], i + 1})
+			i = end
+		case isIdentStart(rune(c)):
+			end := i
+			for end < len(src) && isIdentPart(rune(src[end])) {
+				end++
+			}
+			tokens = append(tokens, token{tokIdent, src[i:end], i + 1})
+			i = end
+		default:
+			op := ""
+			for _, o := range operators {
+				if strings.HasPrefix(src[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, &SyntaxError{i + 1, fmt.Sprintf("无效的字符 %q", c)}
+			}
+			tokens = append(tokens, token{tokOp, op, i + 1})
+			i += len(op)
+		}
+	}
+	return append(tokens, token{tokEOF, "", len(src) + 1}), nil
+}
+
+func isIdentStart(r rune) bool {
+	return r == '_' || r < unicode.MaxASCII && unicode.IsLetter(r)
+}
+
+// 标识符可以包含 . 和 -，如 req.header、application/json 需要加引号
+func isIdentPart(r rune) bool {
+	return isIdentStart(r) || r >= '0' && r <= '9' || r == '.' || r == '-'
+}
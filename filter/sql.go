@@ -0,0 +1,92 @@
+package filter
+
+// SQL 把表达式中可以用 http_packets 表的列判断的部分转换为 WHERE 条件，用于在数据库中预筛选，
+// exact 为 false 时满足条件的数据包仍然需要 Match，没有可以转换的部分时返回空字符串
+func (f *Filter) SQL() (where string, args []any, exact bool) {
+	if f == nil {
+		return "", nil, true
+	}
+	where, args, exact, ok := toSQL(f.root)
+	if !ok {
+		return "", nil, false
+	}
+	return where, args, exact
+}
+
+// exact 为条件和 eval 的结果完全相同，只有这样的条件可以取反
+func toSQL(n node) (where string, args []any, exact, ok bool) {
+	switch n := n.(type) {
+	case andNode:
+		lw, la, le, lok := toSQL(n.left)
+		rw, ra, re, rok := toSQL(n.right)
+		switch {
+		case lok && rok:
+			return "(" + lw + ") AND (" + rw + ")", append(la, ra...), le && re, true
+		case lok:
+			return lw, la, false, true
+		case rok:
+			return rw, ra, false, true
+		}
+	case orNode:
+		lw, la, le, lok := toSQL(n.left)
+		rw, ra, re, rok := toSQL(n.right)
+		if lok && rok {
+			return "(" + lw + ") OR (" + rw + ")", append(la, ra...), le && re, true
+		}
+	case notNode:
+		w, a, e, ok := toSQL(n.expr)
+		if ok && e {
+			return "NOT (" + w + ")", a, true, true
+		}
+	case *compareNode:
+		return n.sql()
+	}
+	return "", nil, false, false
+}
+
+func (n *compareNode) sql() (string, []any, bool, bool) {
+	col := n.field.column
+	if col == "" {
+		return "", nil, false, false
+	}
+	// 数字列按文本比较，和 eval 中 FormatInt 的结果一致
+	value := col
+	if n.field.numeric {
+		value = "CAST(" + col + " AS TEXT)"
+	}
+	var where string
+	var args []any
+	exact := true
+	switch n.op {
+	case "":
+		where = value + " != '' AND " + value + " != '0'"
+	case "==":
+		where, args = value+" = ?", []any{n.str}
+	case "!=":
+		where, args = value+" != ?", []any{n.str}
+	case "contains":
+		// SQLite 的 lower 只转换 ASCII 字母
+		if !isASCII(n.str) {
+			return "", nil, false, false
+		}
+		where, args, exact = "instr(lower("+col+"), ?) > 0", []any{n.str}, false
+	case ">", ">=", "<", "<=":
+		where, args = col+" "+n.op+" ?", []any{n.num}
+	default:
+		return "", nil, false, false
+	}
+	if n.field.fallback {
+		// 列为空时 eval 使用其他来源的值，这些数据包都需要 Match 判断
+		return col + " = '' OR " + where, args, false, true
+	}
+	return where, args, exact, true
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,253 @@
+package fingerprint
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	recordTypeHandshake  = 22
+	handshakeClientHello = 1
+	recordHeaderLen      = 5
+	handshakeHeaderLen   = 4
+	maxClientHelloLen    = 1 << 16
+	extServerName        = 0x0000
+	extSupportedGroups   = 0x000a
+	extECPointFormats    = 0x000b
+	extSignatureAlgs     = 0x000d
+	extALPN              = 0x0010
+	extSupportedVersions = 0x002b
+)
+
+var (
+	ErrNotClientHello = errors.New("not a TLS ClientHello")
+	ErrIncomplete     = errors.New("incomplete TLS ClientHello")
+)
+
+// ClientHello 中计算指纹需要的字段，保留客户端发送的顺序
+type ClientHello struct {
+	Version           uint16 // ClientHello 中的 legacy_version
+	SupportedVersions []uint16
+	CipherSuites      []uint16
+	Extensions        []uint16
+	SupportedGroups   []uint16
+	PointFormats      []uint8
+	SignatureAlgs     []uint16
+	ServerName        string
+	ALPN              []string
+}
+
+// 判断数据是否以 TLS 握手记录开头，用于在连接的第一个数据包中识别 ClientHello
+func IsClientHello(data []byte) bool {
+	return len(data) > recordHeaderLen && data[0] == recordTypeHandshake && data[1] == 3 && data[recordHeaderLen] == handshakeClientHello
+}
+
+// 从 TLS 记录中解析 ClientHello，ClientHello 可以分布在多个记录中
+func ParseRecords(data []byte) (*ClientHello, error) {
+	var msg []byte
+	for {
+		if len(data) < recordHeaderLen {
+			return nil, ErrIncomplete
+		}
+		if data[0] != recordTypeHandshake || data[1] != 3 {
+			return nil, ErrNotClientHello
+		}
+		n := int(binary.BigEndian.Uint16(data[3:5]))
+		if len(data) < recordHeaderLen+n {
+			return nil, ErrIncomplete
+		}
+		msg = append(msg, data[recordHeaderLen:recordHeaderLen+n]...)
+		data = data[recordHeaderLen+n:]
+
+		if len(msg) >= handshakeHeaderLen {
+			if msg[0] != handshakeClientHello {
+				return nil, ErrNotClientHello
+			}
+			size := int(msg[1])<<16 | int(msg[2])<<8 | int(msg[3])
+			if size > maxClientHelloLen {
+				return nil, ErrNotClientHello
+			}
+			if len(msg) >= handshakeHeaderLen+size {
+				return Parse(msg[:handshakeHeaderLen+size])
+			}
+		}
+	}
+}
+
+// 解析不带记录头的 ClientHello 握手消息
+func Parse(msg []byte) (*ClientHello, error) {
+	s := reader(msg)
+	typ, ok := s.u8()
+	if !ok || typ != handshakeClientHello {
+		return nil, ErrNotClientHello
+	}
+	body, ok := s.vec24()
+	if !ok {
+		return nil, ErrIncomplete
+	}
+
+	ch := &ClientHello{}
+	s = body
+	var random, sessionID, ciphers, compression reader
+	if ch.Version, ok = s.u16(); !ok {
+		return nil, ErrIncomplete
+	}
+	if random, ok = s.bytes(32); !ok || len(random) != 32 {
+		return nil, ErrIncomplete
+	}
+	if sessionID, ok = s.vec8(); !ok || len(sessionID) > 32 {
+		return nil, ErrNotClientHello
+	}
+	if ciphers, ok = s.vec16(); !ok || len(ciphers)%2 != 0 {
+		return nil, ErrNotClientHello
+	}
+	for len(ciphers) > 0 {
+		v, _ := ciphers.u16()
+		ch.CipherSuites = append(ch.CipherSuites, v)
+	}
+	if compression, ok = s.vec8(); !ok || len(compression) == 0 {
+		return nil, ErrNotClientHello
+	}
+	if len(s) == 0 {
+		// 没有扩展的旧客户端
+		return ch, nil
+	}
+
+	exts, ok := s.vec16()
+	if !ok {
+		return nil, ErrIncomplete
+	}
+	for len(exts) > 0 {
+		typ, ok := exts.u16()
+		if !ok {
+			return nil, ErrNotClientHello
+		}
+		data, ok := exts.vec16()
+		if !ok {
+			return nil, ErrNotClientHello
+		}
+		ch.Extensions = append(ch.Extensions, typ)
+		if err := ch.parseExtension(typ, data); err != nil {
+			return nil, err
+		}
+	}
+	return ch, nil
+}
+
+func (ch *ClientHello) parseExtension(typ uint16, data reader) error {
+	switch typ {
+	case extServerName:
+		list, ok := data.vec16()
+		for ok && len(list) > 0 {
+			var nameType uint8
+			var name reader
+			if nameType, ok = list.u8(); !ok {
+				break
+			}
+			if name, ok = list.vec16(); ok && nameType == 0 {
+				ch.ServerName = string(name)
+				break
+			}
+		}
+	case extSupportedGroups:
+		list, _ := data.vec16()
+		ch.SupportedGroups = list.u16s()
+	case extECPointFormats:
+		list, _ := data.vec8()
+		ch.PointFormats = []uint8(list)
+	case extSignatureAlgs:
+		list, _ := data.vec16()
+		ch.SignatureAlgs = list.u16s()
+	case extALPN:
+		list, _ := data.vec16()
+		for len(list) > 0 {
+			proto, ok := list.vec8()
+			if !ok {
+				return ErrNotClientHello
+			}
+			ch.ALPN = append(ch.ALPN, string(proto))
+		}
+	case extSupportedVersions:
+		list, _ := data.vec8()
+		ch.SupportedVersions = list.u16s()
+	}
+	return nil
+}
+
+// GREASE 值按 RFC 8701 不计入指纹
+func IsGREASE(v uint16) bool {
+	return v&0x0f0f == 0x0a0a && v>>8 == v&0xff
+}
+
+func withoutGREASE(values []uint16) []uint16 {
+	ret := make([]uint16, 0, len(values))
+	for _, v := range values {
+		if !IsGREASE(v) {
+			ret = append(ret, v)
+		}
+	}
+	return ret
+}
+
+type reader []byte
+
+func (r *reader) u8() (uint8, bool) {
+	if len(*r) < 1 {
+		return 0, false
+	}
+	v := (*r)[0]
+	*r = (*r)[1:]
+	return v, true
+}
+
+func (r *reader) u16() (uint16, bool) {
+	if len(*r) < 2 {
+		return 0, false
+	}
+	v := binary.BigEndian.Uint16(*r)
+	*r = (*r)[2:]
+	return v, true
+}
+
+func (r *reader) bytes(n int) (reader, bool) {
+	if len(*r) < n {
+		return nil, false
+	}
+	v := (*r)[:n]
+	*r = (*r)[n:]
+	return v, true
+}
+
+func (r *reader) vec8() (reader, bool) {
+	n, ok := r.u8()
+	if !ok {
+		return nil, false
+	}
+	return r.bytes(int(n))
+}
+
+func (r *reader) vec16() (reader, bool) {
+	n, ok := r.u16()
+	if !ok {
+		return nil, false
+	}
+	return r.bytes(int(n))
+}
+
+func (r *reader) vec24() (reader, bool) {
+	if len(*r) < 3 {
+		return nil, false
+	}
+	n := int((*r)[0])<<16 | int((*r)[1])<<8 | int((*r)[2])
+	*r = (*r)[3:]
+	return r.bytes(n)
+}
+
+func (r reader) u16s() []uint16 {
+	var ret []uint16
+	for len(r) >= 2 {
+		v, _ := r.u16()
+		ret = append(ret, v)
+	}
+	return ret
+}
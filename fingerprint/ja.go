@@ -0,0 +1,164 @@
+package fingerprint
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dreamsxin/go-netsniffer/models"
+)
+
+// JA3 原始字符串：版本,加密套件,扩展,椭圆曲线,点格式，去掉 GREASE 值
+func (ch *ClientHello) JA3Raw() string {
+	points := make([]uint16, len(ch.PointFormats))
+	for i, v := range ch.PointFormats {
+		points[i] = uint16(v)
+	}
+	return strings.Join([]string{
+		strconv.Itoa(int(ch.Version)),
+		joinDec(withoutGREASE(ch.CipherSuites)),
+		joinDec(withoutGREASE(ch.Extensions)),
+		joinDec(withoutGREASE(ch.SupportedGroups)),
+		joinDec(points),
+	}, ",")
+}
+
+// JA3 指纹，JA3 原始字符串的 MD5
+func (ch *ClientHello) JA3() string {
+	sum := md5.Sum([]byte(ch.JA3Raw()))
+	return hex.EncodeToString(sum[:])
+}
+
+// JA4 指纹，https://github.com/FoxIO-LLC/ja4
+func (ch *ClientHello) JA4() string {
+	a, b, c := ch.ja4Parts()
+	return a + "_" + truncatedHash(b) + "_" + truncatedHash(c)
+}
+
+// JA4 原始字符串（JA4_r），加密套件和扩展没有计算哈希
+func (ch *ClientHello) JA4Raw() string {
+	a, b, c := ch.ja4Parts()
+	return a + "_" + b + "_" + c
+}
+
+func (ch *ClientHello) ja4Parts() (string, string, string) {
+	ciphers := withoutGREASE(ch.CipherSuites)
+	exts := withoutGREASE(ch.Extensions)
+
+	sni := "i"
+	if ch.hasExtension(extServerName) {
+		sni = "d"
+	}
+	a := fmt.Sprintf("t%s%s%02d%02d%s", ch.ja4Version(), sni, min(len(ciphers), 99), min(len(exts), 99), ch.ja4ALPN())
+
+	sortedCiphers := append([]uint16(nil), ciphers...)
+	sort.Slice(sortedCiphers, func(i, j int) bool { return sortedCiphers[i] < sortedCiphers[j] })
+	b := joinHex(sortedCiphers)
+
+	// 扩展排序后计算，不包括 SNI 和 ALPN
+	var sortedExts []uint16
+	for _, v := range exts {
+		if v != extServerName && v != extALPN {
+			sortedExts = append(sortedExts, v)
+		}
+	}
+	sort.Slice(sortedExts, func(i, j int) bool { return sortedExts[i] < sortedExts[j] })
+	c := joinHex(sortedExts)
+	if sigs := withoutGREASE(ch.SignatureAlgs); len(sigs) > 0 {
+		c += "_" + joinHex(sigs)
+	}
+	return a, b, c
+}
+
+func (ch *ClientHello) hasExtension(typ uint16) bool {
+	for _, v := range ch.Extensions {
+		if v == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// supported_versions 中的最高版本，没有时使用 legacy_version
+func (ch *ClientHello) ja4Version() string {
+	version := ch.Version
+	if versions := withoutGREASE(ch.SupportedVersions); len(versions) > 0 {
+		version = 0
+		for _, v := range versions {
+			version = max(version, v)
+		}
+	}
+	switch version {
+	case 0x0304:
+		return "13"
+	case 0x0303:
+		return "12"
+	case 0x0302:
+		return "11"
+	case 0x0301:
+		return "10"
+	case 0x0300:
+		return "s3"
+	case 0x0002:
+		return "s2"
+	}
+	return "00"
+}
+
+// 第一个 ALPN 的首尾字符，不是字母或数字时使用十六进制的首尾字符
+func (ch *ClientHello) ja4ALPN() string {
+	if len(ch.ALPN) == 0 || ch.ALPN[0] == "" {
+		return "00"
+	}
+	proto := ch.ALPN[0]
+	first, last := proto[0], proto[len(proto)-1]
+	if isAlnum(first) && isAlnum(last) {
+		return string([]byte{first, last})
+	}
+	h := hex.EncodeToString([]byte(proto))
+	return string([]byte{h[0], h[len(h)-1]})
+}
+
+func isAlnum(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func truncatedHash(s string) string {
+	if s == "" {
+		return "000000000000"
+	}
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+func joinDec(values []uint16) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = strconv.Itoa(int(v))
+	}
+	return strings.Join(parts, "-")
+}
+
+func joinHex(values []uint16) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = fmt.Sprintf("%04x", v)
+	}
+	return strings.Join(parts, ",")
+}
+
+// 转换为保存在数据包中的指纹
+func (ch *ClientHello) Fingerprint() *models.ClientFingerprint {
+	return &models.ClientFingerprint{
+		JA3:        ch.JA3(),
+		JA3Raw:     ch.JA3Raw(),
+		JA4:        ch.JA4(),
+		JA4Raw:     ch.JA4Raw(),
+		ServerName: ch.ServerName,
+		ALPN:       ch.ALPN,
+	}
+}
@@ -0,0 +1,86 @@
+package fingerprint
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// 抓取 Go 客户端发送的 ClientHello
+func captureClientHello(t *testing.T) []byte {
+	client, server := net.Pipe()
+	go func() {
+		conn := tls.Client(client, &tls.Config{ServerName: "example.com", NextProtos: []string{"h2", "http/1.1"}})
+		conn.Handshake()
+	}()
+	defer server.Close()
+
+	header := make([]byte, recordHeaderLen)
+	if _, err := io.ReadFull(server, header); err != nil {
+		t.Fatalf("read record header failed: %s", err.Error())
+	}
+	body := make([]byte, int(header[3])<<8|int(header[4]))
+	if _, err := io.ReadFull(server, body); err != nil {
+		t.Fatalf("read record failed: %s", err.Error())
+	}
+	return append(header, body...)
+}
+
+func TestClientHello(t *testing.T) {
+	record := captureClientHello(t)
+	if !IsClientHello(record) {
+		t.Fatalf("IsClientHello failed")
+	}
+	ch, err := ParseRecords(record)
+	if err != nil {
+		t.Fatalf("ParseRecords failed: %s", err.Error())
+	}
+	if ch.ServerName != "example.com" || len(ch.ALPN) != 2 || ch.ALPN[0] != "h2" {
+		t.Errorf("unexpected ClientHello: %+v", ch)
+	}
+	if !strings.HasPrefix(ch.JA3Raw(), "771,") || len(ch.JA3()) != 32 {
+		t.Errorf("unexpected JA3: %s %s", ch.JA3Raw(), ch.JA3())
+	}
+	ja4 := ch.JA4()
+	if !strings.HasPrefix(ja4, "t13d") || !strings.HasPrefix(ja4[8:], "h2_") || len(ja4) != 36 {
+		t.Errorf("unexpected JA4: %s", ja4)
+	}
+
+	// 同一个 ClientHello 分成两个记录
+	msg := record[recordHeaderLen:]
+	split := []byte{recordTypeHandshake, 3, 1, 0, 10}
+	split = append(split, msg[:10]...)
+	split = append(split, recordTypeHandshake, 3, 1, byte((len(msg)-10)>>8), byte(len(msg)-10))
+	split = append(split, msg[10:]...)
+	ch2, err := ParseRecords(split)
+	if err != nil {
+		t.Fatalf("ParseRecords split failed: %s", err.Error())
+	}
+	if ch2.JA4() != ja4 || ch2.JA3() != ch.JA3() {
+		t.Errorf("split ClientHello fingerprint mismatch: %s %s", ch2.JA4(), ja4)
+	}
+
+	if _, err = ParseRecords(record[:len(record)-1]); err != ErrIncomplete {
+		t.Errorf("truncated ClientHello: %v", err)
+	}
+}
+
+func TestGREASE(t *testing.T) {
+	ch := &ClientHello{
+		Version:           0x0303,
+		SupportedVersions: []uint16{0x2a2a, 0x0304, 0x0303},
+		CipherSuites:      []uint16{0x0a0a, 0x1301, 0x1302},
+		Extensions:        []uint16{0x1a1a, extServerName, extALPN, extSupportedGroups, extSignatureAlgs},
+		SupportedGroups:   []uint16{0xfafa, 0x001d},
+		SignatureAlgs:     []uint16{0x0403, 0x0804},
+		ALPN:              []string{"http/1.1"},
+	}
+	if raw := ch.JA3Raw(); raw != "771,4865-4866,0-16-10-13,29," {
+		t.Errorf("unexpected JA3 raw: %s", raw)
+	}
+	if raw := ch.JA4Raw(); raw != "t13d0204h1_1301,1302_000a,000d_0403,0804" {
+		t.Errorf("unexpected JA4 raw: %s", raw)
+	}
+}
@@ -3,26 +3,68 @@
 import {events} from '../models';
 import {models} from '../models';
 
+export function ClearBodies():Promise<void>;
+
+export function DeleteSession(arg1:string):Promise<events.Event>;
+
 export function DisableProxy():Promise<events.Event>;
 
 export function EnableProxy():Promise<events.Event>;
 
+export function ExportCert(arg1:string,arg2:string):Promise<events.Event>;
+
+export function ExportSession(arg1:string,arg2:string):Promise<events.Event>;
+
+export function FilterHTTPPackets(arg1:string,arg2:number,arg3:number):Promise<models.HTTPPacketPage>;
+
 export function FireErrorEvent(arg1:number,arg2:string):Promise<void>;
 
 export function FireEvent(arg1:number,arg2:string):Promise<void>;
 
+export function FireNoticeEvent(arg1:number,arg2:string):Promise<void>;
+
 export function GenerateCert():Promise<events.Event>;
 
+export function GetBody(arg1:string,arg2:string,arg3:number,arg4:number,arg5:string):Promise<models.BodyRange>;
+
 export function GetConfig():Promise<models.Config>;
 
 export function GetDevices():Promise<Array<models.Device>>;
 
+export function GetPipelineStats():Promise<models.PipelineStats>;
+
+export function ImportCert(arg1:string,arg2:string,arg3:string):Promise<events.Event>;
+
+export function ImportSession(arg1:string,arg2:string):Promise<string>;
+
+export function InspectCert():Promise<models.CertInfo>;
+
 export function InstallCert():Promise<events.Event>;
 
+export function ListSessions():Promise<Array<models.SessionInfo>>;
+
+export function NewSession():Promise<events.Event>;
+
+export function OpenSession(arg1:string):Promise<events.Event>;
+
+export function QueryHTTPPackets(arg1:number,arg2:number):Promise<models.HTTPPacketPage>;
+
+export function QueryIPPackets(arg1:number,arg2:number):Promise<models.IPPacketPage>;
+
+export function RotateCert(arg1:boolean,arg2:boolean):Promise<events.Event>;
+
 export function RunLoop():Promise<void>;
 
+export function SaveSession(arg1:string,arg2:boolean):Promise<events.Event>;
+
+export function Search(arg1:models.SearchOptions):Promise<Array<models.SearchResult>>;
+
+export function SetCertPassphrase(arg1:string,arg2:boolean):Promise<events.Event>;
+
 export function SetConfig(arg1:string,arg2:models.Config):Promise<void>;
 
+export function SetUpstreamPassword(arg1:string,arg2:string,arg3:boolean):Promise<events.Event>;
+
 export function StartIPCapture(arg1:string):Promise<void>;
 
 export function StartProxy():Promise<events.Event>;
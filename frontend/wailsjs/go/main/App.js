@@ -2,6 +2,14 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
 
+export function ClearBodies() {
+  return window['go']['main']['App']['ClearBodies']();
+}
+
+export function DeleteSession(arg1) {
+  return window['go']['main']['App']['DeleteSession'](arg1);
+}
+
 export function DisableProxy() {
   return window['go']['main']['App']['DisableProxy']();
 }
@@ -10,6 +18,18 @@ export function EnableProxy() {
   return window['go']['main']['App']['EnableProxy']();
 }
 
+export function ExportCert(arg1, arg2) {
+  return window['go']['main']['App']['ExportCert'](arg1, arg2);
+}
+
+export function ExportSession(arg1, arg2) {
+  return window['go']['main']['App']['ExportSession'](arg1, arg2);
+}
+
+export function FilterHTTPPackets(arg1, arg2, arg3) {
+  return window['go']['main']['App']['FilterHTTPPackets'](arg1, arg2, arg3);
+}
+
 export function FireErrorEvent(arg1, arg2) {
   return window['go']['main']['App']['FireErrorEvent'](arg1, arg2);
 }
@@ -18,10 +38,18 @@ export function FireEvent(arg1, arg2) {
   return window['go']['main']['App']['FireEvent'](arg1, arg2);
 }
 
+export function FireNoticeEvent(arg1, arg2) {
+  return window['go']['main']['App']['FireNoticeEvent'](arg1, arg2);
+}
+
 export function GenerateCert() {
   return window['go']['main']['App']['GenerateCert']();
 }
 
+export function GetBody(arg1, arg2, arg3, arg4, arg5) {
+  return window['go']['main']['App']['GetBody'](arg1, arg2, arg3, arg4, arg5);
+}
+
 export function GetConfig() {
   return window['go']['main']['App']['GetConfig']();
 }
@@ -30,18 +58,74 @@ export function GetDevices() {
   return window['go']['main']['App']['GetDevices']();
 }
 
+export function GetPipelineStats() {
+  return window['go']['main']['App']['GetPipelineStats']();
+}
+
+export function ImportCert(arg1, arg2, arg3) {
+  return window['go']['main']['App']['ImportCert'](arg1, arg2, arg3);
+}
+
+export function ImportSession(arg1, arg2) {
+  return window['go']['main']['App']['ImportSession'](arg1, arg2);
+}
+
+export function InspectCert() {
+  return window['go']['main']['App']['InspectCert']();
+}
+
 export function InstallCert() {
   return window['go']['main']['App']['InstallCert']();
 }
 
+export function ListSessions() {
+  return window['go']['main']['App']['ListSessions']();
+}
+
+export function NewSession() {
+  return window['go']['main']['App']['NewSession']();
+}
+
+export function OpenSession(arg1) {
+  return window['go']['main']['App']['OpenSession'](arg1);
+}
+
+export function QueryHTTPPackets(arg1, arg2) {
+  return window['go']['main']['App']['QueryHTTPPackets'](arg1, arg2);
+}
+
+export function QueryIPPackets(arg1, arg2) {
+  return window['go']['main']['App']['QueryIPPackets'](arg1, arg2);
+}
+
+export function RotateCert(arg1, arg2) {
+  return window['go']['main']['App']['RotateCert'](arg1, arg2);
+}
+
 export function RunLoop() {
   return window['go']['main']['App']['RunLoop']();
 }
 
+export function SaveSession(arg1, arg2) {
+  return window['go']['main']['App']['SaveSession'](arg1, arg2);
+}
+
+export function Search(arg1) {
+  return window['go']['main']['App']['Search'](arg1);
+}
+
+export function SetCertPassphrase(arg1, arg2) {
+  return window['go']['main']['App']['SetCertPassphrase'](arg1, arg2);
+}
+
 export function SetConfig(arg1, arg2) {
   return window['go']['main']['App']['SetConfig'](arg1, arg2);
 }
 
+export function SetUpstreamPassword(arg1, arg2, arg3) {
+  return window['go']['main']['App']['SetUpstreamPassword'](arg1, arg2, arg3);
+}
+
 export function StartIPCapture(arg1) {
   return window['go']['main']['App']['StartIPCapture'](arg1);
 }
@@ -39,6 +39,244 @@ export namespace models {
 	        this.P2P = source["P2P"];
 	    }
 	}
+	export class Body {
+	    MemoryLimit: number;
+	    TotalMemory: number;
+	    MaxSize: number;
+	    TotalDisk: number;
+	    Dir: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new Body(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.MemoryLimit = source["MemoryLimit"];
+	        this.TotalMemory = source["TotalMemory"];
+	        this.MaxSize = source["MaxSize"];
+	        this.TotalDisk = source["TotalDisk"];
+	        this.Dir = source["Dir"];
+	    }
+	}
+	export class BodyField {
+	    Path: string;
+	    Value: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new BodyField(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.Path = source["Path"];
+	        this.Value = source["Value"];
+	    }
+	}
+	export class BodyPart {
+	    Name: string;
+	    FileName?: string;
+	    ContentType?: string;
+	    Header?: {[key: string]: string[]};
+	    Size: number;
+	    Value?: string;
+	    Stored?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new BodyPart(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.Name = source["Name"];
+	        this.FileName = source["FileName"];
+	        this.ContentType = source["ContentType"];
+	        this.Header = source["Header"];
+	        this.Size = source["Size"];
+	        this.Value = source["Value"];
+	        this.Stored = source["Stored"];
+	    }
+	}
+	export class BodyRange {
+	    ID: string;
+	    Part: string;
+	    Offset: number;
+	    Encoding: string;
+	    Data: string;
+	    ContentType: string;
+	    Size: number;
+	    Total: number;
+	    Truncated: boolean;
+	    Done: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new BodyRange(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.ID = source["ID"];
+	        this.Part = source["Part"];
+	        this.Offset = source["Offset"];
+	        this.Encoding = source["Encoding"];
+	        this.Data = source["Data"];
+	        this.ContentType = source["ContentType"];
+	        this.Size = source["Size"];
+	        this.Total = source["Total"];
+	        this.Truncated = source["Truncated"];
+	        this.Done = source["Done"];
+	    }
+	}
+	export class Capture {
+	    Include: string[];
+	    Exclude: string[];
+	    ContentTypes: string[];
+	    SkipStatic: boolean;
+	    MaxBodySize: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new Capture(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.Include = source["Include"];
+	        this.Exclude = source["Exclude"];
+	        this.ContentTypes = source["ContentTypes"];
+	        this.SkipStatic = source["SkipStatic"];
+	        this.MaxBodySize = source["MaxBodySize"];
+	    }
+	}
+	export class Cert {
+	    Dir: string;
+	    KeyType: string;
+	    LeafKeyType: string;
+	    WarnDays: number;
+	    LeafCache: boolean;
+	    Intermediate: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new Cert(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.Dir = source["Dir"];
+	        this.KeyType = source["KeyType"];
+	        this.LeafKeyType = source["LeafKeyType"];
+	        this.WarnDays = source["WarnDays"];
+	        this.LeafCache = source["LeafCache"];
+	        this.Intermediate = source["Intermediate"];
+	    }
+	}
+	export class CertInfo {
+	    Path: string;
+	    Subject: string;
+	    Issuer: string;
+	    SerialNumber: string;
+	    Fingerprint: string;
+	    Thumbprint: string;
+	    KeyType: string;
+	    // Go type: time
+	    NotBefore: any;
+	    // Go type: time
+	    NotAfter: any;
+	    DaysLeft: number;
+	    Installed: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new CertInfo(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.Path = source["Path"];
+	        this.Subject = source["Subject"];
+	        this.Issuer = source["Issuer"];
+	        this.SerialNumber = source["SerialNumber"];
+	        this.Fingerprint = source["Fingerprint"];
+	        this.Thumbprint = source["Thumbprint"];
+	        this.KeyType = source["KeyType"];
+	        this.NotBefore = this.convertValues(source["NotBefore"], null);
+	        this.NotAfter = this.convertValues(source["NotAfter"], null);
+	        this.DaysLeft = source["DaysLeft"];
+	        this.Installed = source["Installed"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class ClientFingerprint {
+	    JA3: string;
+	    JA3Raw?: string;
+	    JA4: string;
+	    JA4Raw?: string;
+	    ServerName?: string;
+	    ALPN?: string[];
+	
+	    static createFrom(source: any = {}) {
+	        return new ClientFingerprint(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.JA3 = source["JA3"];
+	        this.JA3Raw = source["JA3Raw"];
+	        this.JA4 = source["JA4"];
+	        this.JA4Raw = source["JA4Raw"];
+	        this.ServerName = source["ServerName"];
+	        this.ALPN = source["ALPN"];
+	    }
+	}
+	export class Session {
+	    Dir: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new Session(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.Dir = source["Dir"];
+	    }
+	}
+	export class Upstream {
+	    Host: string;
+	    InsecureSkipVerify: boolean;
+	    Pins: string[];
+	    CAFiles: string[];
+	    ClientCert: string;
+	    ClientKey: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new Upstream(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.Host = source["Host"];
+	        this.InsecureSkipVerify = source["InsecureSkipVerify"];
+	        this.Pins = source["Pins"];
+	        this.CAFiles = source["CAFiles"];
+	        this.ClientCert = source["ClientCert"];
+	        this.ClientKey = source["ClientKey"];
+	    }
+	}
 	export class IP {
 	    Status: number;
 	    Device: string;
@@ -46,6 +284,7 @@ export namespace models {
 	    Promisc: boolean;
 	    Timeout: number;
 	    Filter: string;
+	    KeyLogFile: string;
 	
 	    static createFrom(source: any = {}) {
 	        return new IP(source);
@@ -59,15 +298,35 @@ export namespace models {
 	        this.Promisc = source["Promisc"];
 	        this.Timeout = source["Timeout"];
 	        this.Filter = source["Filter"];
+	        this.KeyLogFile = source["KeyLogFile"];
+	    }
+	}
+	export class PAC {
+	    Enable: boolean;
+	    Include: string[];
+	    Exclude: string[];
+	
+	    static createFrom(source: any = {}) {
+	        return new PAC(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.Enable = source["Enable"];
+	        this.Include = source["Include"];
+	        this.Exclude = source["Exclude"];
 	    }
 	}
 	export class HTTP {
 	    Status: number;
 	    Port: number;
+	    AllowLAN: boolean;
 	    AutoProxy: boolean;
 	    SaveLogFile: boolean;
 	    Filter: boolean;
-	    FilterHost: string;
+	    FilterQuery: string;
+	    KeyLogFile: string;
+	    PAC: PAC;
 	
 	    static createFrom(source: any = {}) {
 	        return new HTTP(source);
@@ -77,15 +336,41 @@ export namespace models {
 	        if ('string' === typeof source) source = JSON.parse(source);
 	        this.Status = source["Status"];
 	        this.Port = source["Port"];
+	        this.AllowLAN = source["AllowLAN"];
 	        this.AutoProxy = source["AutoProxy"];
 	        this.SaveLogFile = source["SaveLogFile"];
 	        this.Filter = source["Filter"];
-	        this.FilterHost = source["FilterHost"];
+	        this.FilterQuery = source["FilterQuery"];
+	        this.KeyLogFile = source["KeyLogFile"];
+	        this.PAC = this.convertValues(source["PAC"], PAC);
 	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
 	}
 	export class Config {
 	    HTTP: HTTP;
 	    IP: IP;
+	    Cert: Cert;
+	    Upstream: Upstream[];
+	    Body: Body;
+	    Session: Session;
+	    Capture: Capture;
 	
 	    static createFrom(source: any = {}) {
 	        return new Config(source);
@@ -95,6 +380,11 @@ export namespace models {
 	        if ('string' === typeof source) source = JSON.parse(source);
 	        this.HTTP = this.convertValues(source["HTTP"], HTTP);
 	        this.IP = this.convertValues(source["IP"], IP);
+	        this.Cert = this.convertValues(source["Cert"], Cert);
+	        this.Upstream = this.convertValues(source["Upstream"], Upstream);
+	        this.Body = this.convertValues(source["Body"], Body);
+	        this.Session = this.convertValues(source["Session"], Session);
+	        this.Capture = this.convertValues(source["Capture"], Capture);
 	    }
 	
 		convertValues(a: any, classs: any, asMap: boolean = false): any {
@@ -151,6 +441,556 @@ export namespace models {
 		    return a;
 		}
 	}
+	export class GraphQL {
+	    OperationType: string;
+	    OperationName?: string;
+	    Query: string;
+	    Variables?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new GraphQL(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.OperationType = source["OperationType"];
+	        this.OperationName = source["OperationName"];
+	        this.Query = source["Query"];
+	        this.Variables = source["Variables"];
+	    }
+	}
+	
+	export class TLSInfo {
+	    ServerName: string;
+	    Version?: string;
+	    CipherSuite?: string;
+	    ALPN?: string;
+	    Certificates: CertInfo[];
+	    Verified: boolean;
+	    VerifyMode?: string;
+	    VerifyError?: string;
+	    HandshakeErr?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new TLSInfo(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.ServerName = source["ServerName"];
+	        this.Version = source["Version"];
+	        this.CipherSuite = source["CipherSuite"];
+	        this.ALPN = source["ALPN"];
+	        this.Certificates = this.convertValues(source["Certificates"], CertInfo);
+	        this.Verified = source["Verified"];
+	        this.VerifyMode = source["VerifyMode"];
+	        this.VerifyError = source["VerifyError"];
+	        this.HandshakeErr = source["HandshakeErr"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class Timing {
+	    // Go type: time
+	    Start: any;
+	    DNSStart?: number;
+	    DNSDone?: number;
+	    ConnectStart?: number;
+	    ConnectDone?: number;
+	    TLSStart?: number;
+	    TLSDone?: number;
+	    GotConn?: number;
+	    Reused?: boolean;
+	    RequestSent?: number;
+	    FirstByte?: number;
+	    Done?: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new Timing(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.Start = this.convertValues(source["Start"], null);
+	        this.DNSStart = source["DNSStart"];
+	        this.DNSDone = source["DNSDone"];
+	        this.ConnectStart = source["ConnectStart"];
+	        this.ConnectDone = source["ConnectDone"];
+	        this.TLSStart = source["TLSStart"];
+	        this.TLSDone = source["TLSDone"];
+	        this.GotConn = source["GotConn"];
+	        this.Reused = source["Reused"];
+	        this.RequestSent = source["RequestSent"];
+	        this.FirstByte = source["FirstByte"];
+	        this.Done = source["Done"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class ParsedBody {
+	    Kind: string;
+	    Pretty?: string;
+	    Fields?: BodyField[];
+	    Parts?: BodyPart[];
+	    GraphQL?: GraphQL[];
+	    Truncated?: boolean;
+	    Error?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new ParsedBody(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.Kind = source["Kind"];
+	        this.Pretty = source["Pretty"];
+	        this.Fields = this.convertValues(source["Fields"], BodyField);
+	        this.Parts = this.convertValues(source["Parts"], BodyPart);
+	        this.GraphQL = this.convertValues(source["GraphQL"], GraphQL);
+	        this.Truncated = source["Truncated"];
+	        this.Error = source["Error"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class HTTPPacket {
+	    ID?: string;
+	    Date: string;
+	    // Go type: time
+	    DateTime: any;
+	    HTTPPacketType?: number;
+	    Proto?: string;
+	    ProtoMajor?: number;
+	    ProtoMinor?: number;
+	    Method?: string;
+	    Host?: string;
+	    Path?: string;
+	    URL?: string;
+	    Header?: {[key: string]: string[]};
+	    Body?: string;
+	    BodySize?: number;
+	    BodyTruncated?: boolean;
+	    MIMEType?: string;
+	    Parsed?: ParsedBody;
+	    Timing?: Timing;
+	    Status?: string;
+	    StatusCode?: number;
+	    ContentType?: string;
+	    ContentLength?: number;
+	    TLS?: TLSInfo;
+	    ClientTLS?: ClientFingerprint;
+	    Seq?: number;
+	    Event?: string;
+	    EventID?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new HTTPPacket(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.ID = source["ID"];
+	        this.Date = source["Date"];
+	        this.DateTime = this.convertValues(source["DateTime"], null);
+	        this.HTTPPacketType = source["HTTPPacketType"];
+	        this.Proto = source["Proto"];
+	        this.ProtoMajor = source["ProtoMajor"];
+	        this.ProtoMinor = source["ProtoMinor"];
+	        this.Method = source["Method"];
+	        this.Host = source["Host"];
+	        this.Path = source["Path"];
+	        this.URL = source["URL"];
+	        this.Header = source["Header"];
+	        this.Body = source["Body"];
+	        this.BodySize = source["BodySize"];
+	        this.BodyTruncated = source["BodyTruncated"];
+	        this.MIMEType = source["MIMEType"];
+	        this.Parsed = this.convertValues(source["Parsed"], ParsedBody);
+	        this.Timing = this.convertValues(source["Timing"], Timing);
+	        this.Status = source["Status"];
+	        this.StatusCode = source["StatusCode"];
+	        this.ContentType = source["ContentType"];
+	        this.ContentLength = source["ContentLength"];
+	        this.TLS = this.convertValues(source["TLS"], TLSInfo);
+	        this.ClientTLS = this.convertValues(source["ClientTLS"], ClientFingerprint);
+	        this.Seq = source["Seq"];
+	        this.Event = source["Event"];
+	        this.EventID = source["EventID"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class HTTPPacketPage {
+	    Total: number;
+	    Estimated: boolean;
+	    Offset: number;
+	    Packets: HTTPPacket[];
+	
+	    static createFrom(source: any = {}) {
+	        return new HTTPPacketPage(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.Total = source["Total"];
+	        this.Estimated = source["Estimated"];
+	        this.Offset = source["Offset"];
+	        this.Packets = this.convertValues(source["Packets"], HTTPPacket);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	
+	export class IPPacket {
+	    Date: string;
+	    // Go type: time
+	    DateTime: any;
+	    IPPacketType?: number;
+	    IPVersion?: number;
+	    EthernetType?: number;
+	    SrcMAC?: string;
+	    DstMAC?: string;
+	    Length?: number;
+	    EthernetPayload?: number[];
+	    SrcIP?: string;
+	    DstIP?: string;
+	    Protocol?: number;
+	    IPPayload?: number[];
+	    Seq?: number;
+	    SrcPort?: number;
+	    DstPort?: number;
+	    TCPPayload?: number[];
+	    UDPPayload?: number[];
+	    ApplicationLayer?: string;
+	    ApplicationPayload?: number[];
+	    ClientTLS?: ClientFingerprint;
+	
+	    static createFrom(source: any = {}) {
+	        return new IPPacket(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.Date = source["Date"];
+	        this.DateTime = this.convertValues(source["DateTime"], null);
+	        this.IPPacketType = source["IPPacketType"];
+	        this.IPVersion = source["IPVersion"];
+	        this.EthernetType = source["EthernetType"];
+	        this.SrcMAC = source["SrcMAC"];
+	        this.DstMAC = source["DstMAC"];
+	        this.Length = source["Length"];
+	        this.EthernetPayload = source["EthernetPayload"];
+	        this.SrcIP = source["SrcIP"];
+	        this.DstIP = source["DstIP"];
+	        this.Protocol = source["Protocol"];
+	        this.IPPayload = source["IPPayload"];
+	        this.Seq = source["Seq"];
+	        this.SrcPort = source["SrcPort"];
+	        this.DstPort = source["DstPort"];
+	        this.TCPPayload = source["TCPPayload"];
+	        this.UDPPayload = source["UDPPayload"];
+	        this.ApplicationLayer = source["ApplicationLayer"];
+	        this.ApplicationPayload = source["ApplicationPayload"];
+	        this.ClientTLS = this.convertValues(source["ClientTLS"], ClientFingerprint);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class IPPacketPage {
+	    Total: number;
+	    Offset: number;
+	    Packets: IPPacket[];
+	
+	    static createFrom(source: any = {}) {
+	        return new IPPacketPage(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.Total = source["Total"];
+	        this.Offset = source["Offset"];
+	        this.Packets = this.convertValues(source["Packets"], IPPacket);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	
+	
+	export class SourceStats {
+	    Published: number;
+	    Dropped: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new SourceStats(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.Published = source["Published"];
+	        this.Dropped = source["Dropped"];
+	    }
+	}
+	export class PipelineStats {
+	    Sources: {[key: string]: SourceStats};
+	    Queued: number;
+	    Capacity: number;
+	    UIDropped: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new PipelineStats(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.Sources = this.convertValues(source["Sources"], SourceStats, true);
+	        this.Queued = source["Queued"];
+	        this.Capacity = source["Capacity"];
+	        this.UIDropped = source["UIDropped"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class SearchOptions {
+	    Query: string;
+	    Regex: boolean;
+	    CaseSensitive: boolean;
+	    Limit: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new SearchOptions(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.Query = source["Query"];
+	        this.Regex = source["Regex"];
+	        this.CaseSensitive = source["CaseSensitive"];
+	        this.Limit = source["Limit"];
+	    }
+	}
+	export class SearchSnippet {
+	    Before: string;
+	    Match: string;
+	    After: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new SearchSnippet(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.Before = source["Before"];
+	        this.Match = source["Match"];
+	        this.After = source["After"];
+	    }
+	}
+	export class SearchResult {
+	    ID?: string;
+	    IPSeq?: number;
+	    Field: string;
+	    Count: number;
+	    Snippets: SearchSnippet[];
+	
+	    static createFrom(source: any = {}) {
+	        return new SearchResult(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.ID = source["ID"];
+	        this.IPSeq = source["IPSeq"];
+	        this.Field = source["Field"];
+	        this.Count = source["Count"];
+	        this.Snippets = this.convertValues(source["Snippets"], SearchSnippet);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	
+	
+	export class SessionInfo {
+	    Name: string;
+	    Size: number;
+	    // Go type: time
+	    ModTime: any;
+	    Current: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new SessionInfo(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.Name = source["Name"];
+	        this.Size = source["Size"];
+	        this.ModTime = this.convertValues(source["ModTime"], null);
+	        this.Current = source["Current"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	
+	
 	
 
 }
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+type CertInfo struct {
+	Path         string
+	Subject      string
+	Issuer       string
+	SerialNumber string
+	Fingerprint  string // SHA-256
+	Thumbprint   string // SHA-1，Windows 证书存储使用
+	KeyType      string
+	NotBefore    time.Time
+	NotAfter     time.Time
+	DaysLeft     int
+	Installed    bool // 是否已安装到系统受信任的根证书
+}
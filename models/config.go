@@ -3,10 +3,19 @@ package models
 type HTTP struct {
 	Status      int // 0 未启动 1 启动中 2 已启动
 	Port        int
+	AllowLAN    bool // 监听所有网卡，允许局域网内的手机等设备使用代理
 	AutoProxy   bool
 	SaveLogFile bool
-	Filter      bool
-	FilterHost  string
+	Filter      bool   // 按 FilterQuery 过滤显示的数据包
+	FilterQuery string // 过滤表达式，如 host ~ "api" && status >= 500，语法见 filter 包
+	KeyLogFile  string // 代理与客户端、上游服务器的 TLS 会话密钥以 NSS 格式写入的文件，为空时不记录
+	PAC         PAC
+}
+
+type PAC struct {
+	Enable  bool     // 系统代理使用 PAC 自动配置脚本，而不是固定的 ProxyServer
+	Include []string // 经过代理的主机，支持 *.example.com 通配，为空时全部经过代理
+	Exclude []string // 直连不经过代理的主机，优先于 Include
 }
 
 type IP struct {
@@ -16,9 +25,60 @@ type IP struct {
 	Promisc bool   // 是否将网口设置为混杂模式，如果设置成true，那么网卡会将所有的数据包都抓到
 	Timeout int64  // 设置抓到包返回的超时时间，单位为毫秒
 	Filter  string
+	// NSS 格式的 TLS 密钥日志文件，浏览器设置 SSLKEYLOGFILE 环境变量后写入
+	// 设置后重组 TCP 连接，解密 TLS 并解析其中的 HTTP 请求，明文 HTTP 也会解析
+	KeyLogFile string
+}
+
+type Cert struct {
+	Dir          string // 根证书存放目录，为空时使用用户配置目录
+	KeyType      string // 生成根证书使用的密钥类型 rsa、ecdsa 或 ed25519，为空时使用 rsa
+	LeafKeyType  string // 站点证书使用的密钥类型，ecdsa 签发更快
+	WarnDays     int    // 根证书过期前多少天开始提醒，为 0 时使用 30 天
+	LeafCache    bool   // 站点证书保存到证书目录，重启后继续使用
+	Intermediate bool   // 使用根证书签发的中级证书签发站点证书
+}
+
+// 按主机设置连接上游服务器时的 TLS 参数
+type Upstream struct {
+	Host               string   // 支持 *.example.com 通配，第一个匹配的设置生效
+	InsecureSkipVerify bool     // 不校验服务器证书
+	Pins               []string // 服务器证书链中任一证书的 SHA-256 指纹或 sha256/ 开头的公钥 Base64 指纹，设置后不再使用 CA 校验
+	CAFiles            []string // 额外信任的 CA 证书文件，PEM 格式
+	ClientCert         string   // 客户端证书，PEM 或 PKCS#12 文件
+	ClientKey          string   // 客户端证书私钥，PEM 格式，PKCS#12 时为空
+	ClientPassword     string   `json:"-"` // PKCS#12 或加密私钥的密码，不写入配置文件，通过 SetUpstreamPassword 设置
+}
+
+// 请求和响应内容的保存设置
+type Body struct {
+	MemoryLimit int64  // 单个内容保存在内存中的最大字节数，超过后写入临时文件，为 0 时使用 1MB
+	TotalMemory int64  // 所有内容占用内存的上限，超过后新数据写入临时文件，为 0 时使用 64MB
+	MaxSize     int64  // 单个内容最多保存的字节数，超出部分丢弃并标记为截断，为 0 时使用 64MB
+	TotalDisk   int64  // 所有临时文件占用磁盘的上限，超过后删除最久没有读取的已接收完成的内容，为 0 时使用 1GB
+	Dir         string // 临时文件目录，为空时使用系统临时目录
+}
+
+// 抓包会话保存设置，每次启动新建一个会话，数据包和内容在收到时写入会话文件
+type Session struct {
+	Dir string // 会话文件目录，为空时使用用户配置目录下的 sessions
+}
+
+// 抓取规则，在代理处理器之前判断，不记录的请求直接转发，不保存内容
+type Capture struct {
+	Include      []string // 记录的请求，主机或 主机/路径，支持 *.example.com 和路径中的 * 通配，为空时全部记录
+	Exclude      []string // 不记录的请求，优先于 Include
+	ContentTypes []string // 只记录 Header 不保存内容的类型前缀，如 image/、video/
+	SkipStatic   bool     // 不记录图片、脚本、样式、字体等静态资源
+	MaxBodySize  int64    // Content-Length 超过时只记录 Header，为 0 时不限制
 }
 
 type Config struct {
-	HTTP HTTP
-	IP   IP
+	HTTP     HTTP
+	IP       IP
+	Cert     Cert
+	Upstream []Upstream
+	Body     Body
+	Session  Session
+	Capture  Capture
 }
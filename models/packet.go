@@ -23,25 +23,37 @@ type HTTPPacketType int
 const (
 	HTTPPacketType_REQUEST  HTTPPacketType = iota
 	HTTPPacketType_RESPONSE HTTPPacketType = iota
+	HTTPPacketType_STREAM   HTTPPacketType = iota // 流式响应中到达的一个 SSE 事件或一段数据
 )
 
 type HTTPPacket struct {
+	ID             string `json:"ID,omitempty"` // 同一个请求的请求和响应 ID 相同，用于读取完整内容
 	Date           string
 	DateTime       time.Time
-	HTTPPacketType HTTPPacketType `json:"HTTPPacketType,omitempty"`
-	Proto          string         `json:"Proto,omitempty"`      // "HTTP/1.0"
-	ProtoMajor     int            `json:"ProtoMajor,omitempty"` // 1
-	ProtoMinor     int            `json:"ProtoMinor,omitempty"` // 0
-	Method         string         `json:"Method,omitempty"`
-	Host           string         `json:"Host,omitempty"`
-	Path           string         `json:"Path,omitempty"`
-	URL            string         `json:"URL,omitempty"`
-	Header         http.Header    `json:"Header,omitempty"`
-	Body           string         `json:"Body,omitempty"`
-	Status         string         `json:"Status,omitempty"`     // e.g. "200 OK"
-	StatusCode     int            `json:"StatusCode,omitempty"` // e.g. 200
-	ContentType    string         `json:"ContentType,omitempty"`
-	ContentLength  int64          `json:"ContentLength,omitempty"`
+	HTTPPacketType HTTPPacketType     `json:"HTTPPacketType,omitempty"`
+	Proto          string             `json:"Proto,omitempty"`      // "HTTP/1.0"
+	ProtoMajor     int                `json:"ProtoMajor,omitempty"` // 1
+	ProtoMinor     int                `json:"ProtoMinor,omitempty"` // 0
+	Method         string             `json:"Method,omitempty"`
+	Host           string             `json:"Host,omitempty"`
+	Path           string             `json:"Path,omitempty"`
+	URL            string             `json:"URL,omitempty"`
+	Header         http.Header        `json:"Header,omitempty"`
+	Body           string             `json:"Body,omitempty"`          // 内容较长时只有开头部分
+	BodySize       int64              `json:"BodySize,omitempty"`      // 已保存的内容长度，大于 Body 时可以按 ID 读取其余部分
+	BodyTruncated  bool               `json:"BodyTruncated,omitempty"` // 内容超过保存上限，只保存了开头部分
+	MIMEType       string             `json:"MIMEType,omitempty"`      // 按内容嗅探得到的类型，二进制内容按类型预览
+	Parsed         *ParsedBody        `json:"Parsed,omitempty"`        // 表单、JSON、XML 等内容解析后的字段
+	Timing         *Timing            `json:"Timing,omitempty"`        // 代理转发的请求各阶段的时间
+	Status         string             `json:"Status,omitempty"`        // e.g. "200 OK"
+	StatusCode     int                `json:"StatusCode,omitempty"`    // e.g. 200
+	ContentType    string             `json:"ContentType,omitempty"`
+	ContentLength  int64              `json:"ContentLength,omitempty"`
+	TLS            *TLSInfo           `json:"TLS,omitempty"`       // 上游 HTTPS 连接信息，只在响应中记录
+	ClientTLS      *ClientFingerprint `json:"ClientTLS,omitempty"` // 客户端 ClientHello 指纹，只有解密的 HTTPS 请求有
+	Seq            int                `json:"Seq,omitempty"`       // 流式数据在响应中的序号，从 1 开始
+	Event          string             `json:"Event,omitempty"`     // SSE 事件类型
+	EventID        string             `json:"EventID,omitempty"`   // SSE 事件 ID
 }
 
 type IPPacketType int
@@ -76,4 +88,81 @@ type IPPacket struct {
 	// Application
 	ApplicationLayer   string `json:"ApplicationLayer,omitempty"`
 	ApplicationPayload []byte `json:"ApplicationPayload,omitempty"`
+	// TLS
+	ClientTLS *ClientFingerprint `json:"ClientTLS,omitempty"` // 数据包是 ClientHello 时的客户端指纹
+}
+
+// 保存的请求或响应内容的状态
+type BodyInfo struct {
+	Size        int64 // 已保存的长度
+	Total       int64 // 实际收到的长度，截断时大于 Size
+	Truncated   bool
+	Done        bool   // 已经接收完成
+	OnDisk      bool   // 保存在临时文件中
+	ContentType string // 嗅探得到的 MIME 类型
+}
+
+// 按范围读取的请求或响应内容
+type BodyRange struct {
+	ID          string
+	Part        string // request、response 或 response-raw
+	Offset      int64
+	Encoding    string // Data 的编码，空为文本，base64 用于二进制内容
+	Data        string
+	ContentType string
+	Size        int64
+	Total       int64
+	Truncated   bool
+	Done        bool
+}
+
+// 按内容类型解析得到的结构化内容
+type ParsedBody struct {
+	Kind      string      // form、multipart、json、xml 或 graphql
+	Pretty    string      `json:"Pretty,omitempty"`    // 格式化后的 JSON 或 XML
+	Fields    []BodyField `json:"Fields,omitempty"`    // 按路径索引的字段，如 user.tags[0]、feed.entry[1].@id
+	Parts     []BodyPart  `json:"Parts,omitempty"`     // multipart 的各个部分
+	GraphQL   []GraphQL   `json:"GraphQL,omitempty"`   // 批量请求时有多个操作
+	Truncated bool        `json:"Truncated,omitempty"` // 内容较长，只解析了开头部分
+	Error     string      `json:"Error,omitempty"`
+}
+
+type BodyField struct {
+	Path  string
+	Value string
+}
+
+// multipart 中的一个部分，文件内容单独保存，按 Stored 读取
+type BodyPart struct {
+	Name        string
+	FileName    string      `json:"FileName,omitempty"`
+	ContentType string      `json:"ContentType,omitempty"`
+	Header      http.Header `json:"Header,omitempty"`
+	Size        int64
+	Value       string `json:"Value,omitempty"`  // 非文件部分的内容
+	Stored      string `json:"Stored,omitempty"` // 文件内容在 BodyStore 中的名称
+}
+
+// GraphQL 请求中的一个操作
+type GraphQL struct {
+	OperationType string // query、mutation 或 subscription
+	OperationName string `json:"OperationName,omitempty"`
+	Query         string
+	Variables     string `json:"Variables,omitempty"` // 格式化后的 JSON
+}
+
+// 一次请求各阶段的时间，除 Start 外为相对 Start 的纳秒数，没有发生的阶段为 0，复用连接时没有 DNS、连接和 TLS 阶段
+type Timing struct {
+	Start        time.Time     // 代理收到请求
+	DNSStart     time.Duration `json:"DNSStart,omitempty"`
+	DNSDone      time.Duration `json:"DNSDone,omitempty"`
+	ConnectStart time.Duration `json:"ConnectStart,omitempty"` // 开始 TCP 连接
+	ConnectDone  time.Duration `json:"ConnectDone,omitempty"`
+	TLSStart     time.Duration `json:"TLSStart,omitempty"`
+	TLSDone      time.Duration `json:"TLSDone,omitempty"`
+	GotConn      time.Duration `json:"GotConn,omitempty"` // 得到可用的上游连接
+	Reused       bool          `json:"Reused,omitempty"`
+	RequestSent  time.Duration `json:"RequestSent,omitempty"` // 请求发送完成
+	FirstByte    time.Duration `json:"FirstByte,omitempty"`   // 收到响应的第一个字节
+	Done         time.Duration `json:"Done,omitempty"`        // 响应内容转发完成
 }
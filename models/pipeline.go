@@ -0,0 +1,15 @@
+package models
+
+// 每个来源发送的数据包数量，队列已满或已关闭时丢弃
+type SourceStats struct {
+	Published uint64
+	Dropped   uint64
+}
+
+// 数据包队列的统计
+type PipelineStats struct {
+	Sources   map[string]SourceStats // 按来源统计，proxy、capture、decoder
+	Queued    int                    // 队列中等待保存的数量
+	Capacity  int
+	UIDropped uint64 // 界面来不及显示而丢弃的数量，已保存到会话中，可以重新读取
+}
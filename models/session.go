@@ -0,0 +1,62 @@
+package models
+
+import "time"
+
+// 保存在会话目录中的抓包会话
+type SessionInfo struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
+	Current bool // 正在记录的会话
+}
+
+// 按顺序分页读取的 HTTP 数据包
+type HTTPPacketPage struct {
+	Total     int64 // 会话中的数据包总数
+	Estimated bool  // 按条件读取时没有扫描到最后，Total 只表示之后还有匹配的数据包
+	Offset    int
+	Packets   []HTTPPacket
+}
+
+// 按顺序分页读取的 IP 数据包
+type IPPacketPage struct {
+	Total   int64
+	Offset  int
+	Packets []IPPacket
+}
+
+// 会话归档中的 manifest.json
+type SessionManifest struct {
+	Format      string // 固定为 go-netsniffer-session
+	Version     int    // 格式不兼容时增加，新增字段不改变版本
+	Created     time.Time
+	Name        string
+	HTTPPackets int64
+	IPPackets   int64
+	Bodies      int64
+	PCAPNG      bool `json:"PCAPNG,omitempty"` // 包含由 IP 数据包生成的 capture.pcapng
+}
+
+// 全文搜索的条件
+type SearchOptions struct {
+	Query         string
+	Regex         bool // Query 为正则表达式
+	CaseSensitive bool
+	Limit         int // 最多返回的结果数，为 0 时使用 100
+}
+
+// 一个请求或 IP 数据包中匹配的字段
+type SearchResult struct {
+	ID       string `json:"ID,omitempty"`    // HTTP 请求的 ID
+	IPSeq    int64  `json:"IPSeq,omitempty"` // IP 数据包在会话中的序号，从 1 开始
+	Field    string // url、request.header、response.header、request、response 或 payload
+	Count    int    // 匹配的次数
+	Snippets []SearchSnippet
+}
+
+// 匹配的内容和前后的文字，用于高亮显示
+type SearchSnippet struct {
+	Before string
+	Match  string
+	After  string
+}
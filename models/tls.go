@@ -0,0 +1,24 @@
+package models
+
+// 上游服务器的 TLS 连接信息
+type TLSInfo struct {
+	ServerName   string
+	Version      string     `json:"Version,omitempty"`     // e.g. "TLS 1.3"
+	CipherSuite  string     `json:"CipherSuite,omitempty"` // e.g. "TLS_AES_128_GCM_SHA256"
+	ALPN         string     `json:"ALPN,omitempty"`
+	Certificates []CertInfo // 服务器发送的证书链，第一个是站点证书
+	Verified     bool       // 证书链是否通过校验，跳过校验的连接使用上游设置的根证书重新校验
+	VerifyMode   string     `json:"VerifyMode,omitempty"` // 没有按 CA 校验时为 pinned（证书固定）或 skipped（跳过校验）
+	VerifyError  string     `json:"VerifyError,omitempty"`
+	HandshakeErr string     `json:"HandshakeErr,omitempty"` // 握手失败的原因，握手失败时没有版本和加密套件
+}
+
+// 客户端 ClientHello 指纹，用于识别发起请求的浏览器或客户端库
+type ClientFingerprint struct {
+	JA3        string
+	JA3Raw     string `json:"JA3Raw,omitempty"`
+	JA4        string
+	JA4Raw     string   `json:"JA4Raw,omitempty"`
+	ServerName string   `json:"ServerName,omitempty"`
+	ALPN       []string `json:"ALPN,omitempty"`
+}
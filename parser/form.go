@@ -0,0 +1,105 @@
+package parser
+
+import (
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/dreamsxin/go-netsniffer/models"
+)
+
+func parseForm(r io.Reader) *models.ParsedBody {
+	parsed := &models.ParsedBody{Kind: KindForm}
+	data, truncated, err := readLimited(r)
+	if err != nil {
+		parsed.Error = err.Error()
+	}
+	parsed.Truncated = truncated
+
+	// 按原始顺序记录，重复的字段分别记录
+	var f fields
+	for _, pair := range strings.Split(string(data), "&") {
+		if pair == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(pair, "=")
+		if k, err := url.QueryUnescape(key); err == nil {
+			key = k
+		}
+		if v, err := url.QueryUnescape(value); err == nil {
+			value = v
+		}
+		f.add(key, value)
+	}
+	parsed.Fields = f.list
+	parsed.Truncated = parsed.Truncated || f.truncated
+	return parsed
+}
+
+func parseMultipart(r io.Reader, boundary string, files FileFunc) *models.ParsedBody {
+	parsed := &models.ParsedBody{Kind: KindMultipart}
+	if boundary == "" {
+		parsed.Error = "missing boundary"
+		return parsed
+	}
+
+	var f fields
+	mr := multipart.NewReader(r, boundary)
+	for i := 0; ; i++ {
+		p, err := mr.NextRawPart()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				parsed.Error = err.Error()
+			}
+			break
+		}
+		part := models.BodyPart{
+			Name:        p.FormName(),
+			FileName:    p.FileName(),
+			ContentType: p.Header.Get("Content-Type"),
+			Header:      http.Header(p.Header),
+		}
+		if part.FileName == "" {
+			value, _, err := readLimited(p)
+			if len(value) > maxValueLen {
+				value = value[:maxValueLen]
+			}
+			part.Value = string(value)
+			n, _ := io.Copy(io.Discard, p)
+			part.Size = int64(len(value)) + n
+			f.add(part.Name, part.Value)
+			if err != nil {
+				parsed.Error = err.Error()
+			}
+		} else {
+			var w io.WriteCloser
+			if files != nil {
+				w, part.Stored = files(i, &part)
+			}
+			if w == nil {
+				w = nopWriteCloser{io.Discard}
+			}
+			part.Size, err = io.Copy(w, p)
+			w.Close()
+			if err != nil {
+				parsed.Error = err.Error()
+			}
+		}
+		parsed.Parts = append(parsed.Parts, part)
+		if parsed.Error != "" {
+			break
+		}
+	}
+	parsed.Fields = f.list
+	parsed.Truncated = f.truncated
+	return parsed
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
@@ -0,0 +1,171 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/dreamsxin/go-netsniffer/models"
+)
+
+// GraphQL over HTTP 的请求，https://graphql.github.io/graphql-over-http/
+type graphQLRequest struct {
+	Query         string          `json:"query"`
+	OperationName string          `json:"operationName"`
+	Variables     json.RawMessage `json:"variables"`
+}
+
+// JSON 请求中的 GraphQL 操作，支持批量请求
+func graphQLOperations(data []byte) []models.GraphQL {
+	if !bytes.Contains(data, []byte(`"query"`)) {
+		return nil
+	}
+	var requests []graphQLRequest
+	if err := json.Unmarshal(data, &requests); err != nil {
+		var request graphQLRequest
+		if err = json.Unmarshal(data, &request); err != nil {
+			return nil
+		}
+		requests = []graphQLRequest{request}
+	}
+
+	var operations []models.GraphQL
+	for _, req := range requests {
+		if req.Query == "" {
+			continue
+		}
+		operations = append(operations, newGraphQL(req.Query, req.OperationName, req.Variables))
+	}
+	return operations
+}
+
+// application/graphql 内容为查询语句
+func parseGraphQLQuery(r io.Reader) *models.ParsedBody {
+	parsed := &models.ParsedBody{Kind: KindGraphQL}
+	data, truncated, err := readLimited(r)
+	parsed.Truncated = truncated
+	if err != nil {
+		parsed.Error = err.Error()
+	}
+	parsed.GraphQL = []models.GraphQL{newGraphQL(string(data), "", nil)}
+	return parsed
+}
+
+// GET 请求中的 GraphQL 操作，参数为 query、operationName 和 variables
+func ParseGraphQLQuery(query url.Values) *models.ParsedBody {
+	if query.Get("query") == "" {
+		return nil
+	}
+	op := newGraphQL(query.Get("query"), query.Get("operationName"), json.RawMessage(query.Get("variables")))
+	// 其他接口也常用 query 参数，找不到操作时不是 GraphQL
+	if op.OperationType == "" {
+		return nil
+	}
+	return &models.ParsedBody{Kind: KindGraphQL, GraphQL: []models.GraphQL{op}}
+}
+
+func newGraphQL(query, operationName string, variables json.RawMessage) models.GraphQL {
+	op := models.GraphQL{Query: query, OperationName: operationName}
+	op.OperationType, op.OperationName = operation(query, operationName)
+	if len(variables) > 0 && string(variables) != "null" {
+		var pretty bytes.Buffer
+		if json.Indent(&pretty, variables, "", "  ") == nil {
+			op.Variables = pretty.String()
+		} else {
+			op.Variables = string(variables)
+		}
+	}
+	return op
+}
+
+// 查找操作类型和名称，operationName 为空时使用第一个操作，简写的 { ... } 为匿名 query
+func operation(query, operationName string) (string, string) {
+	var first [2]string
+	depth := 0
+	named := false // 当前定义有关键字，不是简写的查询
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == '#':
+			for i < len(query) && query[i] != '\n' {
+				i++
+			}
+			continue
+		case c == '"':
+			i = skipString(query, i)
+			continue
+		case c == '{' || c == '(' || c == '[':
+			if c == '{' && depth == 0 {
+				if !named && first[0] == "" {
+					first = [2]string{"query", ""}
+				}
+				named = false
+			}
+			depth++
+		case c == '}' || c == ')' || c == ']':
+			depth--
+		case depth == 0 && isNameStart(c):
+			start := i
+			for i < len(query) && isNameChar(query[i]) {
+				i++
+			}
+			word := query[start:i]
+			if word == "fragment" {
+				named = true
+			}
+			if word != "query" && word != "mutation" && word != "subscription" {
+				continue
+			}
+			named = true
+			for i < len(query) && strings.IndexByte(" \t\r\n,", query[i]) >= 0 {
+				i++
+			}
+			start = i
+			for i < len(query) && isNameChar(query[i]) {
+				i++
+			}
+			name := query[start:i]
+			if operationName != "" && name == operationName {
+				return word, name
+			}
+			if first[0] == "" {
+				first = [2]string{word, name}
+			}
+			continue
+		}
+		i++
+	}
+	if operationName != "" {
+		return first[0], operationName
+	}
+	return first[0], first[1]
+}
+
+// 跳过字符串和块字符串，返回结束后的位置
+func skipString(query string, i int) int {
+	if strings.HasPrefix(query[i:], `"""`) {
+		if end := strings.Index(query[i+3:], `"""`); end >= 0 {
+			return i + 3 + end + 3
+		}
+		return len(query)
+	}
+	for i++; i < len(query); i++ {
+		switch query[i] {
+		case '\\':
+			i++
+		case '"', '\n':
+			return i + 1
+		}
+	}
+	return i
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isNameChar(c byte) bool {
+	return isNameStart(c) || c >= '0' && c <= '9'
+}
@@ -0,0 +1,84 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+
+	"github.com/dreamsxin/go-netsniffer/models"
+)
+
+func parseJSON(r io.Reader) *models.ParsedBody {
+	parsed := &models.ParsedBody{Kind: KindJSON}
+	data, truncated, err := readLimited(r)
+	parsed.Truncated = truncated
+	if err != nil {
+		parsed.Error = err.Error()
+		return parsed
+	}
+
+	var pretty bytes.Buffer
+	if err = json.Indent(&pretty, data, "", "  "); err == nil {
+		parsed.Pretty = pretty.String()
+	}
+
+	var f fields
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err = walkJSON(dec, "", &f); err != nil && !(truncated && errors.Is(err, io.ErrUnexpectedEOF)) {
+		parsed.Error = err.Error()
+	}
+	parsed.Fields = f.list
+	parsed.Truncated = parsed.Truncated || f.truncated
+
+	if operations := graphQLOperations(data); len(operations) > 0 {
+		parsed.Kind = KindGraphQL
+		parsed.GraphQL = operations
+	}
+	return parsed
+}
+
+// 按原始顺序遍历，记录每个标量值的路径
+func walkJSON(dec *json.Decoder, path string, f *fields) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	switch v := tok.(type) {
+	case json.Delim:
+		if v == '{' {
+			for dec.More() {
+				key, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				if err = walkJSON(dec, join(path, key.(string)), f); err != nil {
+					return err
+				}
+			}
+		} else {
+			for i := 0; dec.More(); i++ {
+				if err = walkJSON(dec, index(path, i), f); err != nil {
+					return err
+				}
+			}
+		}
+		// 结束符
+		_, err = dec.Token()
+		return err
+	case string:
+		f.add(path, v)
+	case json.Number:
+		f.add(path, v.String())
+	case bool:
+		if v {
+			f.add(path, "true")
+		} else {
+			f.add(path, "false")
+		}
+	case nil:
+		f.add(path, "null")
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+// Package parser 把表单、multipart、JSON、XML 和 GraphQL 内容解析为按路径索引的字段，供界面显示和过滤
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"mime"
+	"strconv"
+	"strings"
+
+	"github.com/dreamsxin/go-netsniffer/models"
+)
+
+// 解析结果的种类
+const (
+	KindForm      = "form"
+	KindMultipart = "multipart"
+	KindJSON      = "json"
+	KindXML       = "xml"
+	KindGraphQL   = "graphql"
+)
+
+const (
+	// 最多解析的内容长度，multipart 中的文件不受限制
+	maxParseLen = 1 << 20
+
+	// 最多记录的字段数量
+	maxFields = 1000
+
+	// 字段值最多记录的长度
+	maxValueLen = 1 << 10
+)
+
+// FileFunc 返回保存 multipart 中第 index 个文件内容的 Writer 和保存的名称，为 nil 时不保存
+type FileFunc func(index int, part *models.BodyPart) (io.WriteCloser, string)
+
+// 按内容类型解析，不支持的类型返回 nil，解析出错时 Error 不为空
+func Parse(contentType string, r io.Reader, files FileFunc) *models.ParsedBody {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	switch {
+	case err != nil && contentType != "":
+		return nil
+	case mediaType == "application/x-www-form-urlencoded":
+		return parseForm(r)
+	case strings.HasPrefix(mediaType, "multipart/"):
+		return parseMultipart(r, params["boundary"], files)
+	case mediaType == "application/graphql":
+		return parseGraphQLQuery(r)
+	case strings.Contains(mediaType, "json"):
+		return parseJSON(r)
+	case strings.HasSuffix(mediaType, "/xml") || strings.HasSuffix(mediaType, "+xml"):
+		return parseXML(r)
+	case mediaType == "" || mediaType == "text/plain":
+		// 未声明类型时按开头的字符判断
+		br := bufio.NewReader(r)
+		head, _ := br.Peek(64)
+		if head = bytes.TrimSpace(head); len(head) == 0 {
+			return nil
+		}
+		switch head[0] {
+		case '{', '[':
+			return parseJSON(br)
+		case '<':
+			return parseXML(br)
+		}
+	}
+	return nil
+}
+
+// 读取最多 maxParseLen 的内容
+func readLimited(r io.Reader) ([]byte, bool, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxParseLen+1))
+	if len(data) > maxParseLen {
+		return data[:maxParseLen], true, err
+	}
+	return data, false, err
+}
+
+// fields 收集字段，超过 maxFields 后丢弃
+type fields struct {
+	list      []models.BodyField
+	truncated bool
+}
+
+func (f *fields) add(path, value string) {
+	if len(f.list) >= maxFields {
+		f.truncated = true
+		return
+	}
+	if len(value) > maxValueLen {
+		value = value[:maxValueLen]
+	}
+	f.list = append(f.list, models.BodyField{Path: path, Value: value})
+}
+
+// 拼接字段路径，名称不是标识符时使用 ["name"]
+func join(path, name string) string {
+	if isIdent(name) {
+		if path == "" {
+			return name
+		}
+		return path + "." + name
+	}
+	return path + "[" + strconv.Quote(name) + "]"
+}
+
+func index(path string, i int) string {
+	return path + "[" + strconv.Itoa(i) + "]"
+}
+
+func isIdent(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		if c == '_' || c == '$' || c == '@' || c == '-' && i > 0 || c == ':' && i > 0 ||
+			c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' && i > 0 || c > 0x7f {
+			continue
+		}
+		return false
+	}
+	return true
+}
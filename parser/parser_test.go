@@ -0,0 +1,117 @@
+package parser
+
+import (
+	"bytes"
+	"io"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dreamsxin/go-netsniffer/models"
+)
+
+// 按路径、值交替传入
+func pairs(kv ...string) []models.BodyField {
+	var list []models.BodyField
+	for i := 0; i < len(kv); i += 2 {
+		list = append(list, models.BodyField{Path: kv[i], Value: kv[i+1]})
+	}
+	return list
+}
+
+func TestParse(t *testing.T) {
+	multipartBody := "--b\r\n" +
+		"Content-Disposition: form-data; name=\"title\"\r\n\r\n" +
+		"hello\r\n" +
+		"--b\r\n" +
+		"Content-Disposition: form-data; name=\"file\"; filename=\"a.png\"\r\n" +
+		"Content-Type: image/png\r\n\r\n" +
+		"\x89PNG\r\n" +
+		"--b--\r\n"
+
+	cases := []struct {
+		name        string
+		contentType string
+		body        string
+		kind        string
+		fields      []models.BodyField
+	}{
+		{"form", "application/x-www-form-urlencoded", "a=1&b=x+y&a=%E4%B8%AD", KindForm,
+			pairs("a", "1", "b", "x y", "a", "中")},
+		{"multipart", "multipart/form-data; boundary=b", multipartBody, KindMultipart,
+			pairs("title", "hello")},
+		{"json", "application/json", `{"user":{"name":"a","tags":["x",1,true,null]},"a.b":2}`, KindJSON,
+			pairs("user.name", "a", "user.tags[0]", "x", "user.tags[1]", "1", "user.tags[2]", "true",
+				"user.tags[3]", "null", `["a.b"]`, "2")},
+		{"sniffed json", "", `[{"id":1}]`, KindJSON, pairs("[0].id", "1")},
+		{"xml", "application/atom+xml", `<?xml version="1.0"?><feed xmlns:m="urn:m"><entry id="1"><m:title>a</m:title></entry><entry id="2"><m:title>b</m:title></entry></feed>`, KindXML,
+			pairs("feed.@xmlns:m", "urn:m", "feed.entry.@id", "1", "feed.entry.m:title", "a",
+				"feed.entry[1].@id", "2", "feed.entry[1].m:title", "b")},
+		{"graphql", "application/json", `{"query":"query Q($id: ID) { user(id: $id) { name } }","variables":{"id":"1"}}`, KindGraphQL,
+			pairs("query", "query Q($id: ID) { user(id: $id) { name } }", "variables.id", "1")},
+		{"binary", "image/png", "\x89PNG", "", nil},
+	}
+	for _, c := range cases {
+		var stored bytes.Buffer
+		parsed := Parse(c.contentType, strings.NewReader(c.body), func(index int, part *models.BodyPart) (io.WriteCloser, string) {
+			return nopWriteCloser{&stored}, "file"
+		})
+		if c.kind == "" {
+			if parsed != nil {
+				t.Errorf("%s: unexpected %+v", c.name, parsed)
+			}
+			continue
+		}
+		if parsed == nil || parsed.Kind != c.kind || parsed.Error != "" || !reflect.DeepEqual(parsed.Fields, c.fields) {
+			t.Errorf("%s: got %+v", c.name, parsed)
+			continue
+		}
+		switch c.name {
+		case "multipart":
+			if len(parsed.Parts) != 2 || parsed.Parts[1].FileName != "a.png" || parsed.Parts[1].Size != 4 ||
+				parsed.Parts[1].Stored != "file" || stored.String() != "\x89PNG" {
+				t.Errorf("multipart parts: %+v %q", parsed.Parts, stored.String())
+			}
+		case "json":
+			if !strings.Contains(parsed.Pretty, "\n  \"user\": {") {
+				t.Errorf("json pretty: %s", parsed.Pretty)
+			}
+		case "xml":
+			if !strings.Contains(parsed.Pretty, "\n  <entry id=\"1\">\n    <m:title>a</m:title>") {
+				t.Errorf("xml pretty: %s", parsed.Pretty)
+			}
+		case "graphql":
+			op := parsed.GraphQL[0]
+			if op.OperationType != "query" || op.OperationName != "Q" || !strings.Contains(op.Variables, `"id": "1"`) {
+				t.Errorf("graphql: %+v", op)
+			}
+		}
+	}
+}
+
+func TestOperation(t *testing.T) {
+	cases := []struct {
+		query, operationName string
+		typ, name            string
+	}{
+		{"{ me { name } }", "", "query", ""},
+		{"# comment\nmutation AddUser { add(name: \"query X\") { id } }", "", "mutation", "AddUser"},
+		{"fragment F on User { id } query A { ...F } subscription B { ...F }", "B", "subscription", "B"},
+		{"query A { a } mutation B { b }", "", "query", "A"},
+	}
+	for _, c := range cases {
+		typ, name := operation(c.query, c.operationName)
+		if typ != c.typ || name != c.name {
+			t.Errorf("%q: got %s %s", c.query, typ, name)
+		}
+	}
+
+	if ParseGraphQLQuery(url.Values{"query": {"shoes"}}) != nil {
+		t.Error("search query parsed as GraphQL")
+	}
+	parsed := ParseGraphQLQuery(url.Values{"query": {"{ me }"}, "variables": {`{"a":1}`}})
+	if parsed == nil || parsed.GraphQL[0].OperationType != "query" {
+		t.Errorf("GET GraphQL: %+v", parsed)
+	}
+}
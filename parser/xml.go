@@ -0,0 +1,100 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/dreamsxin/go-netsniffer/models"
+)
+
+// xmlElement 正在解析的元素
+type xmlElement struct {
+	path     string
+	text     strings.Builder
+	children map[string]int // 子元素名称出现的次数，用于生成 [n] 索引
+}
+
+func parseXML(r io.Reader) *models.ParsedBody {
+	parsed := &models.ParsedBody{Kind: KindXML}
+	data, truncated, err := readLimited(r)
+	parsed.Truncated = truncated
+	if err != nil {
+		parsed.Error = err.Error()
+		return parsed
+	}
+
+	var f fields
+	var pretty bytes.Buffer
+	enc := xml.NewEncoder(&pretty)
+	enc.Indent("", "  ")
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.Strict = false
+	stack := []*xmlElement{{children: map[string]int{}}}
+	for {
+		// RawToken 保留命名空间前缀，不检查标签是否匹配
+		tok, err := dec.RawToken()
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !truncated {
+				parsed.Error = err.Error()
+			}
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			parent := stack[len(stack)-1]
+			name := qualifiedName(t.Name)
+			path := join(parent.path, name)
+			if n := parent.children[name]; n > 0 {
+				path = index(path, n)
+			}
+			parent.children[name]++
+			for _, attr := range t.Attr {
+				f.add(join(path, "@"+qualifiedName(attr.Name)), attr.Value)
+			}
+			stack = append(stack, &xmlElement{path: path, children: map[string]int{}})
+			t.Name = xml.Name{Local: name}
+			for i := range t.Attr {
+				t.Attr[i].Name = xml.Name{Local: qualifiedName(t.Attr[i].Name)}
+			}
+			err = enc.EncodeToken(t)
+		case xml.EndElement:
+			if len(stack) > 1 {
+				el := stack[len(stack)-1]
+				if text := strings.TrimSpace(el.text.String()); text != "" {
+					f.add(el.path, text)
+				}
+				stack = stack[:len(stack)-1]
+			}
+			err = enc.EncodeToken(xml.EndElement{Name: xml.Name{Local: qualifiedName(t.Name)}})
+		case xml.CharData:
+			stack[len(stack)-1].text.Write(t)
+			if len(bytes.TrimSpace(t)) > 0 {
+				err = enc.EncodeToken(t)
+			}
+		case xml.Comment, xml.ProcInst, xml.Directive:
+			err = enc.EncodeToken(t)
+		}
+		if err != nil {
+			// 格式化失败时仍然记录字段
+			enc = xml.NewEncoder(io.Discard)
+			pretty.Reset()
+		}
+	}
+	if enc.Flush() == nil && pretty.Len() > 0 {
+		parsed.Pretty = pretty.String()
+	}
+	parsed.Fields = f.list
+	parsed.Truncated = parsed.Truncated || f.truncated
+	return parsed
+}
+
+// RawToken 中 Space 为命名空间前缀
+func qualifiedName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	return name.Space + ":" + name.Local
+}
@@ -0,0 +1,139 @@
+// Package pipeline 连接抓包来源和保存、显示数据包的循环
+// 发送不阻塞，队列已满时丢弃并计数，代理的请求和网卡的读取不会因为界面处理慢而停顿
+package pipeline
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/dreamsxin/go-netsniffer/models"
+)
+
+// 数据包来源
+const (
+	SourceProxy   = "proxy"   // 代理记录的 HTTP 请求
+	SourceCapture = "capture" // 网卡抓取的 IP 数据包
+	SourceDecoder = "decoder" // 从抓取的 TCP 连接中解析的 HTTP 请求
+)
+
+type counter struct {
+	published atomic.Uint64
+	dropped   atomic.Uint64
+}
+
+type Pipeline struct {
+	packets chan *models.Packet
+	// 关闭时持有写锁，发送时持有读锁，关闭后的发送只计数不会 panic
+	lock    sync.RWMutex
+	closed  bool
+	sources sync.Map // string -> *counter
+}
+
+func New(size int) *Pipeline {
+	return &Pipeline{packets: make(chan *models.Packet, size)}
+}
+
+func (p *Pipeline) counter(source string) *counter {
+	if c, ok := p.sources.Load(source); ok {
+		return c.(*counter)
+	}
+	c, _ := p.sources.LoadOrStore(source, &counter{})
+	return c.(*counter)
+}
+
+// 不阻塞地发送数据包，队列已满或已关闭时丢弃并返回 false
+func (p *Pipeline) Publish(source string, packet *models.Packet) bool {
+	c := p.counter(source)
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	if !p.closed {
+		select {
+		case p.packets <- packet:
+			c.published.Add(1)
+			return true
+		default:
+		}
+	}
+	c.dropped.Add(1)
+	return false
+}
+
+// 返回发送到 source 的函数
+func (p *Pipeline) Publisher(source string) func(*models.Packet) {
+	return func(packet *models.Packet) {
+		p.Publish(source, packet)
+	}
+}
+
+// 返回只计数丢弃的函数，用于来源在发送之前丢弃的数据
+func (p *Pipeline) Dropper(source string) func() {
+	c := p.counter(source)
+	return func() {
+		c.dropped.Add(1)
+	}
+}
+
+// 关闭后读取完队列中剩余的数据包结束
+func (p *Pipeline) Packets() <-chan *models.Packet {
+	return p.packets
+}
+
+// 停止接收新的数据包，应在停止所有来源之后调用，可以重复调用
+func (p *Pipeline) Close() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if !p.closed {
+		p.closed = true
+		close(p.packets)
+	}
+}
+
+func (p *Pipeline) Stats() models.PipelineStats {
+	stats := models.PipelineStats{
+		Sources:  map[string]models.SourceStats{},
+		Queued:   len(p.packets),
+		Capacity: cap(p.packets),
+	}
+	p.sources.Range(func(key, value any) bool {
+		c := value.(*counter)
+		stats.Sources[key.(string)] = models.SourceStats{Published: c.published.Load(), Dropped: c.dropped.Load()}
+		return true
+	})
+	return stats
+}
+
+// Batch 等待批量发送到界面的数据，超过上限后丢弃新数据并计数
+type Batch[T any] struct {
+	lock    sync.Mutex
+	items   []T
+	limit   int
+	dropped atomic.Uint64
+}
+
+func NewBatch[T any](limit int) *Batch[T] {
+	return &Batch[T]{limit: limit}
+}
+
+func (b *Batch[T]) Add(item T) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if len(b.items) >= b.limit {
+		b.dropped.Add(1)
+		return false
+	}
+	b.items = append(b.items, item)
+	return true
+}
+
+// 取出等待发送的数据，没有数据时返回 nil
+func (b *Batch[T]) Take() []T {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	items := b.items
+	b.items = nil
+	return items
+}
+
+func (b *Batch[T]) Dropped() uint64 {
+	return b.dropped.Load()
+}
@@ -0,0 +1,57 @@
+package pipeline
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/dreamsxin/go-netsniffer/models"
+)
+
+func TestPipeline(t *testing.T) {
+	p := New(2)
+	for i := 0; i < 3; i++ {
+		p.Publish(SourceProxy, &models.Packet{})
+	}
+	p.Publisher(SourceCapture)(&models.Packet{})
+	stats := p.Stats()
+	if stats.Queued != 2 || stats.Sources[SourceProxy] != (models.SourceStats{Published: 2, Dropped: 1}) ||
+		stats.Sources[SourceCapture] != (models.SourceStats{Dropped: 1}) {
+		t.Errorf("stats: %+v", stats)
+	}
+
+	// 关闭时仍在发送的来源不会 panic
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				p.Publish(SourceDecoder, &models.Packet{})
+			}
+		}()
+	}
+	go p.Close()
+	n := 0
+	for range p.Packets() {
+		n++
+	}
+	wg.Wait()
+	p.Close()
+	if p.Publish(SourceProxy, &models.Packet{}) {
+		t.Error("published after close")
+	}
+	decoder := p.Stats().Sources[SourceDecoder]
+	if uint64(n) != 2+decoder.Published || decoder.Published+decoder.Dropped != 400 {
+		t.Errorf("drained %d, decoder %+v", n, decoder)
+	}
+
+	b := NewBatch[int](2)
+	b.Add(1)
+	b.Add(2)
+	if b.Add(3) || b.Dropped() != 1 {
+		t.Error("batch limit")
+	}
+	if items := b.Take(); len(items) != 2 || b.Take() != nil {
+		t.Errorf("take: %v", items)
+	}
+}
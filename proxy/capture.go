@@ -0,0 +1,158 @@
+package proxy
+
+import (
+	"mime"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"github.com/dreamsxin/go-netsniffer/models"
+	"github.com/google/martian/v3"
+)
+
+const captureKey = "netsniffer.capture"
+
+// 图片、脚本、样式、字体等静态资源的路径
+var staticAsset = regexp.MustCompile(`(?i)\.(jpe?g|png|gif|webp|bmp|ico|svg|js|mjs|css|map|woff2?|ttf|otf|eot)$`)
+
+// CaptureRules 抓取规则，nil 记录所有请求和内容
+type CaptureRules struct {
+	include      []captureRule
+	exclude      []captureRule
+	contentTypes []string
+	skipStatic   bool
+	maxBodySize  int64
+}
+
+func NewCaptureRules(conf models.Capture) *CaptureRules {
+	r := &CaptureRules{
+		include:     cleanRules(conf.Include),
+		exclude:     cleanRules(conf.Exclude),
+		skipStatic:  conf.SkipStatic,
+		maxBodySize: conf.MaxBodySize,
+	}
+	for _, t := range conf.ContentTypes {
+		if t = strings.ToLower(strings.TrimSpace(t)); t != "" {
+			r.contentTypes = append(r.contentTypes, t)
+		}
+	}
+	return r
+}
+
+// 规则为主机或 主机/路径，主机支持 *.example.com，路径中的 * 匹配任意字符，如 api.example.com/v1/*
+type captureRule struct {
+	host string
+	path *regexp.Regexp // 没有路径时为 nil
+}
+
+func cleanRules(rules []string) (ret []captureRule) {
+	for _, rule := range rules {
+		if rule = strings.TrimSpace(rule); rule != "" {
+			host, path, hasPath := strings.Cut(rule, "/")
+			r := captureRule{host: host}
+			if hasPath {
+				r.path = compileGlob("/" + path)
+			}
+			ret = append(ret, r)
+		}
+	}
+	return ret
+}
+
+// 请求是否需要记录，Exclude 优先于 Include，CONNECT 请求只按主机判断
+func (r *CaptureRules) Match(req *http.Request) bool {
+	if r == nil {
+		return true
+	}
+	host := req.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	connect := req.Method == http.MethodConnect
+	path := req.URL.Path
+	for _, rule := range r.exclude {
+		if !connect && rule.match(host, path) || connect && rule.path == nil && MatchHost(rule.host, host) {
+			return false
+		}
+	}
+	if r.skipStatic && !connect && staticAsset.MatchString(path) {
+		return false
+	}
+	if len(r.include) == 0 {
+		return true
+	}
+	for _, rule := range r.include {
+		if connect && MatchHost(rule.host, host) || !connect && rule.match(host, path) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r captureRule) match(host, path string) bool {
+	if r.host != "*" && !MatchHost(r.host, host) {
+		return false
+	}
+	return r.path == nil || r.path.MatchString(path)
+}
+
+// 路径中的 * 转换为 .*，其他字符按原样匹配
+func compileGlob(pattern string) *regexp.Regexp {
+	parts := strings.Split(pattern, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	return regexp.MustCompile("^" + strings.Join(parts, ".*") + "$")
+}
+
+// 内容是否需要保存，类型按前缀匹配，如 image/、video/，长度未知时为 -1
+func (r *CaptureRules) CaptureBody(contentType string, contentLength int64) bool {
+	if r == nil {
+		return true
+	}
+	if r.maxBodySize > 0 && contentLength > r.maxBodySize {
+		return false
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	for _, t := range r.contentTypes {
+		if strings.HasPrefix(mediaType, t) {
+			return false
+		}
+	}
+	return true
+}
+
+// capturer 在记录处理器之前判断，不记录的请求设置 SkipLogging，记录处理器直接跳过，不保存内容
+type capturer struct {
+	rules atomic.Pointer[CaptureRules]
+}
+
+func (c *capturer) ModifyRequest(req *http.Request) error {
+	ctx := martian.NewContext(req)
+	if ctx == nil {
+		return nil
+	}
+	rules := c.rules.Load()
+	if !rules.Match(req) {
+		ctx.SkipLogging()
+	}
+	ctx.Set(captureKey, rules)
+	return nil
+}
+
+// 请求使用的抓取规则，需要在请求或响应处理器中获取
+func Capture(req *http.Request) *CaptureRules {
+	if req == nil {
+		return nil
+	}
+	ctx := martian.NewContext(req)
+	if ctx == nil {
+		return nil
+	}
+	if v, ok := ctx.Get(captureKey); ok {
+		return v.(*CaptureRules)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/dreamsxin/go-netsniffer/cert"
+	"github.com/dreamsxin/go-netsniffer/models"
+)
+
+func TestCaptureRules(t *testing.T) {
+	rules := NewCaptureRules(models.Capture{
+		Include:      []string{"*.example.com", "api.test.com/v1/*"},
+		Exclude:      []string{"cdn.example.com", "*/health"},
+		ContentTypes: []string{"image/", " Video/ "},
+		SkipStatic:   true,
+		MaxBodySize:  1024,
+	})
+	request := func(method, host, path string) *http.Request {
+		return &http.Request{Method: method, Host: host, URL: &url.URL{Path: path}}
+	}
+	cases := []struct {
+		req  *http.Request
+		want bool
+	}{
+		{request("GET", "www.example.com", "/index.html"), true},
+		{request("GET", "example.com:443", "/"), true},
+		{request("GET", "cdn.example.com", "/a.json"), false},
+		{request("GET", "www.example.com", "/health"), false},
+		{request("GET", "www.example.com", "/app.JS"), false},
+		{request("GET", "api.test.com", "/v1/users"), true},
+		{request("GET", "api.test.com", "/v2/users"), false},
+		{request("GET", "other.com", "/"), false},
+		{request("CONNECT", "api.test.com:443", ""), true},
+		{request("CONNECT", "cdn.example.com:443", ""), false},
+	}
+	for _, c := range cases {
+		if got := rules.Match(c.req); got != c.want {
+			t.Errorf("%s %s%s: got %v", c.req.Method, c.req.Host, c.req.URL.Path, got)
+		}
+	}
+
+	if rules.CaptureBody("image/png", 10) || rules.CaptureBody("video/mp4", -1) || rules.CaptureBody("text/html", 2048) {
+		t.Error("body should not be captured")
+	}
+	if !rules.CaptureBody("text/html; charset=utf-8", -1) {
+		t.Error("body should be captured")
+	}
+
+	var none *CaptureRules
+	if !none.Match(request("GET", "a.com", "/a.png")) || !none.CaptureBody("image/png", 1<<30) {
+		t.Error("nil rules should capture everything")
+	}
+}
+
+// 排除的主机直接转发隧道，客户端收到上游服务器的证书；其他主机收到代理签发的证书
+func TestCaptureExcludedConnect(t *testing.T) {
+	store, err := NewCertStore(t.TempDir(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, caKey, err := NewAuthority("Test", "Test", time.Hour, cert.KeyTypeECDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = store.Save(ca, caKey); err != nil {
+		t.Fatal(err)
+	}
+	p, err := New(store, "Test", models.Cert{LeafKeyType: string(cert.KeyTypeECDSA)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.SetCapture(models.Capture{Exclude: []string{"127.0.0.1"}})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go p.Serve(l)
+	defer p.Close()
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	_, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+
+	// 返回客户端握手时收到的服务器证书
+	peer := func(host string) *x509.Certificate {
+		var crt *x509.Certificate
+		transport := &http.Transport{
+			Proxy: http.ProxyURL(&url.URL{Scheme: "http", Host: l.Addr().String()}),
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true, VerifyConnection: func(state tls.ConnectionState) error {
+				crt = state.PeerCertificates[0]
+				return nil
+			}},
+		}
+		defer transport.CloseIdleConnections()
+		res, err := transport.RoundTrip(&http.Request{Method: http.MethodGet, URL: &url.URL{Scheme: "https", Host: net.JoinHostPort(host, port), Path: "/"}, Header: http.Header{}})
+		if err == nil {
+			res.Body.Close()
+		} else if crt == nil {
+			t.Fatalf("%s: %v", host, err)
+		}
+		return crt
+	}
+
+	if crt := peer("127.0.0.1"); !crt.Equal(srv.Certificate()) {
+		t.Errorf("excluded host intercepted, got certificate %s", crt.Subject)
+	}
+	if crt := peer("localhost"); crt.CheckSignatureFrom(ca) != nil {
+		t.Errorf("included host not intercepted, got certificate %s", crt.Subject)
+	}
+}
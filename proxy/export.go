@@ -0,0 +1,114 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/x509"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dreamsxin/go-netsniffer/cert"
+)
+
+const (
+	// 通过代理访问 http://netsniffer.cert 下载根证书
+	CertHost = "netsniffer.cert"
+
+	profileIdentifier = "com.github.dreamsxin.go-netsniffer"
+)
+
+const (
+	ExportFormatPEM          = "pem"
+	ExportFormatDER          = "der" // Android、Windows 使用的 .crt/.cer
+	ExportFormatMobileConfig = "mobileconfig"
+)
+
+// 按格式编码根证书，返回内容类型、文件扩展名和内容
+func EncodeCert(crt *x509.Certificate, format string) (string, string, []byte, error) {
+	switch strings.ToLower(format) {
+	case ExportFormatPEM:
+		return cert.ContentTypePEM, ".pem", cert.EncodeCertPEM(crt), nil
+	case ExportFormatDER, "crt", "cer":
+		return cert.ContentTypeDER, ".crt", crt.Raw, nil
+	case ExportFormatMobileConfig:
+		data, err := cert.MobileConfig(crt, profileIdentifier)
+		return cert.ContentTypeMobileConfig, ".mobileconfig", data, err
+	}
+	return "", "", nil, fmt.Errorf("unsupported export format: %s", format)
+}
+
+// 导出根证书到文件，不包含私钥
+func ExportCert(store *CertStore, format, filename string) error {
+	crt, err := store.Certificate()
+	if err != nil {
+		return fmt.Errorf("导出证书失败: %w", err)
+	}
+	_, _, data, err := EncodeCert(crt, format)
+	if err != nil {
+		return fmt.Errorf("导出证书失败: %w", err)
+	}
+	if err = os.WriteFile(filename, data, 0644); err != nil {
+		return fmt.Errorf("导出证书失败: %w", err)
+	}
+	return nil
+}
+
+var installTemplate = template.Must(template.New("install").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>安装根证书</title>
+</head>
+<body>
+<h2>{{.Name}}</h2>
+<p>SHA-256: <code>{{.Fingerprint}}</code></p>
+<p>有效期至 {{.NotAfter}}</p>
+<h3>Android</h3>
+<p>下载 <a href="/cert.crt">cert.crt</a>，在“设置 → 安全 → 加密与凭据 → 安装证书 → CA 证书”中选择下载的文件。Android 7 以上应用默认不信任用户证书，需要应用自己配置 network_security_config。</p>
+<h3>iOS</h3>
+<p>使用 Safari 下载 <a href="/cert.mobileconfig">描述文件</a>，在“设置 → 已下载描述文件”中安装，然后在“设置 → 通用 → 关于本机 → 证书信任设置”中开启完全信任。</p>
+<h3>Windows / macOS / Linux</h3>
+<p>下载 <a href="/cert.crt">cert.crt</a> 或 <a href="/cert.pem">cert.pem</a>，导入到系统或浏览器的受信任根证书颁发机构。</p>
+</body>
+</html>
+`))
+
+// 在代理上注册根证书下载页面，设备设置代理后访问 http://netsniffer.cert
+func HandleCertRoutes(local *LocalHandler, store *CertStore) {
+	local.AddHost(CertHost)
+
+	download := func(format string) LocalRoute {
+		return func(req *http.Request, header http.Header) (string, []byte, error) {
+			crt, err := store.Certificate()
+			if err != nil {
+				return "", nil, err
+			}
+			contentType, ext, data, err := EncodeCert(crt, format)
+			if err != nil {
+				return "", nil, err
+			}
+			header.Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"netsniffer-ca%s\"", ext))
+			return contentType, data, nil
+		}
+	}
+	local.Handle("/cert.pem", download(ExportFormatPEM))
+	local.Handle("/cert.crt", download(ExportFormatDER))
+	local.Handle("/cert.mobileconfig", download(ExportFormatMobileConfig))
+	local.Handle("/", func(req *http.Request, header http.Header) (string, []byte, error) {
+		crt, err := store.Certificate()
+		if err != nil {
+			return "", nil, err
+		}
+		var b bytes.Buffer
+		err = installTemplate.Execute(&b, map[string]string{
+			"Name":        crt.Subject.CommonName,
+			"Fingerprint": cert.Fingerprint(crt),
+			"NotAfter":    crt.NotAfter.Local().Format(time.DateTime),
+		})
+		return "text/html; charset=utf-8", b.Bytes(), err
+	})
+}
@@ -1,53 +1,156 @@
 package handler
 
 import (
-	"bytes"
-	"compress/gzip"
 	"context"
+	"fmt"
 	"io"
 	"log"
+	"mime"
 	"net/http"
-	"regexp"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/andybalholm/brotli"
+	"github.com/dreamsxin/go-netsniffer/codec"
 	"github.com/dreamsxin/go-netsniffer/models"
-	"github.com/valyala/gozstd"
-	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"github.com/dreamsxin/go-netsniffer/parser"
+	"github.com/dreamsxin/go-netsniffer/proxy"
+	"github.com/dreamsxin/go-netsniffer/storage"
+	"github.com/google/martian/v3"
 )
 
 const authorityName string = "Local Proxy Authority"
 
 // RequestLogger is a RequestModifier logs all request url
 type RequestLogger struct {
-	ctx      context.Context
-	sendChan chan<- *models.Packet
+	ctx    context.Context
+	send   func(*models.Packet) bool // 不能阻塞，否则会延迟转发，丢弃时返回 false
+	bodies *storage.BodyStore
+	wg     sync.WaitGroup // 正在记录内容的回调和协程
 }
 
-func NewRequestLogger(ctx context.Context, sendChan chan<- *models.Packet) *RequestLogger {
-	return &RequestLogger{ctx: ctx, sendChan: sendChan}
+func NewRequestLogger(ctx context.Context, send func(*models.Packet) bool, bodies *storage.BodyStore) *RequestLogger {
+	return &RequestLogger{ctx: ctx, send: send, bodies: bodies}
 }
 
-var regex *regexp.Regexp
-var regexRawData *regexp.Regexp
+// 等待正在记录的内容处理完成，代理关闭后调用，超时返回 false
+func (r *RequestLogger) Wait(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// 发送失败的数据包不会保存到会话，对应的内容一起删除
+func (r *RequestLogger) publish(data *models.Packet) bool {
+	if r.send(data) {
+		return true
+	}
+	switch data.HTTP.HTTPPacketType {
+	case models.HTTPPacketType_REQUEST:
+		r.bodies.RemoveParts(data.HTTP.ID, storage.PartRequest)
+	case models.HTTPPacketType_RESPONSE:
+		r.bodies.RemoveParts(data.HTTP.ID, storage.PartResponse)
+	}
+	return false
+}
+
+// 抓取规则设置为不保存的内容
+const notCaptured = "[not captured]"
+
+// 代理自身和抓取规则排除的请求不记录
+func skipLogging(req *http.Request) bool {
+	if req == nil {
+		return false
+	}
+	ctx := martian.NewContext(req)
+	return ctx != nil && ctx.SkippingLogging()
+}
+
+func setTime(data *models.Packet, t time.Time) {
+	data.HTTP.DateTime = t
+	data.HTTP.Date = t.Format(time.DateTime)
+}
 
-func init() {
+// 同一个请求的请求和响应使用 martian 的事务 ID
+func transactionID(req *http.Request) string {
+	if ctx := martian.NewContext(req); ctx != nil {
+		return ctx.ID()
+	}
+	return ""
+}
+
+// 内容类型是否为文本
+func isText(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return strings.HasPrefix(mediaType, "text/") || strings.Contains(mediaType, "json") || strings.Contains(mediaType, "xml") ||
+		strings.Contains(mediaType, "javascript") || mediaType == "application/x-www-form-urlencoded"
+}
 
-	regexPattern := `^.*\.(jpg|png|gif|js|css|ico|svg)$`
-	regex = regexp.MustCompile(regexPattern)
+// 按内容嗅探 MIME 类型，无法识别时使用头部中的类型，头部和嗅探结果任一为文本时作为文本显示
+func detectMIME(body *storage.Body, contentType string) (string, bool) {
+	head, _ := body.Range(0, 512)
+	if len(head) == 0 {
+		return contentType, isText(contentType)
+	}
+	sniffed := http.DetectContentType(head)
+	text := isText(contentType) || isText(sniffed)
+	if contentType != "" && (sniffed == "application/octet-stream" || strings.HasPrefix(sniffed, "text/plain")) {
+		return contentType, text
+	}
+	return sniffed, text
+}
 
-	regexPattern = "window.rawData={(.*?)};"
-	regexRawData = regexp.MustCompile(regexPattern)
+// 已保存内容的开头部分、状态和解析结果写入数据包，二进制内容只记录类型，由界面按 ID 预览
+func (r *RequestLogger) setBody(data *models.Packet, body *storage.Body, part, contentType string) {
+	mimeType, text := detectMIME(body, contentType)
+	body.SetContentType(mimeType)
+	info := body.Info()
+	data.HTTP.MIMEType = mimeType
+	data.HTTP.BodySize = info.Size
+	data.HTTP.BodyTruncated = info.Truncated
+	data.HTTP.Parsed = parser.Parse(contentType, body.Reader(), func(index int, p *models.BodyPart) (io.WriteCloser, string) {
+		// multipart 中的文件单独保存，可以按名称预览
+		name := fmt.Sprintf("%s-file-%d", part, index)
+		file := r.bodies.Create(data.HTTP.ID, name)
+		file.SetContentType(p.ContentType)
+		return file, name
+	})
+	if !text {
+		data.HTTP.Body = "[binary data]" + mimeType
+		return
+	}
+	preview, err := body.Range(0, previewLen)
+	if err != nil {
+		data.HTTP.Body = err.Error()
+		return
+	}
+	data.HTTP.Body = string(preview)
 }
 
 // 从请求中获取 cookie
 func (r *RequestLogger) ModifyRequest(req *http.Request) error {
+	if skipLogging(req) {
+		return nil
+	}
 
 	var data models.Packet
 	data.PacketType = models.PacketType_HTTP
+	data.HTTP.ID = transactionID(req)
 	data.HTTP.HTTPPacketType = models.HTTPPacketType_REQUEST
-	data.HTTP.Date = time.Now().Format(time.DateTime)
+	data.HTTP.Timing = proxy.Timer(req).Timing()
+	if data.HTTP.Timing != nil {
+		setTime(&data, data.HTTP.Timing.Start)
+	} else {
+		setTime(&data, time.Now())
+	}
 	data.HTTP.Proto = req.Proto
 	data.HTTP.ProtoMajor = req.ProtoMajor
 	data.HTTP.ProtoMinor = req.ProtoMinor
@@ -57,26 +160,75 @@ func (r *RequestLogger) ModifyRequest(req *http.Request) error {
 	data.HTTP.URL = req.URL.String()
 	data.HTTP.Header = req.Header
 	data.HTTP.ContentLength = req.ContentLength
+	data.HTTP.ClientTLS = proxy.ClientFingerprint(req)
 	log.Println("ModifyRequest", data.HTTP.URL)
-	if data.HTTP.ContentLength == 0 {
+	if data.HTTP.ContentLength == 0 || req.Body == nil || req.Body == http.NoBody {
 		data.HTTP.Body = "[no data]"
-	} else {
-		rb, _ := io.ReadAll(req.Body)
-		req.Body.Close()
-		req.Body = io.NopCloser(bytes.NewBuffer(rb))
-		data.HTTP.Body = string(rb)
+		data.HTTP.Parsed = parser.ParseGraphQLQuery(req.URL.Query())
+		r.publish(&data)
+		return nil
 	}
 
-	r.sendChan <- &data
+	// 转发的同时保存，读取结束后再发送，不在内存中缓存整个请求
+	// 需要解码的内容先保存原始数据，转发结束后再解码
+	contentType := req.Header.Get("Content-Type")
+	contentEncoding := req.Header.Get("Content-Encoding")
+	if !proxy.Capture(req).CaptureBody(contentType, req.ContentLength) {
+		data.HTTP.Body = notCaptured
+		r.publish(&data)
+		return nil
+	}
+	if !codec.NeedsDecode(contentEncoding, contentType) {
+		body := r.bodies.Create(data.HTTP.ID, storage.PartRequest)
+		r.wg.Add(1)
+		req.Body = &bodyRecorder{ReadCloser: req.Body, body: body, done: func() {
+			defer r.wg.Done()
+			r.setBody(&data, body, storage.PartRequest, contentType)
+			r.publish(&data)
+		}}
+		return nil
+	}
+	raw := r.bodies.Create(data.HTTP.ID, storage.PartRequestRaw)
+	r.wg.Add(1)
+	req.Body = &bodyRecorder{ReadCloser: req.Body, body: raw, done: func() {
+		defer r.wg.Done()
+		body, err := r.decodeBody(data.HTTP.ID, storage.PartRequest, raw, contentEncoding, contentType)
+		if err != nil {
+			log.Println("decodeBody", data.HTTP.URL, err)
+		}
+		if body != nil {
+			r.setBody(&data, body, storage.PartRequest, contentType)
+		} else {
+			data.HTTP.Body = err.Error()
+		}
+		r.publish(&data)
+	}}
 	return nil
 }
 
+// 解码已保存的原始内容，保存为 part，原始内容被截断时保留已解码的部分
+func (r *RequestLogger) decodeBody(id, part string, raw *storage.Body, contentEncoding, contentType string) (*storage.Body, error) {
+	decoded, err := codec.Decode(raw.Reader(), contentEncoding, contentType)
+	if err != nil {
+		return nil, err
+	}
+	defer decoded.Close()
+	body := r.bodies.Create(id, part)
+	defer body.Close()
+	_, err = io.Copy(body, decoded)
+	return body, err
+}
+
 // 从返回中获取 cookie
 func (r *RequestLogger) ModifyResponse(resp *http.Response) error {
+	if skipLogging(resp.Request) {
+		return nil
+	}
 	var data models.Packet
 	data.PacketType = models.PacketType_HTTP
+	data.HTTP.ID = transactionID(resp.Request)
 	data.HTTP.HTTPPacketType = models.HTTPPacketType_RESPONSE
-	data.HTTP.Date = time.Now().Format(time.DateTime)
+	setTime(&data, time.Now())
 	data.HTTP.Proto = resp.Proto
 	data.HTTP.ProtoMajor = resp.ProtoMajor
 	data.HTTP.ProtoMinor = resp.ProtoMinor
@@ -89,63 +241,157 @@ func (r *RequestLogger) ModifyResponse(resp *http.Response) error {
 	data.HTTP.StatusCode = resp.StatusCode
 	data.HTTP.ContentType = resp.Header.Get("Content-Type")
 	data.HTTP.ContentLength = resp.ContentLength
+	data.HTTP.TLS = proxy.UpstreamTLS(resp.Request)
+	data.HTTP.ClientTLS = proxy.ClientFingerprint(resp.Request)
 
+	timer := proxy.Timer(resp.Request)
 	if data.HTTP.ContentLength == 0 {
+		timer.Finish()
+		data.HTTP.Timing = timer.Timing()
 		data.HTTP.Body = "[no data]"
-	} else {
-		contentType := resp.Header.Get("Content-Type")
-		contentEncoding := resp.Header.Get("Content-Encoding")
-		log.Println("ModifyResponse", contentType, contentEncoding, data.HTTP.URL)
-		if contentType == "" || (!strings.HasPrefix(contentType, "text/") && !strings.Contains(contentType, "json")) {
-			data.HTTP.Body = "[binary data]" + contentType
-			runtime.EventsEmit(r.ctx, "Packet", data)
-			return nil
+		r.publish(&data)
+		return nil
+	}
+	data.HTTP.Timing = timer.Timing()
+
+	contentType := resp.Header.Get("Content-Type")
+	contentEncoding := resp.Header.Get("Content-Encoding")
+	log.Println("ModifyResponse", contentType, contentEncoding, data.HTTP.URL)
+	// 不保存内容时直接转发，完成时间不再记录
+	if !proxy.Capture(resp.Request).CaptureBody(contentType, resp.ContentLength) {
+		data.HTTP.Body = notCaptured
+		r.publish(&data)
+		return nil
+	}
+
+	// 转发给客户端的同时记录内容，不等待响应结束
+	tee := newBodyTee(resp.Body, timer.Finish)
+	resp.Body = tee
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType == "text/event-stream" {
+		data.HTTP.Body = "[event stream]"
+		// 响应没有发送时事件也不再记录，tee 丢弃数据后不影响转发
+		if r.publish(&data) {
+			r.wg.Add(1)
+			go r.captureEvents(data, tee, contentEncoding)
 		}
+		return nil
+	}
+	// 二进制内容不分段发送
+	r.wg.Add(1)
+	go r.captureBody(data, tee, timer, contentEncoding, resp.ContentLength < 0 && isText(contentType))
+	return nil
+}
 
-		rb, _ := io.ReadAll(resp.Body)
-		resp.Body.Close()
-		resp.Body = io.NopCloser(bytes.NewBuffer(rb))
-
-		switch contentEncoding {
-		case "zstd":
-			decompressdata, err := gozstd.Decompress(nil, rb)
-			if err != nil {
-				data.HTTP.Body = err.Error()
-			} else {
-				data.HTTP.Body = string(decompressdata)
-			}
-		case "gzip":
-			// 解压gzip数据
-			r, err := gzip.NewReader(bytes.NewReader(rb))
-			if err != nil {
-				data.HTTP.Body = err.Error()
-			} else {
-				defer r.Close()
-
-				// 读取解压后的数据
-				unzippedData, err := io.ReadAll(r)
-				if err != nil {
-					data.HTTP.Body = err.Error()
-				} else {
-					data.HTTP.Body = string(unzippedData)
+// 每个 SSE 事件单独发送
+func (r *RequestLogger) captureEvents(head models.Packet, tee *bodyTee, contentEncoding string) {
+	defer r.wg.Done()
+	src := tee.reader()
+	defer io.Copy(io.Discard, src)
+
+	dr, err := codec.NewReader(src, contentEncoding)
+	if err != nil {
+		log.Println("captureEvents", head.HTTP.URL, err)
+		return
+	}
+	defer dr.Close()
+	var decoded io.Reader = dr
+
+	// 所有事件的原始内容也保存下来
+	body := r.bodies.Create(head.HTTP.ID, storage.PartResponse)
+	defer body.Close()
+	decoded = io.TeeReader(decoded, body)
+
+	seq := 0
+	err = readEvents(decoded, func(ev sseEvent) {
+		seq++
+		data := head
+		data.HTTP.HTTPPacketType = models.HTTPPacketType_STREAM
+		setTime(&data, time.Now())
+		data.HTTP.Seq = seq
+		data.HTTP.Event = ev.event
+		data.HTTP.EventID = ev.id
+		data.HTTP.Body = ev.data
+		r.publish(&data)
+	})
+	if tee.dropped.Load() {
+		body.SetTruncated()
+		return
+	}
+	if err != nil {
+		log.Println("captureEvents", head.HTTP.URL, err)
+	}
+}
+
+// 响应结束后发送完整内容，长度未知的响应在结束前先分段发送已收到的数据
+func (r *RequestLogger) captureBody(head models.Packet, tee *bodyTee, timer *proxy.RequestTimer, contentEncoding string, unknownLength bool) {
+	defer r.wg.Done()
+	var src io.Reader = tee.reader()
+	// 需要解码的内容同时保存原始数据
+	var raw *storage.Body
+	if codec.NeedsDecode(contentEncoding, head.HTTP.ContentType) {
+		raw = r.bodies.Create(head.HTTP.ID, storage.PartResponseRaw)
+		src = io.TeeReader(src, raw)
+	}
+	var frag *fragmenter
+	if unknownLength {
+		frag = &fragmenter{emit: func(seq int, body []byte) {
+			data := head
+			data.HTTP.HTTPPacketType = models.HTTPPacketType_STREAM
+			setTime(&data, time.Now())
+			data.HTTP.Seq = seq
+			data.HTTP.Body = string(body)
+			r.publish(&data)
+		}}
+	}
+
+	body := r.bodies.Create(head.HTTP.ID, storage.PartResponse)
+	decoded, err := codec.Decode(src, contentEncoding, head.HTTP.ContentType)
+	if err == nil {
+		buf := make([]byte, 32<<10)
+		for {
+			n, rerr := decoded.Read(buf)
+			if n > 0 {
+				body.Write(buf[:n])
+				if frag != nil {
+					frag.add(buf[:n])
 				}
 			}
-		case "br":
-			r := brotli.NewReader(bytes.NewReader(rb))
-
-			// 读取解压后的数据
-			unzippedData, err := io.ReadAll(r)
-			if err != nil {
-				data.HTTP.Body = err.Error()
-			} else {
-				data.HTTP.Body = string(unzippedData)
+			if rerr != nil {
+				if rerr != io.EOF {
+					err = rerr
+				}
+				break
 			}
-
-		default:
-			data.HTTP.Body = string(rb)
 		}
+		decoded.Close()
+	}
+	// 解压失败时继续读取剩余数据，直到转发结束
+	io.Copy(io.Discard, src)
+	if tee.dropped.Load() {
+		// 丢弃数据后解码的错误由内容不完整引起，保留已经解码的部分
+		err = nil
+		body.SetTruncated()
+		if raw != nil {
+			raw.SetTruncated()
+		}
+	}
+	body.Close()
+	if raw != nil {
+		raw.Close()
+	}
+	if frag != nil {
+		frag.stop()
 	}
 
-	r.sendChan <- &data
-	return nil
+	data := head
+	data.HTTP.Timing = timer.Timing()
+	if err != nil {
+		data.HTTP.Body = err.Error()
+	} else {
+		r.setBody(&data, body, storage.PartResponse, head.HTTP.ContentType)
+		if tee.dropped.Load() {
+			data.HTTP.Body = "[incomplete]" + data.HTTP.Body
+		}
+	}
+	r.publish(&data)
 }
@@ -0,0 +1,247 @@
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dreamsxin/go-netsniffer/storage"
+)
+
+const (
+	// 发送给界面的内容长度，完整内容保存在 BodyStore 中按 ID 读取
+	previewLen = 64 << 10
+
+	// 长度未知的响应每段最多发送的长度
+	maxFragmentLen = 1 << 20
+
+	// 记录中的数据块数量，解析跟不上时丢弃，不影响转发
+	teeChunks = 64
+
+	// 长度未知的响应超过该时间还没有结束时，先发送已经收到的数据
+	fragmentDelay = 500 * time.Millisecond
+)
+
+// bodyTee 在 martian 向客户端转发响应内容的同时把读到的数据交给记录协程
+// 记录协程跟不上时第一次丢弃数据后不再发送，记录协程读完已收到的数据后停止解码
+type bodyTee struct {
+	io.ReadCloser
+	lock    sync.Mutex
+	chunks  chan []byte
+	closed  bool // chunks 已经关闭
+	dropped atomic.Bool
+	once    sync.Once
+	done    func() // 转发结束时调用
+}
+
+func newBodyTee(body io.ReadCloser, done func()) *bodyTee {
+	return &bodyTee{ReadCloser: body, chunks: make(chan []byte, teeChunks), done: done}
+}
+
+func (t *bodyTee) Read(p []byte) (int, error) {
+	n, err := t.ReadCloser.Read(p)
+	if n > 0 {
+		t.push(p[:n])
+	}
+	if err != nil {
+		t.finish()
+	}
+	return n, err
+}
+
+func (t *bodyTee) push(p []byte) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.closed {
+		return
+	}
+	select {
+	case t.chunks <- append([]byte(nil), p...):
+	default:
+		t.dropped.Store(true)
+		t.closed = true
+		close(t.chunks)
+	}
+}
+
+func (t *bodyTee) Close() error {
+	err := t.ReadCloser.Close()
+	t.finish()
+	return err
+}
+
+func (t *bodyTee) finish() {
+	t.once.Do(func() {
+		t.done()
+		t.lock.Lock()
+		if !t.closed {
+			t.closed = true
+			close(t.chunks)
+		}
+		t.lock.Unlock()
+	})
+}
+
+// 记录协程读取的数据，转发结束或丢弃数据后返回 io.EOF
+func (t *bodyTee) reader() io.Reader {
+	return &chunkReader{chunks: t.chunks}
+}
+
+type chunkReader struct {
+	chunks <-chan []byte
+	buf    []byte
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		chunk, ok := <-r.chunks
+		if !ok {
+			return 0, io.EOF
+		}
+		r.buf = chunk
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// bodyRecorder 请求内容在转发给上游服务器的同时写入 BodyStore，读取结束或关闭时调用 done
+type bodyRecorder struct {
+	io.ReadCloser
+	body *storage.Body
+	once sync.Once
+	done func()
+}
+
+func (r *bodyRecorder) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		r.body.Write(p[:n])
+	}
+	if err != nil {
+		r.finish()
+	}
+	return n, err
+}
+
+func (r *bodyRecorder) Close() error {
+	err := r.ReadCloser.Close()
+	r.finish()
+	return err
+}
+
+func (r *bodyRecorder) finish() {
+	r.once.Do(func() {
+		r.body.Close()
+		r.done()
+	})
+}
+
+// SSE 事件，https://html.spec.whatwg.org/multipage/server-sent-events.html
+type sseEvent struct {
+	event string
+	id    string
+	data  string
+}
+
+// 逐个解析 SSE 事件，注释和 retry 字段忽略，data 为空的事件不发送
+func readEvents(r io.Reader, emit func(sseEvent)) error {
+	br := bufio.NewReader(r)
+	var ev sseEvent
+	var data []string
+	for {
+		line, err := br.ReadString('\n')
+		if line != "" || err == nil {
+			line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+			if line == "" {
+				if len(data) > 0 {
+					ev.data = strings.Join(data, "\n")
+					emit(ev)
+				}
+				ev.event, ev.data, data = "", "", nil
+			} else if !strings.HasPrefix(line, ":") {
+				field, value, _ := strings.Cut(line, ":")
+				value = strings.TrimPrefix(value, " ")
+				switch field {
+				case "event":
+					ev.event = value
+				case "id":
+					ev.id = value
+				case "data":
+					data = append(data, value)
+				}
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// fragmenter 长度未知的响应持续一段时间没有结束时，定时发送新收到的数据
+type fragmenter struct {
+	lock    sync.Mutex
+	pending bytes.Buffer
+	timer   *time.Timer
+	stopped bool
+	seq     int
+	emit    func(seq int, data []byte)
+}
+
+// 未发送的数据达到 maxFragmentLen 时立即发送，不等待定时器
+func (f *fragmenter) add(data []byte) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.stopped {
+		return
+	}
+	for len(data) > 0 {
+		n := min(len(data), maxFragmentLen-f.pending.Len())
+		f.pending.Write(data[:n])
+		data = data[n:]
+		if f.pending.Len() == maxFragmentLen {
+			f.send()
+		}
+	}
+	if f.timer == nil && f.pending.Len() > 0 {
+		f.timer = time.AfterFunc(fragmentDelay, f.flush)
+	}
+}
+
+func (f *fragmenter) flush() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.timer = nil
+	if !f.stopped {
+		f.send()
+	}
+}
+
+// 持有锁发送，保证数据段在完整的响应之前发送
+func (f *fragmenter) send() {
+	if f.pending.Len() == 0 {
+		return
+	}
+	f.seq++
+	f.emit(f.seq, bytes.Clone(f.pending.Bytes()))
+	f.pending.Reset()
+}
+
+// 响应结束后完整内容随响应发送，未发送的数据丢弃
+func (f *fragmenter) stop() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.stopped = true
+	if f.timer != nil {
+		f.timer.Stop()
+		f.timer = nil
+	}
+	f.pending.Reset()
+}
@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReadEvents(t *testing.T) {
+	stream := ": comment\r\n" +
+		"retry: 1000\n\n" +
+		"event: update\nid: 7\ndata: first\ndata:second\n\n" +
+		"data: {\"a\":1}\r\n\r\n" +
+		"data: unterminated"
+	var events []sseEvent
+	if err := readEvents(strings.NewReader(stream), func(ev sseEvent) { events = append(events, ev) }); err != nil {
+		t.Fatalf("readEvents failed: %s", err.Error())
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d: %+v", len(events), events)
+	}
+	if events[0] != (sseEvent{event: "update", id: "7", data: "first\nsecond"}) {
+		t.Errorf("unexpected first event: %+v", events[0])
+	}
+	if events[1].event != "" || events[1].data != `{"a":1}` {
+		t.Errorf("unexpected second event: %+v", events[1])
+	}
+}
+
+func TestBodyTeeDrop(t *testing.T) {
+	done := false
+	tee := newBodyTee(io.NopCloser(strings.NewReader(strings.Repeat("x", teeChunks+10))), func() { done = true })
+	buf := make([]byte, 1)
+	for {
+		if _, err := tee.Read(buf); err != nil {
+			break
+		}
+	}
+	if !done || !tee.dropped.Load() {
+		t.Fatalf("done %v dropped %v", done, tee.dropped.Load())
+	}
+	// 第一次丢弃之后的数据不再发送
+	data, err := io.ReadAll(tee.reader())
+	if err != nil || len(data) != teeChunks {
+		t.Fatalf("got %d bytes: %v", len(data), err)
+	}
+}
+
+// 未发送的数据达到上限时立即发送，不丢弃
+func TestFragmenterFull(t *testing.T) {
+	var sizes []int
+	f := &fragmenter{emit: func(seq int, data []byte) { sizes = append(sizes, len(data)) }}
+	chunk := strings.Repeat("x", maxFragmentLen/2+1)
+	for i := 0; i < 3; i++ {
+		f.add([]byte(chunk))
+	}
+	f.flush()
+	f.stop()
+	if len(sizes) != 2 || sizes[0] != maxFragmentLen || sizes[0]+sizes[1] != 3*len(chunk) {
+		t.Fatalf("fragment sizes %v", sizes)
+	}
+}
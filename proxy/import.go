@@ -0,0 +1,55 @@
+package proxy
+
+import (
+	"crypto"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"github.com/dreamsxin/go-netsniffer/cert"
+)
+
+// 导入已有的根证书，certFile 为 PEM 或 PKCS#12 (.p12/.pfx)，PEM 格式时 keyFile 为空则从 certFile 中读取私钥，
+// password 用于 PKCS#12 或加密的 PEM 私钥，导入后保存到 store 作为签发站点证书的根证书，原来的根证书归档
+// 只接受自签名的根证书，中级 CA 需要上级证书才能被客户端信任
+func ImportCert(store *CertStore, certFile, keyFile, password string) (*x509.Certificate, crypto.Signer, error) {
+	data, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("导入证书失败: %w", err)
+	}
+
+	var crt *x509.Certificate
+	var privKey crypto.Signer
+	if cert.IsPEM(data) {
+		certs, err := cert.ParseCertificatesPEM(data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("导入证书失败: %w", err)
+		}
+		crt = certs[0]
+
+		keyData := data
+		if keyFile != "" {
+			if keyData, err = os.ReadFile(keyFile); err != nil {
+				return nil, nil, fmt.Errorf("导入证书失败: %w", err)
+			}
+		}
+		if privKey, err = cert.ParsePrivateKeyFromPEM(keyData, []byte(password)); err != nil {
+			return nil, nil, fmt.Errorf("导入私钥失败: %w", err)
+		}
+	} else {
+		if privKey, crt, _, err = cert.DecodePKCS12(data, password); err != nil {
+			return nil, nil, fmt.Errorf("导入证书失败: %w", err)
+		}
+	}
+
+	if err = cert.ValidateCA(crt, privKey); err != nil {
+		return nil, nil, fmt.Errorf("导入证书失败: %w", err)
+	}
+	if err = crt.CheckSignatureFrom(crt); err != nil {
+		return nil, nil, fmt.Errorf("导入证书失败: 不是自签名的根证书: %w", err)
+	}
+	if _, err = store.replace(crt, privKey); err != nil {
+		return nil, nil, fmt.Errorf("导入证书失败: %w", err)
+	}
+	return crt, privKey, nil
+}
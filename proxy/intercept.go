@@ -0,0 +1,288 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/dreamsxin/go-netsniffer/fingerprint"
+	"github.com/dreamsxin/go-netsniffer/models"
+	"github.com/google/martian/v3"
+)
+
+// tunnelListener 把解密后的连接交给 martian 继续处理
+type tunnelListener struct {
+	conns     chan net.Conn
+	done      chan struct{}
+	closeOnce sync.Once
+	clients   sync.Map // 客户端地址 -> *models.ClientFingerprint，连接关闭时删除
+}
+
+func newTunnelListener() *tunnelListener {
+	return &tunnelListener{conns: make(chan net.Conn), done: make(chan struct{})}
+}
+
+func (l *tunnelListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *tunnelListener) Close() error {
+	l.closeOnce.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *tunnelListener) Addr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)}
+}
+
+func (l *tunnelListener) push(conn net.Conn) error {
+	select {
+	case l.conns <- conn:
+		return nil
+	case <-l.done:
+		return net.ErrClosed
+	}
+}
+
+// tunnelConn 读取时先读取已缓冲的数据，关闭时通知拦截者
+type tunnelConn struct {
+	net.Conn
+	r         *bufio.Reader
+	closed    chan struct{}
+	closeOnce sync.Once
+	readLock  sync.Mutex
+	record    *bytes.Buffer // 握手期间记录客户端发送的数据，用于解析 ClientHello
+}
+
+// ClientHello 最多占用的数据，超过后不再记录
+const maxRecordLen = 1<<16 + 5
+
+func (c *tunnelConn) Read(b []byte) (int, error) {
+	c.readLock.Lock()
+	defer c.readLock.Unlock()
+	n, err := c.r.Read(b)
+	if c.record != nil && c.record.Len() < maxRecordLen {
+		c.record.Write(b[:n])
+	}
+	return n, err
+}
+
+func (c *tunnelConn) Close() error {
+	err := c.Conn.Close()
+	c.closeOnce.Do(func() { close(c.closed) })
+	return err
+}
+
+// 等待连接关闭并且正在进行的读取结束，之后 martian 才能继续使用同一个缓冲区
+func (c *tunnelConn) wait() {
+	<-c.closed
+	c.readLock.Lock()
+	c.readLock.Unlock()
+}
+
+// interceptor 接管 CONNECT 请求，自己完成与客户端的 TLS 握手后交给 martian 处理解密后的请求
+type interceptor struct {
+	mitm   *MITM
+	tunnel *tunnelListener
+}
+
+func (i *interceptor) ModifyRequest(req *http.Request) error {
+	if req.Method != http.MethodConnect {
+		return nil
+	}
+	ctx := martian.NewContext(req)
+	if ctx == nil || ctx.Session().Hijacked() {
+		return nil
+	}
+	// 抓取规则排除的主机不解密，由 martian 直接转发隧道，固定证书的客户端不受影响
+	if ctx.SkippingLogging() {
+		return nil
+	}
+
+	conn, brw, err := ctx.Session().Hijack()
+	if err != nil {
+		return err
+	}
+	// martian 在返回后会继续读取这个连接，返回前确保连接已关闭
+	defer conn.Close()
+
+	if _, err = brw.WriteString("HTTP/1.1 200 OK\r\n\r\n"); err != nil {
+		return err
+	}
+	if err = brw.Flush(); err != nil {
+		return err
+	}
+
+	tc := &tunnelConn{Conn: conn, r: brw.Reader, closed: make(chan struct{})}
+	b, err := brw.Peek(1)
+	if err != nil {
+		return nil
+	}
+
+	var next net.Conn = tc
+	// 22 is the TLS handshake.
+	// https://tools.ietf.org/html/rfc5246#section-6.2.1
+	if b[0] == 22 {
+		tc.record = new(bytes.Buffer)
+		tlsconn := tls.Server(tc, i.mitm.TLSForHost(req.Host))
+		err := tlsconn.Handshake()
+		record := tc.record.Bytes()
+		tc.record = nil
+		if err != nil {
+			log.Println("mitm handshake", req.Host, err)
+			return nil
+		}
+		next = tlsconn
+
+		if hello, err := fingerprint.ParseRecords(record); err == nil {
+			addr := conn.RemoteAddr().String()
+			i.tunnel.clients.Store(addr, hello.Fingerprint())
+			defer i.tunnel.clients.Delete(addr)
+		} else {
+			log.Println("ClientHello", req.Host, err)
+		}
+	}
+
+	if err = i.tunnel.push(next); err != nil {
+		return nil
+	}
+	tc.wait()
+	return nil
+}
+
+// 保存在 martian 上下文中的客户端指纹
+const clientFingerprintKey = "netsniffer.client.fingerprint"
+
+// clientInfo 把解密连接的客户端指纹放到每个请求的上下文中，需要在其他处理器之前执行
+type clientInfo struct {
+	tunnel *tunnelListener
+}
+
+func (c *clientInfo) ModifyRequest(req *http.Request) error {
+	v, ok := c.tunnel.clients.Load(req.RemoteAddr)
+	if !ok {
+		return nil
+	}
+	if ctx := martian.NewContext(req); ctx != nil {
+		ctx.Set(clientFingerprintKey, v)
+	}
+	return nil
+}
+
+// 读取请求所在连接的客户端指纹，不是解密的 HTTPS 请求时返回 nil
+func ClientFingerprint(req *http.Request) *models.ClientFingerprint {
+	if req == nil {
+		return nil
+	}
+	ctx := martian.NewContext(req)
+	if ctx == nil {
+		return nil
+	}
+	if v, ok := ctx.Get(clientFingerprintKey); ok {
+		return v.(*models.ClientFingerprint)
+	}
+	return nil
+}
+
+func (i *interceptor) ModifyResponse(res *http.Response) error {
+	return nil
+}
+
+// Proxy 在 martian 之外处理 CONNECT 隧道的 TLS 握手
+type Proxy struct {
+	*martian.Proxy
+	mitm         *MITM
+	tunnel       *tunnelListener
+	store        *CertStore
+	intermediate bool // 使用中级证书签发站点证书
+	upstream     *upstreamTransport
+	keyLog       *KeyLogFile
+	capture      *capturer
+}
+
+// 同时处理监听的连接和解密后的隧道连接
+func (p *Proxy) Serve(l net.Listener) error {
+	go func() {
+		if err := p.Proxy.Serve(p.tunnel); err != nil && !errors.Is(err, net.ErrClosed) {
+			log.Println("tunnel serve", err)
+		}
+	}()
+	return p.Proxy.Serve(l)
+}
+
+func (p *Proxy) Close() {
+	p.tunnel.Close()
+	p.Proxy.Close()
+	if p.keyLog != nil {
+		p.keyLog.Close()
+	}
+}
+
+// 设置连接上游服务器时按主机使用的 TLS 参数，新的连接立即生效
+func (p *Proxy) SetUpstream(conf []models.Upstream) error {
+	return p.upstream.setUpstream(conf)
+}
+
+// 设置抓取规则，新的请求生效
+func (p *Proxy) SetCapture(conf models.Capture) {
+	p.capture.rules.Store(NewCaptureRules(conf))
+}
+
+// 客户端和上游连接的 TLS 会话密钥以 NSS 格式追加写入文件，为空时不记录，新的连接生效
+func (p *Proxy) SetKeyLogFile(filename string) error {
+	var keyLog *KeyLogFile
+	var w io.Writer
+	if filename != "" {
+		var err error
+		if keyLog, err = OpenKeyLogFile(filename); err != nil {
+			return fmt.Errorf("打开密钥日志文件失败: %w", err)
+		}
+		w = keyLog
+	}
+	if err := p.upstream.setKeyLog(w); err != nil {
+		if keyLog != nil {
+			keyLog.Close()
+		}
+		return err
+	}
+	p.mitm.SetKeyLog(w)
+
+	// 正在握手的连接可能还会写入旧文件，关闭后的写入直接丢弃
+	old := p.keyLog
+	p.keyLog = keyLog
+	if old != nil {
+		old.Close()
+	}
+	return nil
+}
+
+// 更换签发站点证书的根证书，新的连接立即生效
+func (p *Proxy) SetAuthority(ca *x509.Certificate, caKey crypto.Signer) error {
+	p.mitm.SetAuthority(ca, caKey)
+	return p.useIntermediate(ca, caKey)
+}
+
+func (p *Proxy) useIntermediate(ca *x509.Certificate, caKey crypto.Signer) error {
+	if !p.intermediate {
+		return nil
+	}
+	inter, interKey, err := p.store.Intermediate(ca, caKey)
+	if err != nil {
+		return err
+	}
+	return p.mitm.SetIntermediate(inter, interKey)
+}
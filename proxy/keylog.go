@@ -0,0 +1,44 @@
+package proxy
+
+import (
+	"os"
+	"sync"
+)
+
+// KeyLogFile 以 NSS 格式追加写入 TLS 会话密钥，同一个文件可以同时用于客户端和上游连接
+// Wireshark 或抓包解密可以用它解密代理两侧的 TLS 流量
+type KeyLogFile struct {
+	lock sync.Mutex
+	file *os.File
+}
+
+// 文件包含会话密钥，只允许当前用户读写
+func OpenKeyLogFile(filename string) (*KeyLogFile, error) {
+	file, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &KeyLogFile{file: file}, nil
+}
+
+// tls 包每次写入一行，多个连接同时握手时按行加锁写入
+// 写入失败会导致握手失败，关闭后的写入直接丢弃
+func (k *KeyLogFile) Write(p []byte) (int, error) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	if k.file == nil {
+		return len(p), nil
+	}
+	return k.file.Write(p)
+}
+
+func (k *KeyLogFile) Close() error {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	if k.file == nil {
+		return nil
+	}
+	err := k.file.Close()
+	k.file = nil
+	return err
+}
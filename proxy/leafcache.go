@@ -0,0 +1,157 @@
+package proxy
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dreamsxin/go-netsniffer/cert"
+)
+
+const (
+	leafCacheDir = "leaf"
+
+	// 剩余有效期不足时重新签发
+	leafRenewBefore = time.Hour
+)
+
+// LeafCache 站点证书磁盘缓存，按签发 CA 的指纹分目录，按 SAN 集合命名，重启后证书和密钥保持不变
+// 站点证书共用的密钥和根证书私钥一样使用 passphrase 加密
+type LeafCache struct {
+	dir        string
+	passphrase string
+}
+
+func NewLeafCache(dir, passphrase string) *LeafCache {
+	return &LeafCache{dir: dir, passphrase: passphrase}
+}
+
+func (c *LeafCache) caDir(ca *x509.Certificate) string {
+	return filepath.Join(c.dir, cert.Thumbprint(ca))
+}
+
+func (c *LeafCache) path(ca *x509.Certificate, sans []string) string {
+	names := make([]string, len(sans))
+	for i, san := range sans {
+		names[i] = strings.ToLower(san)
+	}
+	sort.Strings(names)
+	sum := sha256.Sum256([]byte(strings.Join(names, "\n")))
+	return filepath.Join(c.caDir(ca), fmt.Sprintf("%x.pem", sum[:16]))
+}
+
+// 读取或生成该根证书下所有站点证书共用的密钥，文件权限不安全时拒绝读取
+// 密码修改后无法解密或者没有加密的旧密钥重新生成，之前签发的站点证书因密钥不匹配失效
+func (c *LeafCache) LeafKey(ca *x509.Certificate, keyType cert.KeyType) (crypto.Signer, error) {
+	filename := filepath.Join(c.caDir(ca), fmt.Sprintf("leafkey-%s.pem", keyType))
+	if pemBytes, err := os.ReadFile(filename); err == nil {
+		if err = cert.CheckKeyFilePermission(filename); err != nil {
+			return nil, fmt.Errorf("私钥文件权限不安全: %w", err)
+		}
+		if encrypted(pemBytes) == (c.passphrase != "") {
+			key, err := cert.ParsePrivateKey(pemBytes, []byte(c.passphrase))
+			if err == nil {
+				return key, nil
+			}
+			log.Println("LeafCache.LeafKey", err)
+		}
+	}
+
+	key, err := cert.GenerateKey(keyType)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.MkdirAll(c.caDir(ca), 0700); err != nil {
+		return nil, err
+	}
+	block, err := cert.MarshalPrivateKey(key, []byte(c.passphrase))
+	if err != nil {
+		return nil, err
+	}
+	if err = cert.SaveKeyToFile(filename, block); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func encrypted(pemBytes []byte) bool {
+	block, _ := pem.Decode(pemBytes)
+	return block != nil && block.Type == cert.PEMTypeEncryptedPrivateKey
+}
+
+// 读取缓存的站点证书，证书不能通过 verify 校验、密钥不匹配或即将过期时返回 false
+func (c *LeafCache) Get(ca *x509.Certificate, sans []string, key crypto.Signer, verify x509.VerifyOptions) (*x509.Certificate, bool) {
+	pemBytes, err := os.ReadFile(c.path(ca, sans))
+	if err != nil {
+		return nil, false
+	}
+	leaf, err := cert.ParseCertificatePEM(pemBytes)
+	if err != nil {
+		return nil, false
+	}
+	if time.Until(leaf.NotAfter) < leafRenewBefore {
+		return nil, false
+	}
+	if _, err = leaf.Verify(verify); err != nil {
+		return nil, false
+	}
+	if cert.KeyMatch(leaf, key) != nil {
+		return nil, false
+	}
+	return leaf, true
+}
+
+// 保存站点证书，密钥单独保存
+func (c *LeafCache) Put(ca *x509.Certificate, sans []string, leaf *x509.Certificate) error {
+	if err := os.MkdirAll(c.caDir(ca), 0700); err != nil {
+		return err
+	}
+	return cert.WriteCertToFile(leaf, c.path(ca, sans))
+}
+
+// 删除过期的站点证书和已不使用的根证书目录
+func (c *LeafCache) Prune(current *x509.Certificate) {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		dir := filepath.Join(c.dir, entry.Name())
+		if !entry.IsDir() {
+			continue
+		}
+		if current != nil && entry.Name() != cert.Thumbprint(current) {
+			if err = os.RemoveAll(dir); err != nil {
+				log.Println("LeafCache.Prune", err)
+			}
+			continue
+		}
+
+		files, _ := filepath.Glob(filepath.Join(dir, "*.pem"))
+		for _, filename := range files {
+			if strings.HasPrefix(filepath.Base(filename), "leafkey-") {
+				continue
+			}
+			pemBytes, err := os.ReadFile(filename)
+			if err != nil {
+				continue
+			}
+			leaf, err := cert.ParseCertificatePEM(pemBytes)
+			if err == nil && time.Until(leaf.NotAfter) > leafRenewBefore {
+				continue
+			}
+			if err = os.Remove(filename); err != nil && !errors.Is(err, os.ErrNotExist) {
+				log.Println("LeafCache.Prune", err)
+			}
+		}
+	}
+}
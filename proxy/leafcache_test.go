@@ -0,0 +1,139 @@
+package proxy
+
+import (
+	"crypto"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dreamsxin/go-netsniffer/cert"
+)
+
+func newTestCA(t *testing.T) (*x509.Certificate, crypto.Signer, x509.VerifyOptions) {
+	t.Helper()
+	ca, key, err := cert.NewRootCA(cert.WithCommonName("test"), cert.WithKeyType(cert.KeyTypeECDSA))
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	return ca, key, x509.VerifyOptions{Roots: roots}
+}
+
+func newTestLeaf(t *testing.T, ca *x509.Certificate, caKey, key crypto.Signer, host string, validity time.Duration) *x509.Certificate {
+	t.Helper()
+	leaf, _, err := cert.NewLeafCert(ca, caKey, cert.WithSANs(host), cert.WithKey(key),
+		cert.WithNotBefore(time.Now().Add(-time.Minute)), cert.WithValidity(validity))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf
+}
+
+func TestLeafCache(t *testing.T) {
+	cache := NewLeafCache(t.TempDir(), "secret")
+	ca, caKey, verify := newTestCA(t)
+	key, err := cache.LeafKey(ca, cert.KeyTypeECDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verify.DNSName = "example.com"
+	sans := []string{"example.com"}
+	if _, ok := cache.Get(ca, sans, key, verify); ok {
+		t.Fatal("empty cache hit")
+	}
+	leaf := newTestLeaf(t, ca, caKey, key, "example.com", 24*time.Hour)
+	if err = cache.Put(ca, sans, leaf); err != nil {
+		t.Fatal(err)
+	}
+	// SAN 不区分大小写
+	if got, ok := cache.Get(ca, []string{"EXAMPLE.com"}, key, verify); !ok || !got.Equal(leaf) {
+		t.Fatal("cached leaf not found")
+	}
+	other, err := cert.GenerateKey(cert.KeyTypeECDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cache.Get(ca, sans, other, verify); ok {
+		t.Error("leaf returned for another key")
+	}
+
+	// 即将过期的证书不使用，清理时删除
+	expiring := newTestLeaf(t, ca, caKey, key, "old.example.com", leafRenewBefore/2)
+	oldSANs := []string{"old.example.com"}
+	if err = cache.Put(ca, oldSANs, expiring); err != nil {
+		t.Fatal(err)
+	}
+	verify.DNSName = "old.example.com"
+	if _, ok := cache.Get(ca, oldSANs, key, verify); ok {
+		t.Error("expiring leaf returned")
+	}
+	cache.Prune(ca)
+	if _, err = os.Stat(cache.path(ca, oldSANs)); !os.IsNotExist(err) {
+		t.Errorf("expiring leaf not pruned: %v", err)
+	}
+	if _, err = os.Stat(cache.path(ca, sans)); err != nil {
+		t.Errorf("valid leaf pruned: %v", err)
+	}
+
+	// 更换 CA 后旧证书不能通过校验，清理时删除旧 CA 的目录
+	newCA, _, newVerify := newTestCA(t)
+	newVerify.DNSName = "example.com"
+	if _, ok := cache.Get(ca, sans, key, newVerify); ok {
+		t.Error("leaf from old CA accepted")
+	}
+	if _, err = cache.LeafKey(newCA, cert.KeyTypeECDSA); err != nil {
+		t.Fatal(err)
+	}
+	cache.Prune(newCA)
+	if _, err = os.Stat(cache.caDir(ca)); !os.IsNotExist(err) {
+		t.Errorf("old CA directory not pruned: %v", err)
+	}
+	if _, err = os.Stat(cache.caDir(newCA)); err != nil {
+		t.Errorf("current CA directory pruned: %v", err)
+	}
+}
+
+func TestLeafKey(t *testing.T) {
+	dir := t.TempDir()
+	ca, _, _ := newTestCA(t)
+	cache := NewLeafCache(dir, "secret")
+	key, err := cache.LeafKey(ca, cert.KeyTypeECDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(cache.caDir(ca), "leafkey-ecdsa.pem")
+	pemBytes, err := os.ReadFile(filename)
+	if err != nil || !strings.Contains(string(pemBytes), "ENCRYPTED PRIVATE KEY") {
+		t.Fatalf("leaf key not encrypted: %s %v", pemBytes, err)
+	}
+	again, err := cache.LeafKey(ca, cert.KeyTypeECDSA)
+	if err != nil || !samePublicKey(key, again) {
+		t.Fatalf("leaf key changed: %v", err)
+	}
+
+	// 密码修改后重新生成
+	changed, err := NewLeafCache(dir, "other").LeafKey(ca, cert.KeyTypeECDSA)
+	if err != nil || samePublicKey(key, changed) {
+		t.Fatalf("leaf key kept after passphrase change: %v", err)
+	}
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+	if err = os.Chmod(filename, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = cache.LeafKey(ca, cert.KeyTypeECDSA); err == nil {
+		t.Error("insecure leaf key accepted")
+	}
+}
+
+func samePublicKey(a, b crypto.Signer) bool {
+	return a.Public().(interface{ Equal(crypto.PublicKey) bool }).Equal(b.Public())
+}
@@ -0,0 +1,185 @@
+package proxy
+
+import (
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dreamsxin/go-netsniffer/cert"
+	"github.com/dreamsxin/go-netsniffer/models"
+)
+
+const archiveDir = "archive"
+
+// 查看根证书信息
+func InspectCert(store *CertStore) (*models.CertInfo, error) {
+	crt, err := store.Certificate()
+	if err != nil {
+		return nil, err
+	}
+	info := NewCertInfo(crt)
+	info.Path = store.CrtPath()
+	info.Installed = cert.IsCertInstalled(info.Thumbprint)
+	return info, nil
+}
+
+func NewCertInfo(crt *x509.Certificate) *models.CertInfo {
+	return &models.CertInfo{
+		Subject:      crt.Subject.String(),
+		Issuer:       crt.Issuer.String(),
+		SerialNumber: fmt.Sprintf("%X", crt.SerialNumber),
+		Fingerprint:  cert.Fingerprint(crt),
+		Thumbprint:   cert.Thumbprint(crt),
+		KeyType:      string(cert.KeyTypeOf(crt.PublicKey)),
+		NotBefore:    crt.NotBefore,
+		NotAfter:     crt.NotAfter,
+		DaysLeft:     int(math.Floor(time.Until(crt.NotAfter).Hours() / 24)),
+	}
+}
+
+// 检查根证书是否即将过期，返回提示信息，不需要提示时返回空
+func CheckCertExpiry(store *CertStore, warnDays int) string {
+	crt, err := store.Certificate()
+	if err != nil {
+		return ""
+	}
+	info := NewCertInfo(crt)
+	if info.DaysLeft < 0 {
+		return fmt.Sprintf("根证书 %s 已于 %s 过期，请轮换证书", crt.Subject.CommonName, crt.NotAfter.Local().Format(time.DateTime))
+	}
+	if info.DaysLeft <= warnDays {
+		return fmt.Sprintf("根证书 %s 将在 %d 天后过期，请轮换证书", crt.Subject.CommonName, info.DaysLeft)
+	}
+	return ""
+}
+
+// 把当前根证书和私钥移动到 archive 目录，避免生成新证书时直接覆盖
+func (s *CertStore) Archive() (*x509.Certificate, error) {
+	crt, _, err := s.archive()
+	return crt, err
+}
+
+// 返回归档文件的前缀，没有证书时为空
+func (s *CertStore) archive() (*x509.Certificate, string, error) {
+	crt, err := s.Certificate()
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, "", nil
+		}
+		return nil, "", err
+	}
+
+	dir := filepath.Join(s.Dir, archiveDir)
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return nil, "", err
+	}
+	prefix := filepath.Join(dir, cert.Thumbprint(crt)+"-")
+	if err = os.Rename(s.KeyPath(), prefix+keyFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, "", err
+	}
+	if err = os.Rename(s.CrtPath(), prefix+crtFile); err != nil {
+		os.Rename(prefix+keyFile, s.KeyPath())
+		return nil, "", err
+	}
+	return crt, prefix, nil
+}
+
+// 归档的证书移回原来的位置
+func (s *CertStore) unarchive(prefix string) {
+	if prefix == "" {
+		return
+	}
+	os.Rename(prefix+keyFile, s.KeyPath())
+	os.Rename(prefix+crtFile, s.CrtPath())
+}
+
+// 轮换根证书：先生成新证书并写入临时目录校验，成功后归档旧证书并换入新证书，失败时恢复旧证书
+// install 时安装新证书，removeOld 时按指纹卸载旧证书
+func RotateCert(store *CertStore, authorityName string, keyType cert.KeyType, install, removeOld bool) (*x509.Certificate, crypto.Signer, error) {
+	crt, privKey, err := NewAuthority(authorityName, fmt.Sprintf("The %s Company", authorityName), 365*24*time.Hour, keyType)
+	if err != nil {
+		return nil, nil, fmt.Errorf("轮换证书失败: %w", err)
+	}
+	old, err := store.replace(crt, privKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("轮换证书失败: %w", err)
+	}
+
+	if install {
+		if err = cert.InstallCert(store.CrtPath()); err != nil {
+			return crt, privKey, fmt.Errorf("安装新证书失败: %w", err)
+		}
+	}
+	if removeOld && old != nil {
+		thumbprint := cert.Thumbprint(old)
+		log.Println("RotateCert remove", thumbprint)
+		if err = cert.UninstallCertByThumbprint(thumbprint); err != nil {
+			return crt, privKey, fmt.Errorf("卸载旧证书失败: %w", err)
+		}
+	}
+	return crt, privKey, nil
+}
+
+// 校验新的根证书后归档当前证书并换入新证书，失败时恢复当前证书，返回归档的证书
+func (s *CertStore) replace(crt *x509.Certificate, privKey crypto.Signer) (*x509.Certificate, error) {
+	staged, err := stageAuthority(s, crt, privKey)
+	if staged != nil {
+		defer os.RemoveAll(staged.Dir)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	old, prefix, err := s.archive()
+	if err != nil {
+		return nil, err
+	}
+	if err = os.Rename(staged.KeyPath(), s.KeyPath()); err == nil {
+		if err = os.Rename(staged.CrtPath(), s.CrtPath()); err != nil {
+			os.Remove(s.KeyPath())
+		}
+	}
+	if err != nil {
+		s.unarchive(prefix)
+		return nil, err
+	}
+	return old, nil
+}
+
+// 新证书保存到存储目录下的临时目录，重新读取确认证书是有效的 CA、私钥匹配并且可以用密码解密
+func stageAuthority(store *CertStore, crt *x509.Certificate, privKey crypto.Signer) (*CertStore, error) {
+	if err := cert.ValidateCA(crt, privKey); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(store.Dir, 0700); err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp(store.Dir, "rotate-")
+	if err != nil {
+		return nil, err
+	}
+	staged := &CertStore{Dir: dir, Passphrase: store.Passphrase}
+	if err = staged.Save(crt, privKey); err != nil {
+		return staged, err
+	}
+	loaded, loadedKey, err := staged.Load()
+	if err != nil {
+		return staged, err
+	}
+	if !loaded.Equal(crt) {
+		return staged, errors.New("保存的新证书不一致")
+	}
+	if err = cert.ValidateCA(loaded, loadedKey); err != nil {
+		return staged, err
+	}
+	if err = loaded.CheckSignatureFrom(loaded); err != nil {
+		return staged, err
+	}
+	return staged, nil
+}
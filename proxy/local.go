@@ -0,0 +1,125 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/google/martian/v3"
+)
+
+// 本地请求处理，返回内容类型和内容，可以通过 header 设置其他响应头
+type LocalRoute func(req *http.Request, header http.Header) (contentType string, body []byte, err error)
+
+// LocalHandler 处理发往代理自身的请求，例如 PAC 脚本，这些请求不会转发也不会记录
+type LocalHandler struct {
+	lock   sync.RWMutex
+	hosts  map[string]bool
+	routes map[string]LocalRoute
+}
+
+func NewLocalHandler(port int) *LocalHandler {
+	h := &LocalHandler{hosts: map[string]bool{}, routes: map[string]LocalRoute{}}
+	hosts := []string{"127.0.0.1", "localhost", "::1"}
+	// 局域网设备通过本机地址访问代理
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok {
+				hosts = append(hosts, ipnet.IP.String())
+			}
+		}
+	}
+	for _, host := range hosts {
+		h.hosts[net.JoinHostPort(host, strconv.Itoa(port))] = true
+	}
+	return h
+}
+
+// 添加本地主机名，不带端口时匹配任意端口
+func (h *LocalHandler) AddHost(host string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.hosts[strings.ToLower(host)] = true
+}
+
+func (h *LocalHandler) Handle(path string, route LocalRoute) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.routes[path] = route
+}
+
+func (h *LocalHandler) match(req *http.Request) (LocalRoute, bool) {
+	if req.Method == http.MethodConnect {
+		return nil, false
+	}
+	host := strings.ToLower(req.URL.Host)
+	if host == "" {
+		host = strings.ToLower(req.Host)
+	}
+
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	if !h.hosts[host] {
+		hostname, _, err := net.SplitHostPort(host)
+		if err != nil || !h.hosts[hostname] {
+			return nil, false
+		}
+	}
+	route, ok := h.routes[req.URL.Path]
+	if !ok {
+		route = notFoundRoute
+	}
+	return route, true
+}
+
+func notFoundRoute(req *http.Request, header http.Header) (string, []byte, error) {
+	return "", nil, fmt.Errorf("%s not found", req.URL.Path)
+}
+
+func (h *LocalHandler) ModifyRequest(req *http.Request) error {
+	if _, ok := h.match(req); !ok {
+		return nil
+	}
+	if ctx := martian.NewContext(req); ctx != nil {
+		ctx.SkipRoundTrip()
+		ctx.SkipLogging()
+	}
+	return nil
+}
+
+func (h *LocalHandler) ModifyResponse(res *http.Response) error {
+	if res.Request == nil {
+		return nil
+	}
+	route, ok := h.match(res.Request)
+	if !ok {
+		return nil
+	}
+
+	if res.Header == nil {
+		res.Header = http.Header{}
+	}
+	contentType, body, err := route(res.Request, res.Header)
+	if err != nil {
+		res.StatusCode = http.StatusNotFound
+		contentType = "text/plain; charset=utf-8"
+		body = []byte(err.Error())
+	} else {
+		res.StatusCode = http.StatusOK
+	}
+	res.Status = fmt.Sprintf("%d %s", res.StatusCode, http.StatusText(res.StatusCode))
+	res.Header.Set("Content-Type", contentType)
+	res.Header.Set("Cache-Control", "no-cache")
+	res.Header.Del("Content-Encoding")
+	if res.Body != nil {
+		res.Body.Close()
+	}
+	res.Body = io.NopCloser(bytes.NewReader(body))
+	res.ContentLength = int64(len(body))
+	return nil
+}
@@ -0,0 +1,243 @@
+package proxy
+
+import (
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/dreamsxin/go-netsniffer/cert"
+)
+
+// MITM 根据根证书为每个站点签发证书，替代 martian 的 mitm.Config，站点证书可以使用 RSA、ECDSA 或 Ed25519 密钥
+type MITM struct {
+	ca          *x509.Certificate
+	issuer      *x509.Certificate // 签发站点证书的 CA，未使用中级证书时就是根证书
+	issuerKey   crypto.Signer
+	chain       [][]byte // 站点证书之后发送给客户端的证书链
+	verify      x509.VerifyOptions
+	leafKey     crypto.Signer // 所有站点证书共用一个密钥
+	leafKeyType cert.KeyType
+	validity    time.Duration
+	org         string
+	cache       *LeafCache
+	keyLog      io.Writer
+
+	lock  sync.RWMutex
+	certs map[string]*tls.Certificate
+	gen   uint64 // 更换签发 CA 或站点证书密钥时增加，之前开始签发的证书不再缓存
+}
+
+func NewMITM(ca *x509.Certificate, caKey crypto.Signer, leafKeyType cert.KeyType) (*MITM, error) {
+	leafKey, err := cert.GenerateKey(leafKeyType)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &MITM{
+		leafKey:     leafKey,
+		leafKeyType: leafKeyType,
+		validity:    time.Hour,
+		org:         "Martian Proxy",
+	}
+	m.setIssuer(ca, ca, caKey)
+	return m, nil
+}
+
+// 调用时需要持有锁
+func (m *MITM) setIssuer(ca, issuer *x509.Certificate, issuerKey crypto.Signer) {
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	inters := x509.NewCertPool()
+	chain := [][]byte{ca.Raw}
+	if issuer != ca {
+		inters.AddCert(issuer)
+		chain = [][]byte{issuer.Raw, ca.Raw}
+	}
+
+	if m.cache != nil {
+		// 读取新 CA 对应的密钥失败时不使用缓存
+		if err := m.useCache(m.cache, issuer); err != nil {
+			log.Println("MITM.setIssuer", err)
+			m.cache = nil
+		}
+	}
+	m.ca = ca
+	m.issuer = issuer
+	m.issuerKey = issuerKey
+	m.chain = chain
+	m.verify = x509.VerifyOptions{Roots: roots, Intermediates: inters}
+	m.certs = make(map[string]*tls.Certificate)
+	m.gen++
+}
+
+// 启用站点证书磁盘缓存，站点证书密钥改为使用缓存目录中保存的密钥
+func (m *MITM) SetCache(cache *LeafCache) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if err := m.useCache(cache, m.issuer); err != nil {
+		return err
+	}
+	cache.Prune(m.issuer)
+	return nil
+}
+
+func (m *MITM) useCache(cache *LeafCache, issuer *x509.Certificate) error {
+	leafKey, err := cache.LeafKey(issuer, m.leafKeyType)
+	if err != nil {
+		return fmt.Errorf("读取站点证书密钥失败: %w", err)
+	}
+	m.cache = cache
+	m.leafKey = leafKey
+	m.certs = make(map[string]*tls.Certificate)
+	m.gen++
+	return nil
+}
+
+// 更换根证书，已签发的站点证书全部作废，之前设置的中级证书不再使用
+func (m *MITM) SetAuthority(ca *x509.Certificate, caKey crypto.Signer) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.setIssuer(ca, ca, caKey)
+}
+
+// 使用根证书签发的中级证书签发站点证书
+func (m *MITM) SetIntermediate(inter *x509.Certificate, interKey crypto.Signer) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if err := inter.CheckSignatureFrom(m.ca); err != nil {
+		return fmt.Errorf("中级证书不是当前根证书签发: %w", err)
+	}
+	m.setIssuer(m.ca, inter, interKey)
+	return nil
+}
+
+// 证书有效期为当前时间前后 validity
+func (m *MITM) SetValidity(validity time.Duration) {
+	m.validity = validity
+}
+
+func (m *MITM) SetOrganization(org string) {
+	m.org = org
+}
+
+// 与客户端连接的 TLS 会话密钥写入 w，为 nil 时不记录，新的连接生效
+func (m *MITM) SetKeyLog(w io.Writer) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.keyLog = w
+}
+
+// 与客户端握手使用的配置，客户端没有发送 SNI 时使用 CONNECT 的主机名
+func (m *MITM) TLSForHost(hostname string) *tls.Config {
+	m.lock.RLock()
+	keyLog := m.keyLog
+	m.lock.RUnlock()
+	return &tls.Config{
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			host := hello.ServerName
+			if host == "" {
+				host = hostname
+			}
+			if host == "" {
+				return nil, errors.New("mitm: SNI not provided, failed to build certificate")
+			}
+			return m.cert(host)
+		},
+		NextProtos:   []string{"http/1.1"},
+		KeyLogWriter: keyLog,
+	}
+}
+
+func (m *MITM) cert(hostname string) (*tls.Certificate, error) {
+	// Remove the port if it exists.
+	if host, _, err := net.SplitHostPort(hostname); err == nil {
+		hostname = host
+	}
+
+	for {
+		tlsc, ok, err := m.issue(hostname)
+		if err != nil || ok {
+			return tlsc, err
+		}
+		// 签发期间更换了 CA，按新的 CA 重新签发
+	}
+}
+
+// 按当前的签发 CA 签发站点证书，签发期间 CA 被更换时不保存并返回 false
+func (m *MITM) issue(hostname string) (*tls.Certificate, bool, error) {
+	m.lock.RLock()
+	tlsc, ok := m.certs[hostname]
+	issuer, issuerKey, chain, verify := m.issuer, m.issuerKey, m.chain, m.verify
+	leafKey, cache, gen := m.leafKey, m.cache, m.gen
+	m.lock.RUnlock()
+	verify.DNSName = hostname
+	if ok {
+		// 缓存的证书过期后重新签发
+		if _, err := tlsc.Leaf.Verify(verify); err == nil {
+			return tlsc, true, nil
+		}
+	}
+
+	sans := []string{hostname}
+	var leaf *x509.Certificate
+	if cache != nil {
+		leaf, _ = cache.Get(issuer, sans, leafKey, verify)
+	}
+	if leaf == nil {
+		var err error
+		leaf, _, err = cert.NewLeafCert(issuer, issuerKey,
+			cert.WithCommonName(hostname),
+			cert.WithOrganization(m.org),
+			cert.WithSANs(sans...),
+			cert.WithKey(leafKey),
+			cert.WithNotBefore(time.Now().Add(-m.validity)),
+			cert.WithValidity(2*m.validity),
+		)
+		if err != nil {
+			return nil, false, err
+		}
+		if cache != nil {
+			if err = cache.Put(issuer, sans, leaf); err != nil {
+				log.Println("LeafCache.Put", hostname, err)
+			}
+		}
+	}
+
+	tlsc = &tls.Certificate{
+		Certificate: append([][]byte{leaf.Raw}, chain...),
+		PrivateKey:  leafKey,
+		Leaf:        leaf,
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.gen != gen {
+		return nil, false, nil
+	}
+	m.certs[hostname] = tlsc
+	return tlsc, true, nil
+}
+
+// 生成根证书
+func NewAuthority(name, organization string, validity time.Duration, keyType cert.KeyType) (*x509.Certificate, crypto.Signer, error) {
+	crt, priv, err := cert.NewRootCA(
+		cert.WithCommonName(name),
+		cert.WithOrganization(organization),
+		cert.WithDNSNames(name),
+		cert.WithExtKeyUsage(x509.ExtKeyUsageServerAuth),
+		cert.WithNotBefore(time.Now().Add(-validity)),
+		cert.WithValidity(2*validity),
+		cert.WithKeyType(keyType),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	log.Println("NewAuthority", name, keyType)
+	return crt, priv, nil
+}
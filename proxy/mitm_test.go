@@ -0,0 +1,50 @@
+package proxy
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dreamsxin/go-netsniffer/cert"
+)
+
+func TestMITMSetAuthority(t *testing.T) {
+	ca, caKey, err := NewAuthority("Old", "Test", time.Hour, cert.KeyTypeECDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewMITM(ca, caKey, cert.KeyTypeECDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, nextKey, err := NewAuthority("New", "Test", time.Hour, cert.KeyTypeECDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 签发的同时更换 CA，之后缓存中只能有新 CA 签发的证书
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range 20 {
+				if _, err := m.cert(fmt.Sprintf("host%d-%d.example.com", i, j%5)); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	m.SetAuthority(next, nextKey)
+	wg.Wait()
+
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	for host, tlsc := range m.certs {
+		if err := tlsc.Leaf.CheckSignatureFrom(next); err != nil {
+			t.Errorf("%s cached with old CA: %v", host, err)
+		}
+	}
+}
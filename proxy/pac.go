@@ -0,0 +1,91 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const (
+	PACPath        = "/proxy.pac"
+	PACContentType = "application/x-ns-proxy-autoconfig"
+)
+
+// PAC 脚本地址，由代理自身提供
+func PACURL(port int) string {
+	return fmt.Sprintf("http://127.0.0.1:%d%s", port, PACPath)
+}
+
+// PAC 脚本中的代理地址，host 为访问 PAC 时的 IP:端口 时直接使用
+// 否则（如通过 netsniffer.cert 或 localhost 访问）使用本机连接 remoteAddr 时的地址和代理端口
+func PACProxyAddr(host, remoteAddr string, port int) string {
+	if hostname, _, err := net.SplitHostPort(host); err == nil && net.ParseIP(hostname) != nil {
+		return host
+	}
+	ip := "127.0.0.1"
+	if clientIP, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		// UDP 连接不发送数据，只按路由选择本机地址
+		if conn, err := net.Dial("udp", net.JoinHostPort(clientIP, "9")); err == nil {
+			ip = conn.LocalAddr().(*net.UDPAddr).IP.String()
+			conn.Close()
+		}
+	}
+	return net.JoinHostPort(ip, strconv.Itoa(port))
+}
+
+// 根据主机列表生成 PAC 自动配置脚本，exclude 优先于 include，include 为空时全部经过代理
+func PACScript(proxyAddr string, include, exclude []string) string {
+	var b strings.Builder
+
+	b.WriteString("function FindProxyForURL(url, host) {\n")
+	b.WriteString("\tvar proxy = " + strconv.Quote("PROXY "+proxyAddr+"; DIRECT") + ";\n")
+	b.WriteString("\tif (isPlainHostName(host) || host == \"127.0.0.1\" || host == \"localhost\") {\n\t\treturn \"DIRECT\";\n\t}\n")
+	for _, pattern := range cleanPatterns(exclude) {
+		writePACMatch(&b, pattern, "\"DIRECT\"")
+	}
+	include = cleanPatterns(include)
+	if len(include) == 0 {
+		b.WriteString("\treturn proxy;\n}\n")
+		return b.String()
+	}
+	for _, pattern := range include {
+		writePACMatch(&b, pattern, "proxy")
+	}
+	b.WriteString("\treturn \"DIRECT\";\n}\n")
+	return b.String()
+}
+
+// *.example.com 同时匹配 example.com 本身
+func writePACMatch(b *strings.Builder, pattern string, ret string) {
+	cond := "shExpMatch(host, " + strconv.Quote(pattern) + ")"
+	if base, ok := strings.CutPrefix(pattern, "*."); ok {
+		cond += " || host == " + strconv.Quote(base)
+	}
+	b.WriteString("\tif (" + cond + ") {\n\t\treturn " + ret + ";\n\t}\n")
+}
+
+// 与 PAC 脚本相同的匹配规则，*.example.com 同时匹配 example.com 本身
+func MatchHost(pattern, host string) bool {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	host = strings.ToLower(host)
+	if pattern == "" {
+		return false
+	}
+	if ok, _ := path.Match(pattern, host); ok {
+		return true
+	}
+	base, ok := strings.CutPrefix(pattern, "*.")
+	return ok && host == base
+}
+
+func cleanPatterns(patterns []string) (ret []string) {
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern != "" {
+			ret = append(ret, pattern)
+		}
+	}
+	return
+}
@@ -0,0 +1,74 @@
+package proxy
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPACScript(t *testing.T) {
+	cases := []struct {
+		include, exclude []string
+		contains         []string
+		missing          []string
+	}{
+		{
+			contains: []string{`var proxy = "PROXY 127.0.0.1:9000; DIRECT";`, "\treturn proxy;\n}\n"},
+			missing:  []string{"shExpMatch"},
+		},
+		{
+			include:  []string{" *.Example.com ", "", "api.test"},
+			contains: []string{`if (shExpMatch(host, "*.example.com") || host == "example.com") {` + "\n\t\treturn proxy;", `if (shExpMatch(host, "api.test")) {` + "\n\t\treturn proxy;", "\treturn \"DIRECT\";\n}\n"},
+			missing:  []string{"Example", `shExpMatch(host, "")`},
+		},
+		{
+			exclude:  []string{"*.bank.com", "  "},
+			contains: []string{`if (shExpMatch(host, "*.bank.com") || host == "bank.com") {` + "\n\t\treturn \"DIRECT\";", "\treturn proxy;\n}\n"},
+		},
+	}
+	for i, c := range cases {
+		script := PACScript("127.0.0.1:9000", c.include, c.exclude)
+		for _, s := range c.contains {
+			if !strings.Contains(script, s) {
+				t.Errorf("case %d: missing %q in\n%s", i, s, script)
+			}
+		}
+		for _, s := range c.missing {
+			if strings.Contains(script, s) {
+				t.Errorf("case %d: unexpected %q in\n%s", i, s, script)
+			}
+		}
+	}
+
+	// exclude 写在 include 之前，优先匹配
+	script := PACScript("127.0.0.1:9000", []string{"*.example.com"}, []string{"login.example.com"})
+	if strings.Index(script, "login.example.com") > strings.Index(script, "*.example.com") {
+		t.Errorf("exclude after include:\n%s", script)
+	}
+}
+
+func TestPACProxyAddr(t *testing.T) {
+	cases := []struct {
+		host, remoteAddr, want string
+	}{
+		{"192.168.1.2:9000", "192.168.1.5:50000", "192.168.1.2:9000"},
+		{"[::1]:9000", "[::1]:50000", "[::1]:9000"},
+		// 通过根证书下载页面的主机名访问时使用本机地址
+		{CertHost, "127.0.0.1:50000", "127.0.0.1:9000"},
+		{"localhost:9000", "", "127.0.0.1:9000"},
+	}
+	for _, c := range cases {
+		if got := PACProxyAddr(c.host, c.remoteAddr, 9000); got != c.want {
+			t.Errorf("PACProxyAddr(%q, %q) = %s, want %s", c.host, c.remoteAddr, got, c.want)
+		}
+	}
+}
+
+func TestCleanPatterns(t *testing.T) {
+	got := cleanPatterns([]string{" A.com", "", "  ", "*.B.org "})
+	if strings.Join(got, ",") != "a.com,*.b.org" {
+		t.Errorf("cleanPatterns: %q", got)
+	}
+	if got := cleanPatterns(nil); got != nil {
+		t.Errorf("cleanPatterns(nil): %q", got)
+	}
+}
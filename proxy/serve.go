@@ -1,17 +1,16 @@
 package proxy
 
 import (
-	"crypto/rsa"
-	"crypto/x509"
-	"encoding/pem"
 	"fmt"
 	"net/http"
 	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/dreamsxin/go-netsniffer/cert"
+	"github.com/dreamsxin/go-netsniffer/models"
 	"github.com/google/martian/v3"
-	"github.com/google/martian/v3/mitm"
+	"github.com/google/martian/v3/fifo"
 )
 
 // 定义接口
@@ -20,97 +19,89 @@ type ServeHandler interface {
 	ModifyResponse(res *http.Response) error
 }
 
-const (
-	keyPath = "./rootkey.pem"
-	crtPath = "./rootcrt.pem"
-)
+// 启用磁盘缓存时站点证书的有效期，为当前时间前后 30 天
+const leafCacheValidity = 30 * 24 * time.Hour
 
-func New(authorityName string, handler ServeHandler) (*martian.Proxy, error) {
+// conf 中的站点证书密钥类型、磁盘缓存和中级证书设置在启动时生效
+func New(store *CertStore, authorityName string, conf models.Cert, handlers ...ServeHandler) (*Proxy, error) {
 
-	_, err := os.Stat(crtPath)
+	leafKeyType, err := cert.ParseKeyType(conf.LeafKeyType)
 	if err != nil {
-		return nil, fmt.Errorf("请安装证书: %w", err)
+		return nil, err
 	}
-
-	var crt *x509.Certificate
-	var privKey *rsa.PrivateKey
-
-	// 读取证书
-	pemBytes, err := os.ReadFile(keyPath)
+	crt, privKey, err := store.Load()
 	if err != nil {
-		return nil, fmt.Errorf("证书读取失败: %w", err)
+		return nil, err
 	}
 
-	block, _ := pem.Decode(pemBytes)
-	if block == nil {
-		return nil, fmt.Errorf("证书读取失败: %w", err)
-	}
-	if block.Type == "RSA PRIVATE KEY" {
-		privKey, err = x509.ParsePKCS1PrivateKey(block.Bytes)
-		if err != nil {
-			return nil, fmt.Errorf("私钥解析失败: %w", err)
-		}
-	} else {
-		return nil, fmt.Errorf("证书读取失败: Unsupported key type: %s", block.Type)
-	}
-
-	pemBytes, err = os.ReadFile(crtPath)
+	mitmConf, err := NewMITM(crt, privKey, leafKeyType)
 	if err != nil {
-		return nil, fmt.Errorf("证书读取失败: %w", err)
+		return nil, fmt.Errorf("初始化证书生成失败: %w", err)
 	}
+	mitmConf.SetOrganization(authorityName)
 
-	block, _ = pem.Decode(pemBytes)
-	if block == nil {
-		return nil, fmt.Errorf("证书读取失败: %w", err)
+	tunnel := newTunnelListener()
+	group := fifo.NewGroup()
+	group.AddRequestModifier(timer{})
+	// 在记录处理器之前判断是否记录
+	capture := &capturer{}
+	group.AddRequestModifier(capture)
+	group.AddRequestModifier(&clientInfo{tunnel: tunnel})
+	for _, handler := range handlers {
+		group.AddRequestModifier(handler)
+		group.AddResponseModifier(handler)
 	}
-	if block.Type == "CERTIFICATE" {
-		crt, err = x509.ParseCertificate(block.Bytes)
-		if err != nil {
-			return nil, fmt.Errorf("证书读取失败: %w", err)
-		}
-	} else {
-		return nil, fmt.Errorf("证书读取失败: Unsupported key type: %s", block.Type)
+	// 最后接管 CONNECT 请求，其他处理器先看到 CONNECT 请求
+	group.AddRequestModifier(&interceptor{mitm: mitmConf, tunnel: tunnel})
+	// 流式响应在其他处理器之后转发
+	group.AddResponseModifier(&streamer{})
+
+	proxy := &Proxy{Proxy: martian.NewProxy(), mitm: mitmConf, tunnel: tunnel, store: store, intermediate: conf.Intermediate, capture: capture}
+	if err = proxy.useIntermediate(crt, privKey); err != nil {
+		return nil, err
 	}
-
-	mitmConf, err := mitm.NewConfig(crt, privKey)
-	mitmConf.SetOrganization(authorityName)
-	if err != nil {
-		return nil, fmt.Errorf("初始化证书生成失败: %w", err)
+	// 中级证书确定后再启用缓存，清理缓存时保留当前签发 CA 的目录
+	if conf.LeafCache {
+		if err = mitmConf.SetCache(NewLeafCache(filepath.Join(store.Dir, leafCacheDir), store.Passphrase)); err != nil {
+			return nil, err
+		}
+		mitmConf.SetValidity(leafCacheValidity)
 	}
-
-	proxy := martian.NewProxy()
-	proxy.SetMITM(mitmConf)
-	proxy.SetRequestModifier(handler)
-	proxy.SetResponseModifier(handler)
+	// 使用自己的 Transport，外层记录上游 TLS 连接信息并按主机使用上游设置
+	proxy.upstream = newUpstreamTransport(newTransport())
+	proxy.Proxy.SetRoundTripper(proxy.upstream)
+	proxy.SetRequestModifier(group)
+	proxy.SetResponseModifier(group)
 
 	return proxy, nil
 }
 
-func GenerateCert(authorityName string) error {
+func GenerateCert(store *CertStore, authorityName string, keyType cert.KeyType) error {
 
-	crt, privKey, err := mitm.NewAuthority(authorityName, fmt.Sprintf("The %s Company", authorityName), 365*24*time.Hour)
-	if err != nil {
+	// 旧证书移动到归档目录，不直接覆盖
+	if _, err := store.Archive(); err != nil {
 		return fmt.Errorf("证书生成失败: %w", err)
 	}
 
-	if err = cert.SaveBlockToFile(keyPath, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privKey)}); err != nil {
+	crt, privKey, err := NewAuthority(authorityName, fmt.Sprintf("The %s Company", authorityName), 365*24*time.Hour, keyType)
+	if err != nil {
 		return fmt.Errorf("证书生成失败: %w", err)
 	}
 
-	if err = cert.WriteCertToFile(crt, crtPath); err != nil {
+	if err = store.Save(crt, privKey); err != nil {
 		return fmt.Errorf("证书生成失败: %w", err)
 	}
 	return nil
 }
 
-func InstallCert(authorityName string) error {
-	_, err := os.Stat(crtPath)
+func InstallCert(store *CertStore, authorityName string) error {
+	_, err := os.Stat(store.CrtPath())
 
 	if err != nil { // 文件不存在时跳转到生成
 		return fmt.Errorf("安装证书失败: %w", err)
 	}
 
-	if err := cert.InstallCert(crtPath); err != nil {
+	if err := cert.InstallCert(store.CrtPath()); err != nil {
 		return err
 	} else {
 		fmt.Println("install cert success")
@@ -118,8 +109,14 @@ func InstallCert(authorityName string) error {
 	return nil
 }
 
-func UninstallCert(authorityName string) error {
-	err := cert.UninstallCert(authorityName)
+// 优先按当前根证书的指纹卸载，没有证书文件时按名称卸载
+func UninstallCert(store *CertStore, authorityName string) error {
+	var err error
+	if crt, cerr := store.Certificate(); cerr == nil {
+		err = cert.UninstallCertByThumbprint(cert.Thumbprint(crt))
+	} else {
+		err = cert.UninstallCert(authorityName)
+	}
 	if err != nil { // 文件不存在时跳转到生成
 		return fmt.Errorf("卸载证书失败: %w", err)
 	}
@@ -0,0 +1,346 @@
+package proxy
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dreamsxin/go-netsniffer/cert"
+)
+
+const (
+	appDirName = "go-netsniffer"
+	keyFile    = "rootkey.pem"
+	crtFile    = "rootcrt.pem"
+
+	interKeyFile = "interkey.pem"
+	interCrtFile = "intercrt.pem"
+
+	// 中级证书有效期，剩余不足 interRenewBefore 时重新签发
+	interValidity    = 365 * 24 * time.Hour
+	interRenewBefore = 60 * 24 * time.Hour
+
+	// 私钥密码不写入配置文件，从环境变量或系统加密保存的文件中读取
+	PassphraseEnv     = "NETSNIFFER_CERT_PASSPHRASE"
+	passphraseFile    = "passphrase.pem"
+	passphrasePEMType = "PROTECTED PASSPHRASE"
+
+	// 上游客户端证书的密码按主机保存，环境变量名为前缀加主机名，字母转为大写，其他字符转为 _
+	// 如 *.example.com 为 NETSNIFFER_UPSTREAM_PASSWORD___EXAMPLE_COM
+	UpstreamPasswordEnv  = "NETSNIFFER_UPSTREAM_PASSWORD_"
+	upstreamPasswordFile = "upstream-passwords.pem"
+
+	// 旧版本保存在工作目录的证书
+	legacyKeyPath = "./rootkey.pem"
+	legacyCrtPath = "./rootcrt.pem"
+)
+
+// CertStore 根证书存储位置
+type CertStore struct {
+	Dir        string
+	Passphrase string
+}
+
+// dir 为空时使用用户配置目录
+func NewCertStore(dir, passphrase string) (*CertStore, error) {
+	if dir == "" {
+		configDir, err := os.UserConfigDir()
+		if err != nil {
+			return nil, fmt.Errorf("获取用户配置目录失败: %w", err)
+		}
+		dir = filepath.Join(configDir, appDirName)
+	}
+	return &CertStore{Dir: dir, Passphrase: passphrase}, nil
+}
+
+func (s *CertStore) KeyPath() string {
+	return filepath.Join(s.Dir, keyFile)
+}
+
+func (s *CertStore) CrtPath() string {
+	return filepath.Join(s.Dir, crtFile)
+}
+
+func (s *CertStore) Exists() bool {
+	_, err := os.Stat(s.CrtPath())
+	return err == nil
+}
+
+// 读取根证书和私钥，私钥文件权限不安全时拒绝读取
+func (s *CertStore) Load() (*x509.Certificate, crypto.Signer, error) {
+	_, err := os.Stat(s.CrtPath())
+	if err != nil {
+		return nil, nil, fmt.Errorf("请安装证书: %w", err)
+	}
+
+	if err = cert.CheckKeyFilePermission(s.KeyPath()); err != nil {
+		return nil, nil, fmt.Errorf("私钥文件权限不安全: %w", err)
+	}
+	pemBytes, err := os.ReadFile(s.KeyPath())
+	if err != nil {
+		return nil, nil, fmt.Errorf("证书读取失败: %w", err)
+	}
+	privKey, err := cert.ParsePrivateKey(pemBytes, []byte(s.Passphrase))
+	if err != nil {
+		return nil, nil, fmt.Errorf("私钥解析失败: %w", err)
+	}
+
+	pemBytes, err = os.ReadFile(s.CrtPath())
+	if err != nil {
+		return nil, nil, fmt.Errorf("证书读取失败: %w", err)
+	}
+	crt, err := cert.ParseCertificatePEM(pemBytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("证书读取失败: %w", err)
+	}
+	return crt, privKey, nil
+}
+
+// 只读取根证书，导出和查看证书时不需要私钥
+func (s *CertStore) Certificate() (*x509.Certificate, error) {
+	pemBytes, err := os.ReadFile(s.CrtPath())
+	if err != nil {
+		return nil, fmt.Errorf("证书读取失败: %w", err)
+	}
+	return cert.ParseCertificatePEM(pemBytes)
+}
+
+// 读取私钥密码，依次使用环境变量和 SavePassphrase 保存的密码，都没有时为空
+func (s *CertStore) LoadPassphrase() (string, error) {
+	if passphrase, ok := os.LookupEnv(PassphraseEnv); ok {
+		return passphrase, nil
+	}
+	blocks, err := s.readSecrets(passphraseFile)
+	if err != nil || len(blocks) == 0 {
+		return "", err
+	}
+	return unprotectBlock(blocks[0])
+}
+
+// 使用系统的数据保护接口加密保存私钥密码，只有当前用户可以读取，为空时删除
+func (s *CertStore) SavePassphrase(passphrase string) error {
+	if passphrase == "" {
+		return s.writeSecrets(passphraseFile, nil)
+	}
+	block, err := protectBlock(passphrase)
+	if err != nil {
+		return fmt.Errorf("保存私钥密码失败: %w", err)
+	}
+	return s.writeSecrets(passphraseFile, []*pem.Block{block})
+}
+
+func UpstreamPasswordEnvName(host string) string {
+	var b strings.Builder
+	b.WriteString(UpstreamPasswordEnv)
+	for _, r := range strings.ToUpper(strings.TrimSpace(host)) {
+		if r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
+
+// 读取上游设置 host 的客户端证书密码，依次使用环境变量和 SaveUpstreamPassword 保存的密码，都没有时为空
+func (s *CertStore) LoadUpstreamPassword(host string) (string, error) {
+	if password, ok := os.LookupEnv(UpstreamPasswordEnvName(host)); ok {
+		return password, nil
+	}
+	blocks, err := s.readSecrets(upstreamPasswordFile)
+	if err != nil {
+		return "", err
+	}
+	for _, block := range blocks {
+		if strings.EqualFold(block.Headers["Host"], host) {
+			return unprotectBlock(block)
+		}
+	}
+	return "", nil
+}
+
+// 和私钥密码一样加密保存上游设置 host 的客户端证书密码，为空时删除
+func (s *CertStore) SaveUpstreamPassword(host, password string) error {
+	blocks, err := s.readSecrets(upstreamPasswordFile)
+	if err != nil {
+		return err
+	}
+	var kept []*pem.Block
+	for _, block := range blocks {
+		if !strings.EqualFold(block.Headers["Host"], host) {
+			kept = append(kept, block)
+		}
+	}
+	if password != "" {
+		block, err := protectBlock(password)
+		if err != nil {
+			return fmt.Errorf("保存客户端证书密码失败: %w", err)
+		}
+		block.Headers = map[string]string{"Host": host}
+		kept = append(kept, block)
+	}
+	return s.writeSecrets(upstreamPasswordFile, kept)
+}
+
+// 读取加密保存的密码文件，不存在时返回空
+func (s *CertStore) readSecrets(name string) ([]*pem.Block, error) {
+	data, err := os.ReadFile(filepath.Join(s.Dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取密码失败: %w", err)
+	}
+	var blocks []*pem.Block
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != passphrasePEMType {
+			return nil, fmt.Errorf("密码文件格式错误: %s", name)
+		}
+		blocks = append(blocks, block)
+	}
+	if len(blocks) == 0 {
+		return nil, fmt.Errorf("密码文件格式错误: %s", name)
+	}
+	return blocks, nil
+}
+
+// 没有密码时删除文件
+func (s *CertStore) writeSecrets(name string, blocks []*pem.Block) error {
+	filename := filepath.Join(s.Dir, name)
+	if len(blocks) == 0 {
+		if err := os.Remove(filename); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	if err := os.MkdirAll(s.Dir, 0700); err != nil {
+		return err
+	}
+	return cert.SaveKeyToFile(filename, blocks...)
+}
+
+func protectBlock(secret string) (*pem.Block, error) {
+	data, err := cert.ProtectSecret([]byte(secret))
+	if err != nil {
+		return nil, err
+	}
+	return &pem.Block{Type: passphrasePEMType, Bytes: data}, nil
+}
+
+func unprotectBlock(block *pem.Block) (string, error) {
+	data, err := cert.UnprotectSecret(block.Bytes)
+	if err != nil {
+		return "", fmt.Errorf("解密密码失败: %w", err)
+	}
+	return string(data), nil
+}
+
+// 保存根证书和私钥，私钥以 PKCS#8 格式保存，设置了密码时加密
+func (s *CertStore) Save(crt *x509.Certificate, privKey crypto.Signer) error {
+	if err := os.MkdirAll(s.Dir, 0700); err != nil {
+		return err
+	}
+
+	block, err := cert.MarshalPrivateKey(privKey, []byte(s.Passphrase))
+	if err != nil {
+		return err
+	}
+	if err = cert.SaveKeyToFile(s.KeyPath(), block); err != nil {
+		return err
+	}
+	return cert.WriteCertToFile(crt, s.CrtPath())
+}
+
+// 读取根证书签发的中级证书，不存在、不是该根证书签发或即将过期时重新签发，私钥和根证书一样加密保存
+func (s *CertStore) Intermediate(ca *x509.Certificate, caKey crypto.Signer) (*x509.Certificate, crypto.Signer, error) {
+	keyPath := filepath.Join(s.Dir, interKeyFile)
+	crtPath := filepath.Join(s.Dir, interCrtFile)
+
+	if pemBytes, err := os.ReadFile(crtPath); err == nil {
+		inter, err := cert.ParseCertificatePEM(pemBytes)
+		if err == nil && inter.CheckSignatureFrom(ca) == nil && time.Until(inter.NotAfter) > interRenewBefore {
+			if err = cert.CheckKeyFilePermission(keyPath); err != nil {
+				return nil, nil, fmt.Errorf("私钥文件权限不安全: %w", err)
+			}
+			pemBytes, err = os.ReadFile(keyPath)
+			if err != nil {
+				return nil, nil, fmt.Errorf("中级证书读取失败: %w", err)
+			}
+			interKey, err := cert.ParsePrivateKey(pemBytes, []byte(s.Passphrase))
+			if err != nil {
+				return nil, nil, fmt.Errorf("私钥解析失败: %w", err)
+			}
+			return inter, interKey, nil
+		}
+	}
+
+	inter, interKey, err := cert.NewIntermediateCA(ca, caKey,
+		cert.WithCommonName(ca.Subject.CommonName+" Intermediate"),
+		cert.WithOrganization(ca.Subject.Organization...),
+		cert.WithKeyType(cert.KeyTypeOf(caKey.Public())),
+		cert.WithValidity(interValidity),
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("中级证书生成失败: %w", err)
+	}
+	block, err := cert.MarshalPrivateKey(interKey, []byte(s.Passphrase))
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = os.MkdirAll(s.Dir, 0700); err != nil {
+		return nil, nil, err
+	}
+	if err = cert.SaveKeyToFile(keyPath, block); err != nil {
+		return nil, nil, err
+	}
+	if err = cert.WriteCertToFile(inter, crtPath); err != nil {
+		return nil, nil, err
+	}
+	log.Println("Intermediate", inter.Subject.CommonName)
+	return inter, interKey, nil
+}
+
+// 迁移旧版本保存在工作目录的证书，迁移后删除明文私钥
+func (s *CertStore) MigrateLegacy() error {
+	if s.Exists() {
+		return nil
+	}
+	if _, err := os.Stat(legacyCrtPath); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	pemBytes, err := os.ReadFile(legacyKeyPath)
+	if err != nil {
+		return fmt.Errorf("证书迁移失败: %w", err)
+	}
+	privKey, err := cert.ParsePrivateKey(pemBytes, nil)
+	if err != nil {
+		return fmt.Errorf("证书迁移失败: %w", err)
+	}
+	pemBytes, err = os.ReadFile(legacyCrtPath)
+	if err != nil {
+		return fmt.Errorf("证书迁移失败: %w", err)
+	}
+	crt, err := cert.ParseCertificatePEM(pemBytes)
+	if err != nil {
+		return fmt.Errorf("证书迁移失败: %w", err)
+	}
+
+	if err = s.Save(crt, privKey); err != nil {
+		return fmt.Errorf("证书迁移失败: %w", err)
+	}
+	log.Println("MigrateLegacy", legacyCrtPath, "->", s.Dir)
+	return os.Remove(legacyKeyPath)
+}
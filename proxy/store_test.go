@@ -0,0 +1,176 @@
+package proxy
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/dreamsxin/go-netsniffer/cert"
+)
+
+func TestPassphrase(t *testing.T) {
+	store, err := NewCertStore(t.TempDir(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if passphrase, err := store.LoadPassphrase(); passphrase != "" || err != nil {
+		t.Fatalf("no passphrase: %q %v", passphrase, err)
+	}
+
+	err = store.SavePassphrase("secret")
+	if runtime.GOOS != "windows" {
+		if !errors.Is(err, cert.ErrProtectUnsupported) {
+			t.Fatalf("SavePassphrase: %v", err)
+		}
+	} else if passphrase, err := store.LoadPassphrase(); err != nil || passphrase != "secret" {
+		t.Fatalf("saved passphrase: %q %v", passphrase, err)
+	}
+
+	// 环境变量优先
+	t.Setenv(PassphraseEnv, "env")
+	if passphrase, err := store.LoadPassphrase(); passphrase != "env" || err != nil {
+		t.Fatalf("env passphrase: %q %v", passphrase, err)
+	}
+	if err = store.SavePassphrase(""); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUpstreamPassword(t *testing.T) {
+	store, err := NewCertStore(t.TempDir(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := UpstreamPasswordEnvName("*.example.com"); name != "NETSNIFFER_UPSTREAM_PASSWORD___EXAMPLE_COM" {
+		t.Fatalf("env name: %s", name)
+	}
+
+	err = store.SaveUpstreamPassword("a.example.com", "a")
+	if runtime.GOOS != "windows" {
+		if !errors.Is(err, cert.ErrProtectUnsupported) {
+			t.Fatalf("SaveUpstreamPassword: %v", err)
+		}
+	} else {
+		if err = store.SaveUpstreamPassword("b.example.com", "b"); err != nil {
+			t.Fatal(err)
+		}
+		for host, want := range map[string]string{"a.example.com": "a", "B.example.com": "b", "c.example.com": ""} {
+			if password, err := store.LoadUpstreamPassword(host); err != nil || password != want {
+				t.Fatalf("saved password for %s: %q %v", host, password, err)
+			}
+		}
+		// 删除一个主机的密码不影响其他主机
+		if err = store.SaveUpstreamPassword("a.example.com", ""); err != nil {
+			t.Fatal(err)
+		}
+		if password, err := store.LoadUpstreamPassword("b.example.com"); err != nil || password != "b" {
+			t.Fatalf("remaining password: %q %v", password, err)
+		}
+	}
+
+	t.Setenv(UpstreamPasswordEnvName("b.example.com"), "env")
+	if password, err := store.LoadUpstreamPassword("b.example.com"); password != "env" || err != nil {
+		t.Fatalf("env password: %q %v", password, err)
+	}
+	if err = store.SaveUpstreamPassword("b.example.com", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(store.Dir, upstreamPasswordFile)); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("password file not removed: %v", err)
+	}
+}
+
+func TestRotateCert(t *testing.T) {
+	store, err := NewCertStore(t.TempDir(), "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	old, oldKey, err := NewAuthority("Test", "Test", time.Hour, cert.KeyTypeECDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = store.Save(old, oldKey); err != nil {
+		t.Fatal(err)
+	}
+
+	// 生成失败时不动旧证书
+	if _, _, err = RotateCert(store, "Test", cert.KeyType("bogus"), false, false); err == nil {
+		t.Fatal("rotate with invalid key type succeeded")
+	}
+	if crt, err := store.Certificate(); err != nil || !crt.Equal(old) {
+		t.Fatalf("old certificate replaced: %v", err)
+	}
+
+	crt, _, err := RotateCert(store, "Test", cert.KeyTypeECDSA, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, _, err := store.Load()
+	if err != nil || !loaded.Equal(crt) || loaded.Equal(old) {
+		t.Fatalf("rotated certificate not loaded: %v", err)
+	}
+	if _, err = os.Stat(filepath.Join(store.Dir, archiveDir, cert.Thumbprint(old)+"-"+crtFile)); err != nil {
+		t.Fatalf("old certificate not archived: %v", err)
+	}
+	if staged, _ := filepath.Glob(filepath.Join(store.Dir, "rotate-*")); len(staged) > 0 {
+		t.Fatalf("staging left behind: %v", staged)
+	}
+}
+
+func TestImportCert(t *testing.T) {
+	store, err := NewCertStore(t.TempDir(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	old, oldKey, err := NewAuthority("Old", "Test", time.Hour, cert.KeyTypeECDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = store.Save(old, oldKey); err != nil {
+		t.Fatal(err)
+	}
+	root, rootKey, err := cert.NewRootCA(cert.WithCommonName("Imported"), cert.WithKeyType(cert.KeyTypeECDSA))
+	if err != nil {
+		t.Fatal(err)
+	}
+	inter, interKey, err := cert.NewIntermediateCA(root, rootKey, cert.WithCommonName("Imported Intermediate"), cert.WithKeyType(cert.KeyTypeECDSA))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle := func(crt *x509.Certificate, key crypto.Signer) string {
+		block, err := cert.MarshalPrivateKey(key, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		filename := filepath.Join(t.TempDir(), "ca.pem")
+		if err = os.WriteFile(filename, append(cert.EncodeCertPEM(crt), pem.EncodeToMemory(block)...), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return filename
+	}
+
+	// 中级 CA 没有上级证书不能使用
+	if _, _, err = ImportCert(store, bundle(inter, interKey), "", ""); err == nil {
+		t.Fatal("imported an intermediate CA")
+	}
+	if crt, err := store.Certificate(); err != nil || !crt.Equal(old) {
+		t.Fatalf("current certificate replaced by a failed import: %v", err)
+	}
+
+	crt, _, err := ImportCert(store, bundle(root, rootKey), "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded, _, err := store.Load(); err != nil || !loaded.Equal(crt) || !crt.Equal(root) {
+		t.Fatalf("imported certificate not loaded: %v", err)
+	}
+	if _, err = os.Stat(filepath.Join(store.Dir, archiveDir, cert.Thumbprint(old)+"-"+crtFile)); err != nil {
+		t.Fatalf("old certificate not archived: %v", err)
+	}
+}
@@ -0,0 +1,71 @@
+package proxy
+
+import (
+	"bufio"
+	"log"
+	"mime"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/google/martian/v3"
+)
+
+// 需要实时转发给客户端的流式响应类型
+var streamingTypes = []string{
+	"text/event-stream",
+	"application/x-ndjson",
+	"application/stream+json",
+	"multipart/x-mixed-replace",
+}
+
+// 判断响应是否为没有固定长度的流式响应，如 SSE
+func IsStreaming(res *http.Response) bool {
+	if res.ContentLength >= 0 {
+		return false
+	}
+	mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	return slices.Contains(streamingTypes, mediaType)
+}
+
+// streamer 实时转发流式响应，需要在其他响应处理器之后执行
+// martian 写完整个响应才刷新缓冲区，流式响应改为接管连接，每次写入后立即发送，结束后关闭连接
+type streamer struct{}
+
+func (s *streamer) ModifyResponse(res *http.Response) error {
+	if res.Request == nil || !IsStreaming(res) {
+		return nil
+	}
+	ctx := martian.NewContext(res.Request)
+	if ctx == nil || ctx.Session().Hijacked() {
+		return nil
+	}
+
+	conn, brw, err := ctx.Session().Hijack()
+	if err != nil {
+		return err
+	}
+	// martian 在返回后会继续读取这个连接，返回前确保连接已关闭
+	defer conn.Close()
+
+	// 流式响应可能持续很久，不使用 martian 设置的读写超时
+	conn.SetDeadline(time.Time{})
+	res.Close = true
+	if err = res.Write(&flushWriter{w: brw.Writer}); err != nil {
+		log.Println("stream", res.Request.URL, err)
+	}
+	return nil
+}
+
+// flushWriter 每次写入后刷新缓冲区
+type flushWriter struct {
+	w *bufio.Writer
+}
+
+func (f *flushWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	if err == nil {
+		err = f.w.Flush()
+	}
+	return n, err
+}
@@ -0,0 +1,108 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/dreamsxin/go-netsniffer/models"
+	"github.com/google/martian/v3"
+)
+
+const timingKey = "netsniffer.timing"
+
+// RequestTimer 记录一次请求各阶段的时间，httptrace 回调在传输协程中执行，方法可以并发调用
+type RequestTimer struct {
+	lock   sync.Mutex
+	timing models.Timing
+}
+
+// 记录阶段时间，first 时只记录第一次，多地址连接时开始时间取第一次
+func (t *RequestTimer) mark(d *time.Duration, first bool) {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if first && *d != 0 {
+		return
+	}
+	*d = max(time.Since(t.timing.Start), 1)
+}
+
+// 响应内容转发完成
+func (t *RequestTimer) Finish() {
+	if t != nil {
+		t.mark(&t.timing.Done, true)
+	}
+}
+
+// 当前记录的时间
+func (t *RequestTimer) Timing() *models.Timing {
+	if t == nil {
+		return nil
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	timing := t.timing
+	return &timing
+}
+
+func (t *RequestTimer) trace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart:     func(httptrace.DNSStartInfo) { t.mark(&t.timing.DNSStart, true) },
+		DNSDone:      func(httptrace.DNSDoneInfo) { t.mark(&t.timing.DNSDone, false) },
+		ConnectStart: func(string, string) { t.mark(&t.timing.ConnectStart, true) },
+		ConnectDone:  func(string, string, error) { t.mark(&t.timing.ConnectDone, false) },
+		TLSHandshakeStart: func() {
+			t.mark(&t.timing.TLSStart, true)
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.mark(&t.timing.TLSDone, false)
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mark(&t.timing.GotConn, false)
+			t.lock.Lock()
+			t.timing.Reused = info.Reused
+			t.lock.Unlock()
+		},
+		WroteRequest:         func(httptrace.WroteRequestInfo) { t.mark(&t.timing.RequestSent, false) },
+		GotFirstResponseByte: func() { t.mark(&t.timing.FirstByte, true) },
+	}
+}
+
+// timer 在收到请求时开始计时，需要在其他处理器之前执行
+type timer struct{}
+
+func (timer) ModifyRequest(req *http.Request) error {
+	if ctx := martian.NewContext(req); ctx != nil {
+		ctx.Set(timingKey, &RequestTimer{timing: models.Timing{Start: time.Now()}})
+	}
+	return nil
+}
+
+// 读取请求的计时器，martian 处理完请求后上下文被删除，需要在请求或响应处理器中获取
+func Timer(req *http.Request) *RequestTimer {
+	if req == nil {
+		return nil
+	}
+	ctx := martian.NewContext(req)
+	if ctx == nil {
+		return nil
+	}
+	if v, ok := ctx.Get(timingKey); ok {
+		return v.(*RequestTimer)
+	}
+	return nil
+}
+
+// 转发时记录 DNS、连接、TLS 握手等阶段的时间
+func withTrace(req *http.Request) *http.Request {
+	t := Timer(req)
+	if t == nil {
+		return req
+	}
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), t.trace()))
+}
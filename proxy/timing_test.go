@@ -0,0 +1,113 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dreamsxin/go-netsniffer/models"
+)
+
+func TestRequestTimerMark(t *testing.T) {
+	timer := &RequestTimer{timing: models.Timing{Start: time.Now().Add(-time.Second)}}
+	timer.mark(&timer.timing.DNSStart, true)
+	first := timer.Timing().DNSStart
+	if first < time.Second {
+		t.Fatalf("DNSStart %s", first)
+	}
+	// first 只记录第一次，否则取最后一次
+	timer.mark(&timer.timing.DNSStart, true)
+	timer.mark(&timer.timing.DNSDone, false)
+	done := timer.Timing().DNSDone
+	time.Sleep(time.Millisecond)
+	timer.mark(&timer.timing.DNSDone, false)
+	timing := timer.Timing()
+	if timing.DNSStart != first || timing.DNSDone <= done {
+		t.Fatalf("DNSStart %s/%s DNSDone %s/%s", timing.DNSStart, first, timing.DNSDone, done)
+	}
+
+	timer.Finish()
+	finished := timer.Timing().Done
+	timer.Finish()
+	if finished == 0 || timer.Timing().Done != finished {
+		t.Fatalf("Done %s/%s", timer.Timing().Done, finished)
+	}
+	// 返回的是副本
+	timing.Done = 0
+	if timer.Timing().Done != finished {
+		t.Fatal("Timing returned internal state")
+	}
+
+	var nilTimer *RequestTimer
+	nilTimer.Finish()
+	if nilTimer.Timing() != nil {
+		t.Fatal("nil timer returned timing")
+	}
+}
+
+func TestRequestTimerTrace(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer srv.Close()
+
+	transport := newTransport()
+	transport.Proxy = nil
+	transport.TLSClientConfig.RootCAs = srv.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+	transport.TLSClientConfig.ServerName = "example.com"
+	defer transport.CloseIdleConnections()
+	// 使用主机名才会解析 DNS
+	url := strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)
+
+	get := func() *models.Timing {
+		timer := &RequestTimer{timing: models.Timing{Start: time.Now()}}
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = req.WithContext(httptrace.WithClientTrace(req.Context(), timer.trace()))
+		res, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+		return timer.Timing()
+	}
+
+	timing := get()
+	if timing.Reused {
+		t.Fatal("first request reused a connection")
+	}
+	stages := []struct {
+		name string
+		d    time.Duration
+	}{
+		{"DNSStart", timing.DNSStart},
+		{"DNSDone", timing.DNSDone},
+		{"ConnectStart", timing.ConnectStart},
+		{"ConnectDone", timing.ConnectDone},
+		{"TLSStart", timing.TLSStart},
+		{"TLSDone", timing.TLSDone},
+		{"GotConn", timing.GotConn},
+		{"RequestSent", timing.RequestSent},
+		{"FirstByte", timing.FirstByte},
+	}
+	for i, stage := range stages {
+		if stage.d == 0 {
+			t.Errorf("%s not recorded", stage.name)
+		}
+		if i > 0 && stage.d < stages[i-1].d {
+			t.Errorf("%s %s before %s %s", stage.name, stage.d, stages[i-1].name, stages[i-1].d)
+		}
+	}
+
+	timing = get()
+	if !timing.Reused || timing.GotConn == 0 || timing.ConnectStart != 0 || timing.TLSStart != 0 {
+		t.Fatalf("second request: %+v", timing)
+	}
+}
@@ -0,0 +1,373 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dreamsxin/go-netsniffer/cert"
+
+	"github.com/dreamsxin/go-netsniffer/models"
+	"github.com/google/martian/v3"
+)
+
+// 保存在 martian 上下文中的上游 TLS 连接信息
+const upstreamTLSKey = "netsniffer.upstream.tls"
+
+// upstreamTransport 转发请求并记录上游 TLS 连接信息，握手失败时也记录服务器发送的证书链
+// HTTPS 请求按主机使用 models.Upstream 设置的 TLS 参数
+type upstreamTransport struct {
+	lock      sync.RWMutex
+	base      *http.Transport
+	conf      []models.Upstream
+	keyLog    io.Writer
+	transport *http.Transport // 没有匹配的上游设置时使用，记录密钥时为 base 的副本
+	rules     []upstreamRule
+}
+
+type upstreamRule struct {
+	host      string
+	transport *http.Transport
+	pinned    bool // 使用证书固定代替 CA 校验
+}
+
+// 校验服务器证书使用的根证书，为 nil 时使用系统根证书
+func (r upstreamRule) roots() *x509.CertPool {
+	if r.transport.TLSClientConfig == nil {
+		return nil
+	}
+	return r.transport.TLSClientConfig.RootCAs
+}
+
+func newUpstreamTransport(base *http.Transport) *upstreamTransport {
+	return &upstreamTransport{base: base, transport: base}
+}
+
+// 转发请求使用的 Transport，不再经过 martian 设置，连接代理、拨号和 TLS 参数都在这里确定
+// 使用 DialContext 才能在请求的上下文中记录 DNS 和连接的时间
+func newTransport() *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSClientConfig: &tls.Config{},
+		// martian 不支持 HTTP/2，不升级上游连接
+		TLSNextProto:          make(map[string]func(string, *tls.Conn) http.RoundTripper),
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+	}
+}
+
+func (t *upstreamTransport) setUpstream(conf []models.Upstream) error {
+	t.lock.RLock()
+	base, keyLog := t.base, t.keyLog
+	t.lock.RUnlock()
+	return t.apply(base, conf, keyLog)
+}
+
+func (t *upstreamTransport) setKeyLog(keyLog io.Writer) error {
+	t.lock.RLock()
+	base, conf := t.base, t.conf
+	t.lock.RUnlock()
+	return t.apply(base, conf, keyLog)
+}
+
+func (t *upstreamTransport) apply(base *http.Transport, conf []models.Upstream, keyLog io.Writer) error {
+	transport := base
+	var rules []upstreamRule
+	if keyLog != nil {
+		clone := base.Clone()
+		if clone.TLSClientConfig == nil {
+			clone.TLSClientConfig = &tls.Config{}
+		}
+		clone.TLSClientConfig.KeyLogWriter = keyLog
+		transport = clone
+	}
+	for _, u := range conf {
+		cfg, err := NewUpstreamTLSConfig(u, base.TLSClientConfig)
+		if err != nil {
+			return fmt.Errorf("上游设置 %s 无效: %w", u.Host, err)
+		}
+		cfg.KeyLogWriter = keyLog
+		clone := base.Clone()
+		clone.TLSClientConfig = cfg
+		rules = append(rules, upstreamRule{host: u.Host, transport: clone, pinned: len(u.Pins) > 0})
+	}
+
+	t.lock.Lock()
+	old, oldTransport := t.rules, t.transport
+	t.base = base
+	t.conf = conf
+	t.keyLog = keyLog
+	t.transport = transport
+	t.rules = rules
+	t.lock.Unlock()
+	for _, rule := range old {
+		rule.transport.CloseIdleConnections()
+	}
+	if oldTransport != base {
+		oldTransport.CloseIdleConnections()
+	}
+	return nil
+}
+
+// 请求使用的上游设置，没有匹配时返回使用默认 Transport 的设置
+func (t *upstreamTransport) ruleFor(req *http.Request) upstreamRule {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	if req.URL.Scheme == "https" {
+		for _, rule := range t.rules {
+			if MatchHost(rule.host, req.URL.Hostname()) {
+				return rule
+			}
+		}
+	}
+	return upstreamRule{transport: t.transport}
+}
+
+func (t *upstreamTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rule := t.ruleFor(req)
+	res, err := rule.transport.RoundTrip(withTrace(req))
+	if res != nil {
+		// martian 按原请求查找上下文
+		res.Request = req
+	}
+	if req.URL.Scheme != "https" {
+		return res, err
+	}
+
+	var info *models.TLSInfo
+	if err == nil && res.TLS != nil {
+		info = NewTLSInfo(res.TLS, req.URL.Hostname(), rule.roots(), rule.pinned)
+	} else if err != nil {
+		var verr *tls.CertificateVerificationError
+		if errors.As(err, &verr) {
+			info = &models.TLSInfo{
+				ServerName:  req.URL.Hostname(),
+				VerifyError: verr.Err.Error(),
+			}
+			for _, crt := range verr.UnverifiedCertificates {
+				info.Certificates = append(info.Certificates, *NewCertInfo(crt))
+			}
+		} else if isHandshakeError(err) {
+			info = &models.TLSInfo{ServerName: req.URL.Hostname(), HandshakeErr: err.Error()}
+		}
+	}
+	if info != nil {
+		if ctx := martian.NewContext(req); ctx != nil {
+			ctx.Set(upstreamTLSKey, info)
+		}
+	}
+	return res, err
+}
+
+func isHandshakeError(err error) bool {
+	var alert tls.AlertError
+	var recordErr tls.RecordHeaderError
+	var opErr *net.OpError
+	return errors.As(err, &alert) || errors.As(err, &recordErr) ||
+		(errors.As(err, &opErr) && opErr.Op == "remote error")
+}
+
+// 读取请求对应的上游 TLS 连接信息，不是 HTTPS 请求或没有经过代理转发时返回 nil
+func UpstreamTLS(req *http.Request) *models.TLSInfo {
+	if req == nil {
+		return nil
+	}
+	ctx := martian.NewContext(req)
+	if ctx == nil {
+		return nil
+	}
+	if v, ok := ctx.Get(upstreamTLSKey); ok {
+		return v.(*models.TLSInfo)
+	}
+	return nil
+}
+
+// 根据连接状态生成 TLS 信息，IP 地址不会作为 SNI 发送，serverName 为请求的主机名
+// pinned 为 true 时连接成功说明证书固定校验通过；跳过校验的连接用 roots 重新校验一次，记录校验结果，roots 为 nil 时使用系统根证书
+func NewTLSInfo(state *tls.ConnectionState, serverName string, roots *x509.CertPool, pinned bool) *models.TLSInfo {
+	if state.ServerName != "" {
+		serverName = state.ServerName
+	}
+	info := &models.TLSInfo{
+		ServerName:  serverName,
+		Version:     tls.VersionName(state.Version),
+		CipherSuite: tls.CipherSuiteName(state.CipherSuite),
+		ALPN:        state.NegotiatedProtocol,
+	}
+	for _, crt := range state.PeerCertificates {
+		info.Certificates = append(info.Certificates, *NewCertInfo(crt))
+	}
+
+	if len(state.VerifiedChains) > 0 {
+		info.Verified = true
+		return info
+	}
+	if pinned {
+		info.VerifyMode = "pinned"
+		info.Verified = true
+		return info
+	}
+	info.VerifyMode = "skipped"
+	if len(state.PeerCertificates) == 0 {
+		return info
+	}
+	inters := x509.NewCertPool()
+	for _, crt := range state.PeerCertificates[1:] {
+		inters.AddCert(crt)
+	}
+	_, err := state.PeerCertificates[0].Verify(x509.VerifyOptions{
+		DNSName:       serverName,
+		Roots:         roots,
+		Intermediates: inters,
+	})
+	if err != nil {
+		info.VerifyError = err.Error()
+	} else {
+		info.Verified = true
+	}
+	return info
+}
+
+var errPinMismatch = errors.New("server certificate does not match any pin")
+
+// 根据上游设置生成 TLS 客户端配置，base 为转发请求原来使用的配置
+func NewUpstreamTLSConfig(u models.Upstream, base *tls.Config) (*tls.Config, error) {
+	cfg := &tls.Config{}
+	if base != nil {
+		cfg = base.Clone()
+	}
+	cfg.InsecureSkipVerify = cfg.InsecureSkipVerify || u.InsecureSkipVerify
+
+	if len(u.CAFiles) > 0 {
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			roots = x509.NewCertPool()
+		}
+		for _, filename := range u.CAFiles {
+			pemBytes, err := os.ReadFile(filename)
+			if err != nil {
+				return nil, err
+			}
+			if !roots.AppendCertsFromPEM(pemBytes) {
+				return nil, fmt.Errorf("no certificate found in %s", filename)
+			}
+		}
+		cfg.RootCAs = roots
+	}
+
+	if len(u.Pins) > 0 {
+		pins := make(map[string]bool)
+		for _, pin := range u.Pins {
+			pin, err := normalizePin(pin)
+			if err != nil {
+				return nil, err
+			}
+			pins[pin] = true
+		}
+		// 固定证书后不再校验 CA，自签名证书也可以使用
+		cfg.InsecureSkipVerify = true
+		cfg.VerifyConnection = func(state tls.ConnectionState) error {
+			for _, crt := range state.PeerCertificates {
+				if pins[certPin(crt)] || pins[spkiPin(crt)] {
+					return nil
+				}
+			}
+			return &tls.CertificateVerificationError{UnverifiedCertificates: state.PeerCertificates, Err: errPinMismatch}
+		}
+	}
+
+	if u.ClientCert != "" {
+		clientCert, err := LoadClientCertificate(u.ClientCert, u.ClientKey, u.ClientPassword)
+		if err != nil {
+			return nil, fmt.Errorf("客户端证书读取失败: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{clientCert}
+	}
+	return cfg, nil
+}
+
+// 证书 SHA-256 指纹，不区分大小写，冒号可以省略；sha256/ 开头的为公钥指纹
+func normalizePin(pin string) (string, error) {
+	pin = strings.TrimSpace(pin)
+	if spki, ok := strings.CutPrefix(pin, "sha256/"); ok {
+		if b, err := base64.StdEncoding.DecodeString(spki); err != nil || len(b) != sha256.Size {
+			return "", fmt.Errorf("invalid public key pin: %s", pin)
+		}
+		return pin, nil
+	}
+	pin = strings.ToLower(strings.ReplaceAll(pin, ":", ""))
+	if b, err := hex.DecodeString(pin); err != nil || len(b) != sha256.Size {
+		return "", fmt.Errorf("invalid certificate pin: %s", pin)
+	}
+	return pin, nil
+}
+
+func certPin(crt *x509.Certificate) string {
+	sum := sha256.Sum256(crt.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+func spkiPin(crt *x509.Certificate) string {
+	sum := sha256.Sum256(crt.RawSubjectPublicKeyInfo)
+	return "sha256/" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// 读取客户端证书，certFile 为 PEM 时从 keyFile 读取私钥，keyFile 为空时私钥和证书在同一文件中
+func LoadClientCertificate(certFile, keyFile, password string) (tls.Certificate, error) {
+	data, err := os.ReadFile(certFile)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	if !cert.IsPEM(data) {
+		key, crt, chain, err := cert.DecodePKCS12(data, password)
+		if err != nil {
+			return tls.Certificate{}, err
+		}
+		tlsc := tls.Certificate{Certificate: [][]byte{crt.Raw}, PrivateKey: key, Leaf: crt}
+		for _, c := range chain {
+			tlsc.Certificate = append(tlsc.Certificate, c.Raw)
+		}
+		return tlsc, nil
+	}
+
+	crts, err := cert.ParseCertificatesPEM(data)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	keyData := data
+	if keyFile != "" {
+		if keyData, err = os.ReadFile(keyFile); err != nil {
+			return tls.Certificate{}, err
+		}
+	}
+	key, err := cert.ParsePrivateKeyFromPEM(keyData, []byte(password))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	if err = cert.KeyMatch(crts[0], key); err != nil {
+		return tls.Certificate{}, err
+	}
+	tlsc := tls.Certificate{PrivateKey: key, Leaf: crts[0]}
+	for _, c := range crts {
+		tlsc.Certificate = append(tlsc.Certificate, c.Raw)
+	}
+	return tlsc, nil
+}
@@ -0,0 +1,242 @@
+package proxy
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dreamsxin/go-netsniffer/cert"
+	"github.com/dreamsxin/go-netsniffer/models"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+func TestMatchHost(t *testing.T) {
+	cases := []struct {
+		pattern, host string
+		match         bool
+	}{
+		{"example.com", "example.com", true},
+		{" Example.COM ", "example.com", true},
+		{"example.com", "EXAMPLE.com", true},
+		{"*.example.com", "a.example.com", true},
+		{"*.example.com", "example.com", true},
+		{"*.example.com", "badexample.com", false},
+		{"api.test", "api.test.evil", false},
+		{"127.0.0.1", "127.0.0.1", true},
+		{"", "example.com", false},
+	}
+	for _, c := range cases {
+		if got := MatchHost(c.pattern, c.host); got != c.match {
+			t.Errorf("MatchHost(%q, %q) = %v", c.pattern, c.host, got)
+		}
+	}
+}
+
+func writePEM(t *testing.T, filename string, blocks ...*pem.Block) string {
+	filename = filepath.Join(t.TempDir(), filename)
+	var data []byte
+	for _, block := range blocks {
+		data = append(data, pem.EncodeToMemory(block)...)
+	}
+	if err := os.WriteFile(filename, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestUpstreamTLS(t *testing.T) {
+	root, rootKey, err := cert.NewRootCA(cert.WithCommonName("Upstream Root"), cert.WithKeyType(cert.KeyTypeECDSA))
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, leafKey, err := cert.NewLeafCert(root, rootKey, cert.WithSANs("127.0.0.1"), cert.WithKeyType(cert.KeyTypeECDSA))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCA, clientCAKey, err := cert.NewRootCA(cert.WithCommonName("Client Root"), cert.WithKeyType(cert.KeyTypeECDSA))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, clientKey, err := cert.NewLeafCert(clientCA, clientCAKey, cert.WithCommonName("client"),
+		cert.WithExtKeyUsage(x509.ExtKeyUsageClientAuth), cert.WithKeyType(cert.KeyTypeECDSA))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _, err := cert.NewRootCA(cert.WithCommonName("Other"), cert.WithKeyType(cert.KeyTypeECDSA))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 服务器返回客户端证书的名称
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := "none"
+		if len(r.TLS.PeerCertificates) > 0 {
+			name = r.TLS.PeerCertificates[0].Subject.CommonName
+		}
+		io.WriteString(w, name)
+	}))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCA)
+	srv.TLS = &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{leaf.Raw, root.Raw}, PrivateKey: leafKey}},
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+		ClientCAs:    clientCAs,
+	}
+	srv.StartTLS()
+	defer srv.Close()
+
+	certBlock := &pem.Block{Type: "CERTIFICATE", Bytes: client.Raw}
+	keyBlock, err := cert.MarshalPrivateKey(clientKey, []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	caFile := writePEM(t, "ca.pem", &pem.Block{Type: "CERTIFICATE", Bytes: root.Raw})
+	certFile := writePEM(t, "client.pem", certBlock)
+	keyFile := writePEM(t, "client-key.pem", keyBlock)
+	bundleFile := writePEM(t, "client-bundle.pem", certBlock, keyBlock)
+	pfx, err := pkcs12.Modern.WithRand(rand.Reader).Encode(clientKey, client, []*x509.Certificate{clientCA}, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pfxFile := filepath.Join(t.TempDir(), "client.p12")
+	if err = os.WriteFile(pfxFile, pfx, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		upstream models.Upstream
+		want     string // 服务器看到的客户端证书，为空时请求应当失败
+		pinErr   bool
+		mode     string // 记录的校验方式
+		verified bool
+	}{
+		{name: "untrusted", upstream: models.Upstream{Host: "127.0.0.1"}},
+		{name: "ca bundle", upstream: models.Upstream{Host: "127.0.0.1", CAFiles: []string{caFile}}, want: "none", verified: true},
+		{name: "insecure", upstream: models.Upstream{Host: "127.0.0.1", InsecureSkipVerify: true}, want: "none", mode: "skipped"},
+		{name: "insecure with ca bundle", upstream: models.Upstream{Host: "127.0.0.1", InsecureSkipVerify: true, CAFiles: []string{caFile}},
+			want: "none", mode: "skipped", verified: true},
+		{name: "insecure other host", upstream: models.Upstream{Host: "*.example.com", InsecureSkipVerify: true}},
+		{name: "certificate pin", upstream: models.Upstream{Host: "127.0.0.1", Pins: []string{cert.Fingerprint(leaf)}}, want: "none", mode: "pinned", verified: true},
+		{name: "public key pin", upstream: models.Upstream{Host: "127.0.0.1", Pins: []string{spkiPin(root)}}, want: "none", mode: "pinned", verified: true},
+		{name: "pin mismatch", upstream: models.Upstream{Host: "127.0.0.1", Pins: []string{cert.Fingerprint(other)}}, pinErr: true},
+		{name: "pem client cert", upstream: models.Upstream{Host: "127.0.0.1", CAFiles: []string{caFile},
+			ClientCert: certFile, ClientKey: keyFile, ClientPassword: "secret"}, want: "client", verified: true},
+		{name: "pem bundle client cert", upstream: models.Upstream{Host: "127.0.0.1", CAFiles: []string{caFile},
+			ClientCert: bundleFile, ClientPassword: "secret"}, want: "client", verified: true},
+		{name: "pkcs12 client cert", upstream: models.Upstream{Host: "127.0.0.1", CAFiles: []string{caFile},
+			ClientCert: pfxFile, ClientPassword: "secret"}, want: "client", verified: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := newTransport()
+			base.Proxy = nil
+			transport := newUpstreamTransport(base)
+			if err := transport.setUpstream([]models.Upstream{tt.upstream}); err != nil {
+				t.Fatal(err)
+			}
+			defer base.CloseIdleConnections()
+			defer transport.setUpstream(nil)
+
+			req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := transport.RoundTrip(req)
+			if tt.want == "" {
+				if err == nil {
+					res.Body.Close()
+					t.Fatal("request succeeded")
+				}
+				if tt.pinErr != errors.Is(err, errPinMismatch) {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+			body, _ := io.ReadAll(res.Body)
+			if string(body) != tt.want {
+				t.Fatalf("server saw client certificate %q", body)
+			}
+			rule := transport.ruleFor(req)
+			info := NewTLSInfo(res.TLS, req.URL.Hostname(), rule.roots(), rule.pinned)
+			if info.VerifyMode != tt.mode || info.Verified != tt.verified || info.Verified != (info.VerifyError == "") {
+				t.Fatalf("verify mode %q verified %v error %q", info.VerifyMode, info.Verified, info.VerifyError)
+			}
+		})
+	}
+}
+
+func TestLoadClientCertificate(t *testing.T) {
+	ca, caKey, err := cert.NewRootCA(cert.WithCommonName("Client Root"), cert.WithKeyType(cert.KeyTypeECDSA))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, clientKey, err := cert.NewLeafCert(ca, caKey, cert.WithCommonName("client"), cert.WithKeyType(cert.KeyTypeECDSA))
+	if err != nil {
+		t.Fatal(err)
+	}
+	certBlock := &pem.Block{Type: "CERTIFICATE", Bytes: client.Raw}
+	keyBlock, err := cert.MarshalPrivateKey(clientKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrongBlock, err := cert.MarshalPrivateKey(caKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pfx, err := pkcs12.Modern.WithRand(rand.Reader).Encode(clientKey, client, []*x509.Certificate{ca}, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pfxFile := filepath.Join(t.TempDir(), "client.p12")
+	if err = os.WriteFile(pfxFile, pfx, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name              string
+		certFile, keyFile string
+		password          string
+		chain             int // 证书链长度，为 0 时应当失败
+	}{
+		{"pem", writePEM(t, "cert.pem", certBlock), writePEM(t, "key.pem", keyBlock), "", 1},
+		{"pem bundle", writePEM(t, "bundle.pem", certBlock, &pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw}, keyBlock), "", "", 2},
+		{"key mismatch", writePEM(t, "cert.pem", certBlock), writePEM(t, "wrong.pem", wrongBlock), "", 0},
+		{"missing key", writePEM(t, "cert.pem", certBlock), "", "", 0},
+		{"pkcs12", pfxFile, "", "secret", 2},
+		{"pkcs12 wrong password", pfxFile, "", "wrong", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tlsc, err := LoadClientCertificate(tt.certFile, tt.keyFile, tt.password)
+			if tt.chain == 0 {
+				if err == nil {
+					t.Fatal("loaded invalid client certificate")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(tlsc.Certificate) != tt.chain || !tlsc.Leaf.Equal(client) {
+				t.Fatalf("chain %d leaf %s", len(tlsc.Certificate), tlsc.Leaf.Subject)
+			}
+			if err = cert.KeyMatch(tlsc.Leaf, tlsc.PrivateKey.(crypto.Signer)); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
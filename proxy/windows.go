@@ -20,6 +20,29 @@ func EnableProxy(port int) error {
 	if err := enableCmd.Run(); err != nil {
 		return err
 	}
+
+	// Remove PAC, fixed proxy and pac are exclusive
+	// remove-itemproperty 'HKCU:\Software\Microsoft\Windows\CurrentVersion\Internet Settings' -name AutoConfigURL
+	removeCmd := cmd.Command("powershell", "remove-itemproperty 'HKCU:\\Software\\Microsoft\\Windows\\CurrentVersion\\Internet Settings' -name AutoConfigURL -ErrorAction SilentlyContinue")
+	if err := removeCmd.Run(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func EnablePAC(pacURL string) error {
+	// set pac url
+	// set-itemproperty 'HKCU:\Software\Microsoft\Windows\CurrentVersion\Internet Settings' -name AutoConfigURL -value url
+	setCmd := cmd.Command("powershell", fmt.Sprintf("set-itemproperty 'HKCU:\\Software\\Microsoft\\Windows\\CurrentVersion\\Internet Settings' -name AutoConfigURL -value '%s'", pacURL))
+	if err := setCmd.Run(); err != nil {
+		return err
+	}
+
+	// pac and fixed proxy are exclusive
+	disableCmd := cmd.Command("powershell", "set-itemproperty 'HKCU:\\Software\\Microsoft\\Windows\\CurrentVersion\\Internet Settings' -name ProxyEnable -value 0")
+	if err := disableCmd.Run(); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -30,5 +53,12 @@ func DisableProxy() error {
 	if err := disableCmd.Run(); err != nil {
 		return err
 	}
+
+	// Remove PAC
+	// remove-itemproperty 'HKCU:\Software\Microsoft\Windows\CurrentVersion\Internet Settings' -name AutoConfigURL
+	removeCmd := cmd.Command("powershell", "remove-itemproperty 'HKCU:\\Software\\Microsoft\\Windows\\CurrentVersion\\Internet Settings' -name AutoConfigURL -ErrorAction SilentlyContinue")
+	if err := removeCmd.Run(); err != nil {
+		return err
+	}
 	return nil
 }
@@ -0,0 +1,380 @@
+package storage
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+
+	"github.com/dreamsxin/go-netsniffer/models"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+// 会话归档是 zip 文件：
+//
+//	manifest.json  格式、版本和数量
+//	http.jsonl     按收到顺序的 HTTP 数据包，同一个请求的请求、响应和流式数据 ID 相同
+//	ip.jsonl       IP 数据包
+//	bodies.jsonl   内容的类型、长度等信息，内容在 bodies/<id>/<part>
+//	capture.pcapng 由以太网数据包还原，可以用 Wireshark 打开，导入时忽略
+//
+// 只在格式不兼容时增加版本，读取时忽略不认识的字段和文件，旧版本的归档可以继续导入
+const (
+	ArchiveFormat  = "go-netsniffer-session"
+	ArchiveVersion = 1
+
+	manifestFile = "manifest.json"
+	httpFile     = "http.jsonl"
+	ipFile       = "ip.jsonl"
+	bodiesFile   = "bodies.jsonl"
+	pcapngFile   = "capture.pcapng"
+
+	// 导入时单个内容的最大长度
+	maxArchiveBody = 256 << 20
+)
+
+// bodies.jsonl 中的一行
+type archiveBody struct {
+	ID          string
+	Part        string
+	ContentType string `json:"ContentType,omitempty"`
+	Total       int64
+	Truncated   bool `json:"Truncated,omitempty"`
+	File        string
+}
+
+// 导出为会话归档，先写入临时文件，完成后替换 filename
+func (s *Session) ExportArchive(filename string) (*models.SessionManifest, error) {
+	tmp := filename + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return nil, fmt.Errorf("创建归档文件失败: %w", err)
+	}
+	manifest, err := s.writeArchive(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, filename)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return nil, fmt.Errorf("导出会话失败: %w", err)
+	}
+	return manifest, nil
+}
+
+func (s *Session) writeArchive(w io.Writer) (*models.SessionManifest, error) {
+	manifest := &models.SessionManifest{
+		Format:  ArchiveFormat,
+		Version: ArchiveVersion,
+		Created: time.Now(),
+		Name:    s.Name,
+	}
+	zw := zip.NewWriter(w)
+
+	for _, table := range []struct {
+		file  string
+		query string
+		count *int64
+	}{
+		{httpFile, "SELECT packet FROM http_packets ORDER BY seq", &manifest.HTTPPackets},
+		{ipFile, "SELECT packet FROM ip_packets ORDER BY seq", &manifest.IPPackets},
+	} {
+		fw, err := zw.Create(table.file)
+		if err != nil {
+			return nil, err
+		}
+		err = s.each(table.query, nil, func(rows *sql.Rows) error {
+			var data []byte
+			if err := rows.Scan(&data); err != nil {
+				return err
+			}
+			*table.count++
+			_, err := fw.Write(append(data, '\n'))
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var bodies []archiveBody
+	err := s.each("SELECT id, part, content_type, total, truncated FROM bodies ORDER BY id, part", nil, func(rows *sql.Rows) error {
+		var b archiveBody
+		if err := rows.Scan(&b.ID, &b.Part, &b.ContentType, &b.Total, &b.Truncated); err != nil {
+			return err
+		}
+		b.File = "bodies/" + b.ID + "/" + b.Part
+		fw, err := zw.Create(b.File)
+		if err != nil {
+			return err
+		}
+		err = s.each("SELECT data FROM body_chunks WHERE id = ? AND part = ? ORDER BY pos", []any{b.ID, b.Part}, func(rows *sql.Rows) error {
+			var chunk []byte
+			if err := rows.Scan(&chunk); err != nil {
+				return err
+			}
+			_, err := fw.Write(chunk)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		bodies = append(bodies, b)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	manifest.Bodies = int64(len(bodies))
+	if err = writeJSONLines(zw, bodiesFile, bodies); err != nil {
+		return nil, err
+	}
+
+	if manifest.IPPackets > 0 {
+		if err = s.writePCAPNG(zw); err != nil {
+			return nil, err
+		}
+		manifest.PCAPNG = true
+	}
+
+	fw, err := zw.Create(manifestFile)
+	if err != nil {
+		return nil, err
+	}
+	enc := json.NewEncoder(fw)
+	enc.SetIndent("", "  ")
+	if err = enc.Encode(manifest); err != nil {
+		return nil, err
+	}
+	return manifest, zw.Close()
+}
+
+// 以太网数据包按 MAC 地址、类型和负载还原帧，其他数据包跳过
+func (s *Session) writePCAPNG(zw *zip.Writer) error {
+	fw, err := zw.Create(pcapngFile)
+	if err != nil {
+		return err
+	}
+	nw, err := pcapgo.NewNgWriter(fw, layers.LinkTypeEthernet)
+	if err != nil {
+		return err
+	}
+	err = s.each("SELECT packet FROM ip_packets ORDER BY seq", nil, func(rows *sql.Rows) error {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return err
+		}
+		var p models.IPPacket
+		if err := json.Unmarshal(data, &p); err != nil {
+			return err
+		}
+		frame := ethernetFrame(&p)
+		if frame == nil {
+			return nil
+		}
+		ci := gopacket.CaptureInfo{Timestamp: p.DateTime, CaptureLength: len(frame), Length: len(frame)}
+		return nw.WritePacket(ci, frame)
+	})
+	if err != nil {
+		return err
+	}
+	return nw.Flush()
+}
+
+func ethernetFrame(p *models.IPPacket) []byte {
+	dst, err := net.ParseMAC(p.DstMAC)
+	if err != nil || len(p.EthernetPayload) == 0 {
+		return nil
+	}
+	src, err := net.ParseMAC(p.SrcMAC)
+	if err != nil {
+		return nil
+	}
+	frame := make([]byte, 0, 14+len(p.EthernetPayload))
+	frame = append(frame, dst...)
+	frame = append(frame, src...)
+	frame = binary.BigEndian.AppendUint16(frame, p.EthernetType)
+	return append(frame, p.EthernetPayload...)
+}
+
+// 使用只读连接查询，fn 中可以再次查询
+func (s *Session) each(query string, args []any, fn func(*sql.Rows) error) error {
+	rows, err := s.ro.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err = fn(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func writeJSONLines[T any](zw *zip.Writer, name string, list []T) error {
+	fw, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(fw)
+	for i := range list {
+		if err = enc.Encode(&list[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 导入会话归档，保存为 path 的新会话，path 已经存在时返回错误
+func ImportArchive(filename, path string) (*models.SessionManifest, error) {
+	zr, err := zip.OpenReader(filename)
+	if err != nil {
+		return nil, fmt.Errorf("打开归档文件失败: %w", err)
+	}
+	defer zr.Close()
+
+	var manifest models.SessionManifest
+	if err = readJSON(&zr.Reader, manifestFile, &manifest); err != nil {
+		return nil, fmt.Errorf("读取归档信息失败: %w", err)
+	}
+	if manifest.Format != ArchiveFormat {
+		return nil, fmt.Errorf("不是会话归档文件: %s", filename)
+	}
+	if manifest.Version > ArchiveVersion {
+		return nil, fmt.Errorf("会话归档版本 %d 不支持，需要更新程序", manifest.Version)
+	}
+
+	if _, err = os.Stat(path); err == nil {
+		return nil, fmt.Errorf("会话已经存在: %s", path)
+	}
+	s, err := OpenSession(path)
+	if err != nil {
+		return nil, err
+	}
+	err = s.importArchive(&zr.Reader)
+	if cerr := s.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		RemoveSession(path)
+		return nil, fmt.Errorf("导入会话失败: %w", err)
+	}
+	return &manifest, nil
+}
+
+func (s *Session) importArchive(zr *zip.Reader) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = readJSONLines(zr, httpFile, func(data []byte) error {
+		var p models.HTTPPacket
+		if err := json.Unmarshal(data, &p); err != nil {
+			return err
+		}
+		return insertHTTP(tx, &p)
+	})
+	if err != nil {
+		return err
+	}
+	err = readJSONLines(zr, ipFile, func(data []byte) error {
+		var p models.IPPacket
+		if err := json.Unmarshal(data, &p); err != nil {
+			return err
+		}
+		return insertIP(tx, &p)
+	})
+	if err != nil {
+		return err
+	}
+	err = readJSONLines(zr, bodiesFile, func(line []byte) error {
+		var b archiveBody
+		if err := json.Unmarshal(line, &b); err != nil {
+			return err
+		}
+		f, err := zr.Open(b.File)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		info := models.BodyInfo{ContentType: b.ContentType, Total: b.Total, Truncated: b.Truncated}
+		lr := &io.LimitedReader{R: f, N: maxArchiveBody + 1}
+		if err = insertBody(tx, b.ID, b.Part, info, lr); err != nil {
+			return err
+		}
+		if lr.N == 0 {
+			return fmt.Errorf("%s 超过 %d 字节", b.File, maxArchiveBody)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func readFile(zr *zip.Reader, name string) ([]byte, error) {
+	f, err := zr.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, maxArchiveBody+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxArchiveBody {
+		return nil, fmt.Errorf("%s 超过 %d 字节", name, maxArchiveBody)
+	}
+	return data, nil
+}
+
+func readJSON(zr *zip.Reader, name string, v any) error {
+	data, err := readFile(zr, name)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// 按行读取，文件不存在时跳过
+func readJSONLines(zr *zip.Reader, name string, fn func([]byte) error) error {
+	f, err := zr.Open(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	br := bufio.NewReader(f)
+	for {
+		line, err := br.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			if ferr := fn(line); ferr != nil {
+				return fmt.Errorf("%s: %w", name, ferr)
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
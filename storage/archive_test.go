@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"archive/zip"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dreamsxin/go-netsniffer/models"
+)
+
+func TestArchive(t *testing.T) {
+	dir := t.TempDir()
+	session, err := OpenSession(filepath.Join(dir, "a.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+	session.SaveHTTP(&models.HTTPPacket{ID: "1", URL: "http://example.com/", DateTime: time.Now()})
+	session.SaveHTTP(&models.HTTPPacket{ID: "1", HTTPPacketType: models.HTTPPacketType_RESPONSE, StatusCode: 200})
+	session.SaveIP(&models.IPPacket{SrcMAC: "00:00:00:00:00:01", DstMAC: "00:00:00:00:00:02", EthernetType: 0x0800,
+		EthernetPayload: []byte{0x45}, DateTime: time.Now()})
+	insertBody(session.db, "1", PartResponseRaw, models.BodyInfo{ContentType: "image/png", Total: 10, Truncated: true}, strings.NewReader("\x89PNG"))
+
+	archive := filepath.Join(dir, "a.zip")
+	manifest, err := session.ExportArchive(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.HTTPPackets != 2 || manifest.IPPackets != 1 || manifest.Bodies != 1 || !manifest.PCAPNG {
+		t.Errorf("manifest: %+v", manifest)
+	}
+	zr, err := zip.OpenReader(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = zr.Open(pcapngFile); err != nil {
+		t.Error(err)
+	}
+	zr.Close()
+
+	path := filepath.Join(dir, "b.db")
+	if _, err = ImportArchive(archive, path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ImportArchive(archive, path); err == nil {
+		t.Error("import over existing session")
+	}
+	imported, err := OpenSession(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer imported.Close()
+	page, err := imported.HTTPPackets(0, 10)
+	if err != nil || page.Total != 2 || page.Packets[1].StatusCode != 200 {
+		t.Fatalf("HTTPPackets: %+v %v", page, err)
+	}
+	store := NewBodyStore(models.Body{})
+	defer store.Close()
+	store.SetSession(imported)
+	r, err := store.Range("1", PartResponseRaw, 0, 10, EncodingBase64)
+	if err != nil || r.Data != "iVBORw==" || r.Total != 10 || !r.Truncated || r.ContentType != "image/png" {
+		t.Fatalf("Range: %+v %v", r, err)
+	}
+}
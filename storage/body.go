@@ -0,0 +1,547 @@
+package storage
+
+import (
+	"container/list"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/dreamsxin/go-netsniffer/models"
+)
+
+// 同一个请求中的内容，request、response 为解码并转换为 UTF-8 后的内容，-raw 为原始内容
+const (
+	PartRequest     = "request"
+	PartRequestRaw  = "request-raw"
+	PartResponse    = "response"
+	PartResponseRaw = "response-raw"
+)
+
+// 读取内容时的编码
+const (
+	EncodingText   = ""
+	EncodingBase64 = "base64"
+)
+
+const (
+	defaultMemoryLimit = 1 << 20
+	defaultTotalMemory = 64 << 20
+	defaultMaxSize     = 64 << 20
+	defaultTotalDisk   = 1 << 30
+
+	// 每次最多读取的长度
+	maxRangeLen = 1 << 20
+)
+
+var ErrBodyNotFound = errors.New("body not found")
+
+type bodyKey struct {
+	id   string
+	part string
+}
+
+// BodyStore 按请求 ID 保存请求和响应内容，小内容保存在内存中，超过内存限制的写入临时文件
+// 保存到会话后从 BodyStore 中移除，之后从会话中读取
+type BodyStore struct {
+	lock     sync.Mutex
+	conf     models.Body
+	dir      string // 本次运行的临时目录，第一次写入文件时创建，关闭时删除
+	memUsed  int64
+	diskUsed int64
+	lru      *list.List // 临时文件中已接收完成的内容，最近读取的在后面，磁盘超过上限时从前面删除
+	bodies   map[bodyKey]*Body
+	session  *Session // 不在内存中的内容从打开的会话中读取
+	closed   bool
+}
+
+func NewBodyStore(conf models.Body) *BodyStore {
+	s := &BodyStore{bodies: make(map[bodyKey]*Body), lru: list.New()}
+	s.SetConfig(conf)
+	return s
+}
+
+// 修改限制，新的内容生效
+func (s *BodyStore) SetConfig(conf models.Body) {
+	if conf.MemoryLimit <= 0 {
+		conf.MemoryLimit = defaultMemoryLimit
+	}
+	if conf.TotalMemory <= 0 {
+		conf.TotalMemory = defaultTotalMemory
+	}
+	if conf.MaxSize <= 0 {
+		conf.MaxSize = defaultMaxSize
+	}
+	if conf.TotalDisk <= 0 {
+		conf.TotalDisk = defaultTotalDisk
+	}
+	s.lock.Lock()
+	s.conf = conf
+	s.lock.Unlock()
+}
+
+// 开始保存一个内容，已有的同名内容被替换，关闭后返回的内容不保存写入的数据
+func (s *BodyStore) Create(id, part string) *Body {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	b := &Body{store: s, memLimit: s.conf.MemoryLimit, maxSize: s.conf.MaxSize, id: id, part: part}
+	if s.closed {
+		b.removed = true
+		return b
+	}
+	key := bodyKey{id, part}
+	if old, ok := s.bodies[key]; ok {
+		go old.remove()
+	}
+	s.bodies[key] = b
+	return b
+}
+
+func (s *BodyStore) Get(id, part string) (*Body, bool) {
+	s.lock.Lock()
+	b, ok := s.bodies[bodyKey{id, part}]
+	session := s.session
+	s.lock.Unlock()
+	if !ok && session != nil {
+		return session.loadBody(s, id, part)
+	}
+	return b, ok
+}
+
+// 设置当前会话，为 nil 时不再从会话中读取
+func (s *BodyStore) SetSession(session *Session) {
+	s.lock.Lock()
+	s.session = session
+	s.lock.Unlock()
+}
+
+// 一个请求的所有内容，按名称索引
+func (s *BodyStore) Parts(id string) map[string]*Body {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	parts := make(map[string]*Body)
+	for key, b := range s.bodies {
+		if key.id == id {
+			parts[key.part] = b
+		}
+	}
+	return parts
+}
+
+// 所有保存了内容的请求 ID
+func (s *BodyStore) IDs() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	seen := make(map[string]bool)
+	var ids []string
+	for key := range s.bodies {
+		if !seen[key.id] {
+			seen[key.id] = true
+			ids = append(ids, key.id)
+		}
+	}
+	return ids
+}
+
+// 读取内容的一部分，length 最大 1MB，二进制内容使用 base64 编码
+func (s *BodyStore) Range(id, part string, offset, length int64, encoding string) (*models.BodyRange, error) {
+	if encoding != EncodingText && encoding != EncodingBase64 {
+		return nil, fmt.Errorf("unsupported encoding %q", encoding)
+	}
+	b, ok := s.Get(id, part)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s %s", ErrBodyNotFound, id, part)
+	}
+	length = min(max(length, 0), maxRangeLen)
+	data, err := b.Range(offset, length)
+	if err != nil {
+		return nil, err
+	}
+	info := b.Info()
+	r := &models.BodyRange{
+		ID:          id,
+		Part:        part,
+		Offset:      offset,
+		Encoding:    encoding,
+		ContentType: info.ContentType,
+		Size:        info.Size,
+		Total:       info.Total,
+		Truncated:   info.Truncated,
+		Done:        info.Done,
+	}
+	if encoding == EncodingBase64 {
+		r.Data = base64.StdEncoding.EncodeToString(data)
+	} else {
+		r.Data = string(data)
+	}
+	return r, nil
+}
+
+// 已经保存到会话的内容不再占用内存和临时文件，替换过的内容不移除
+func (s *BodyStore) evict(key bodyKey, b *Body, session *Session) {
+	s.lock.Lock()
+	if s.bodies[key] == b {
+		delete(s.bodies, key)
+	}
+	s.lock.Unlock()
+	b.evict(session)
+}
+
+// 删除一个请求的所有内容
+func (s *BodyStore) Remove(id string) {
+	s.lock.Lock()
+	var removed []*Body
+	for key, b := range s.bodies {
+		if key.id == id {
+			removed = append(removed, b)
+			delete(s.bodies, key)
+		}
+	}
+	s.lock.Unlock()
+	for _, b := range removed {
+		b.remove()
+	}
+}
+
+// 删除一个请求中名称以 prefix 开头的内容，包括原始内容和 multipart 中的文件
+func (s *BodyStore) RemoveParts(id, prefix string) {
+	s.lock.Lock()
+	var removed []*Body
+	for key, b := range s.bodies {
+		if key.id == id && strings.HasPrefix(key.part, prefix) {
+			removed = append(removed, b)
+			delete(s.bodies, key)
+		}
+	}
+	s.lock.Unlock()
+	for _, b := range removed {
+		b.remove()
+	}
+}
+
+// 删除所有内容
+func (s *BodyStore) Clear() {
+	s.lock.Lock()
+	bodies := s.bodies
+	s.bodies = make(map[bodyKey]*Body)
+	s.lock.Unlock()
+	for _, b := range bodies {
+		b.remove()
+	}
+}
+
+// 删除所有内容和临时目录，之后不再保存新的内容
+func (s *BodyStore) Close() error {
+	s.lock.Lock()
+	s.closed = true
+	s.lock.Unlock()
+	s.Clear()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.dir == "" {
+		return nil
+	}
+	err := os.RemoveAll(s.dir)
+	s.dir = ""
+	return err
+}
+
+// 占用内存，超过总限制时返回 false
+func (s *BodyStore) reserve(n int64) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.memUsed+n > s.conf.TotalMemory {
+		return false
+	}
+	s.memUsed += n
+	return true
+}
+
+func (s *BodyStore) release(n int64) {
+	s.lock.Lock()
+	s.memUsed -= n
+	s.lock.Unlock()
+}
+
+// 占用磁盘，超过上限时删除最久没有读取的内容，仍然不够时返回 false
+// 调用方持有 b 的锁，被删除的内容都已接收完成，不会持有自己的锁等待其它锁
+func (s *BodyStore) reserveDisk(b *Body, n int64) bool {
+	s.lock.Lock()
+	if b.disk+n > s.conf.TotalDisk {
+		// 删除其它内容也放不下
+		s.lock.Unlock()
+		return false
+	}
+	var victims []*Body
+	for e := s.lru.Front(); e != nil && s.diskUsed+n > s.conf.TotalDisk; {
+		next := e.Next()
+		if victim := e.Value.(*Body); victim != b {
+			s.lru.Remove(e)
+			victim.elem = nil
+			s.diskUsed -= victim.disk
+			victim.disk = 0
+			key := bodyKey{victim.id, victim.part}
+			if s.bodies[key] == victim {
+				delete(s.bodies, key)
+			}
+			victims = append(victims, victim)
+		}
+		e = next
+	}
+	ok := s.diskUsed+n <= s.conf.TotalDisk
+	if ok {
+		s.diskUsed += n
+		b.disk += n
+	}
+	s.lock.Unlock()
+	for _, victim := range victims {
+		victim.remove()
+	}
+	return ok
+}
+
+// 释放内容占用的磁盘并移出 LRU 列表
+func (s *BodyStore) releaseDisk(b *Body) {
+	s.lock.Lock()
+	s.diskUsed -= b.disk
+	b.disk = 0
+	if b.elem != nil {
+		s.lru.Remove(b.elem)
+		b.elem = nil
+	}
+	s.lock.Unlock()
+}
+
+// 临时文件中的内容接收完成或被读取时移到 LRU 列表的最后
+func (s *BodyStore) touch(b *Body, done bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if b.elem != nil {
+		s.lru.MoveToBack(b.elem)
+	} else if done && s.bodies[bodyKey{b.id, b.part}] == b {
+		b.elem = s.lru.PushBack(b)
+	}
+}
+
+func (s *BodyStore) createTemp(pattern string) (*os.File, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return nil, os.ErrClosed
+	}
+	if s.dir == "" {
+		dir, err := os.MkdirTemp(s.conf.Dir, "netsniffer-bodies-")
+		if err != nil {
+			return nil, err
+		}
+		s.dir = dir
+	}
+	return os.CreateTemp(s.dir, pattern)
+}
+
+// Body 一个请求或响应的内容，写入和读取可以在不同协程中进行
+type Body struct {
+	store    *BodyStore
+	id       string
+	part     string
+	memLimit int64
+	maxSize  int64
+
+	lock        sync.RWMutex
+	mem         []byte
+	file        *os.File
+	size        int64 // 已保存的长度
+	total       int64 // 实际收到的长度
+	truncated   bool
+	done        bool
+	removed     bool
+	contentType string
+	stored      *Session      // 已经保存到会话，从会话中读取
+	disk        int64         // 临时文件占用的磁盘，由 BodyStore 的锁保护
+	elem        *list.Element // 在 BodyStore 的 LRU 列表中的位置，由 BodyStore 的锁保护
+}
+
+// 超过最大长度的部分丢弃，写入文件失败时停止保存，都标记为截断，不返回错误以免影响转发
+func (b *Body) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	n := len(p)
+	b.total += int64(n)
+	if b.removed || b.truncated {
+		return n, nil
+	}
+	if b.size+int64(len(p)) > b.maxSize {
+		p = p[:b.maxSize-b.size]
+		b.truncated = true
+	}
+	if len(p) == 0 {
+		return n, nil
+	}
+
+	if b.file == nil {
+		if b.size+int64(len(p)) <= b.memLimit && b.store.reserve(int64(len(p))) {
+			b.mem = append(b.mem, p...)
+			b.size += int64(len(p))
+			return n, nil
+		}
+		if err := b.spill(); err != nil {
+			log.Println("BodyStore.spill", b.id, b.part, err)
+			b.truncated = true
+			return n, nil
+		}
+	}
+	if !b.store.reserveDisk(b, int64(len(p))) {
+		log.Println("BodyStore.Write", b.id, b.part, "临时文件超过磁盘上限")
+		b.truncated = true
+		return n, nil
+	}
+	if _, err := b.file.Write(p); err != nil {
+		log.Println("BodyStore.Write", b.id, b.part, err)
+		b.truncated = true
+		return n, nil
+	}
+	b.size += int64(len(p))
+	return n, nil
+}
+
+// 内存中的内容移到临时文件，需要持有锁
+func (b *Body) spill() error {
+	if !b.store.reserveDisk(b, int64(len(b.mem))) {
+		return errors.New("临时文件超过磁盘上限")
+	}
+	file, err := b.store.createTemp(b.part + "-*.body")
+	if err != nil {
+		b.store.releaseDisk(b)
+		return err
+	}
+	if _, err = file.Write(b.mem); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		b.store.releaseDisk(b)
+		return err
+	}
+	b.store.release(int64(len(b.mem)))
+	b.mem = nil
+	b.file = file
+	return nil
+}
+
+// 内容接收完成，保存在临时文件中的内容之后可以在磁盘超过上限时删除
+func (b *Body) Close() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.done = true
+	if b.file != nil && !b.removed {
+		b.store.touch(b, true)
+	}
+	return nil
+}
+
+// 标记为截断，记录时丢失了部分数据
+func (b *Body) SetTruncated() {
+	b.lock.Lock()
+	b.truncated = true
+	b.lock.Unlock()
+}
+
+// 设置内容的 MIME 类型，预览时使用
+func (b *Body) SetContentType(contentType string) {
+	b.lock.Lock()
+	b.contentType = contentType
+	b.lock.Unlock()
+}
+
+func (b *Body) Info() models.BodyInfo {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	return models.BodyInfo{
+		Size:        b.size,
+		Total:       b.total,
+		Truncated:   b.truncated,
+		Done:        b.done,
+		OnDisk:      b.file != nil || b.stored != nil,
+		ContentType: b.contentType,
+	}
+}
+
+// 读取已保存内容的一部分，超出已保存长度时返回的内容较短
+func (b *Body) Range(offset, length int64) ([]byte, error) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	if b.removed {
+		return nil, ErrBodyNotFound
+	}
+	if offset < 0 || offset > b.size {
+		return nil, fmt.Errorf("offset %d out of range %d", offset, b.size)
+	}
+	length = min(length, b.size-offset)
+	if b.stored != nil {
+		return b.stored.readBody(b.id, b.part, offset, length)
+	}
+	if b.file == nil {
+		return append([]byte(nil), b.mem[offset:offset+length]...), nil
+	}
+	b.store.touch(b, false)
+	data := make([]byte, length)
+	n, err := b.file.ReadAt(data, offset)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return data[:n], nil
+}
+
+// 全部已保存的内容
+func (b *Body) Reader() io.Reader {
+	return io.NewSectionReader(b, 0, b.Info().Size)
+}
+
+func (b *Body) ReadAt(p []byte, off int64) (int, error) {
+	data, err := b.Range(off, int64(len(p)))
+	if err != nil {
+		return 0, err
+	}
+	n := copy(p, data)
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// 保存到会话后释放内存和临时文件，正在读取的调用方继续从会话中读取
+func (b *Body) evict(session *Session) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.removed || b.stored != nil {
+		return
+	}
+	b.store.release(int64(len(b.mem)))
+	b.mem = nil
+	if b.file != nil {
+		b.file.Close()
+		os.Remove(b.file.Name())
+		b.file = nil
+	}
+	b.store.releaseDisk(b)
+	b.stored = session
+}
+
+func (b *Body) remove() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.removed {
+		return
+	}
+	b.removed = true
+	b.store.release(int64(len(b.mem)))
+	b.mem = nil
+	if b.file != nil {
+		b.file.Close()
+		os.Remove(b.file.Name())
+		b.file = nil
+	}
+	b.store.releaseDisk(b)
+}
@@ -0,0 +1,150 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/dreamsxin/go-netsniffer/models"
+)
+
+func TestBodyStore(t *testing.T) {
+	s := NewBodyStore(models.Body{MemoryLimit: 16, TotalMemory: 24, MaxSize: 64, Dir: t.TempDir()})
+	defer s.Close()
+
+	data := bytes.Repeat([]byte("0123456789"), 10)
+	cases := []struct {
+		id     string
+		n      int
+		onDisk bool
+	}{
+		{"small", 10, false},
+		{"spill", 20, true},
+		{"total", 16, true}, // 超过总内存限制
+		{"truncated", 100, true},
+	}
+	for _, c := range cases {
+		b := s.Create(c.id, PartResponse)
+		for p := data[:c.n]; len(p) > 0; p = p[min(3, len(p)):] {
+			b.Write(p[:min(3, len(p))])
+		}
+		b.Close()
+
+		info := b.Info()
+		size := min(c.n, 64)
+		if info.Size != int64(size) || info.Total != int64(c.n) || info.Truncated != (c.n > 64) || info.OnDisk != c.onDisk || !info.Done {
+			t.Errorf("%s: info %+v", c.id, info)
+		}
+		r, err := s.Range(c.id, PartResponse, 5, 1000, EncodingText)
+		if err != nil {
+			t.Fatalf("%s: %v", c.id, err)
+		}
+		if r.Data != string(data[5:size]) {
+			t.Errorf("%s: range %q", c.id, r.Data)
+		}
+		all, _ := io.ReadAll(b.Reader())
+		if !bytes.Equal(all, data[:size]) {
+			t.Errorf("%s: reader %q", c.id, all)
+		}
+	}
+
+	r, err := s.Range("small", PartResponse, 2, 3, EncodingBase64)
+	if err != nil || r.Data != base64.StdEncoding.EncodeToString(data[2:5]) {
+		t.Errorf("base64: %+v %v", r, err)
+	}
+
+	s.Remove("spill")
+	if _, err := s.Range("spill", PartResponse, 0, 10, EncodingText); !errors.Is(err, ErrBodyNotFound) {
+		t.Errorf("removed: %v", err)
+	}
+	s.Create("parts", PartRequest).Write(data[:10])
+	s.Create("parts", PartRequestRaw).Write(data[:10])
+	s.Create("parts", PartResponse).Write(data[:10])
+	s.RemoveParts("parts", PartRequest)
+	if parts := s.Parts("parts"); len(parts) != 1 || parts[PartResponse] == nil {
+		t.Errorf("parts after RemoveParts: %v", parts)
+	}
+	s.Clear()
+	if s.memUsed != 0 {
+		t.Errorf("memUsed %d after clear", s.memUsed)
+	}
+	dir := s.dir
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("temp dir not removed: %v", err)
+	}
+	// 关闭后创建的内容不保存，也不重新创建临时目录
+	b := s.Create("late", PartResponse)
+	b.Write(data)
+	if info := b.Info(); info.Size != 0 || s.dir != "" {
+		t.Errorf("body created after close: %+v dir %q", info, s.dir)
+	}
+	if _, ok := s.Get("late", PartResponse); ok {
+		t.Error("body created after close is stored")
+	}
+}
+
+func TestBodyStoreDiskLimit(t *testing.T) {
+	s := NewBodyStore(models.Body{MemoryLimit: 1, TotalDisk: 30, Dir: t.TempDir()})
+	defer s.Close()
+
+	data := bytes.Repeat([]byte("x"), 10)
+	for _, id := range []string{"a", "b", "c"} {
+		b := s.Create(id, PartResponse)
+		b.Write(data)
+		b.Close()
+	}
+	// 读取过的 a 最后删除
+	if _, err := s.Range("a", PartResponse, 0, 10, EncodingText); err != nil {
+		t.Fatal(err)
+	}
+	d := s.Create("d", PartResponse)
+	d.Write(data)
+	if _, ok := s.Get("b", PartResponse); ok {
+		t.Error("least recently used body not evicted")
+	}
+	for _, id := range []string{"a", "c", "d"} {
+		if _, ok := s.Get(id, PartResponse); !ok {
+			t.Errorf("%s evicted", id)
+		}
+	}
+	// 正在接收的内容不删除，超过上限的部分截断
+	d.Write(bytes.Repeat([]byte("x"), 30))
+	if info := d.Info(); !info.Truncated || info.Size != 10 {
+		t.Errorf("d: %+v", info)
+	}
+	if _, ok := s.Get("c", PartResponse); !ok || s.diskUsed != 30 {
+		t.Errorf("evicted for a write that cannot fit, diskUsed %d", s.diskUsed)
+	}
+}
+
+func TestServeBody(t *testing.T) {
+	s := NewBodyStore(models.Body{})
+	defer s.Close()
+	png := append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 100)...)
+	b := s.Create("1", PartResponse)
+	b.Write(png)
+	b.Close()
+	b.SetContentType("image/png")
+
+	req := httptest.NewRequest(http.MethodGet, "/bodies/1/response", nil)
+	req.Header.Set("Range", "bytes=0-7")
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, req)
+	if w.Code != http.StatusPartialContent || w.Header().Get("Content-Type") != "image/png" || !bytes.Equal(w.Body.Bytes(), png[:8]) {
+		t.Errorf("serve: %d %v %q", w.Code, w.Header(), w.Body.Bytes())
+	}
+
+	w = httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/bodies/2/response", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("missing body: %d", w.Code)
+	}
+}
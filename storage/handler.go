@@ -0,0 +1,32 @@
+package storage
+
+import (
+	"io"
+	"net/http"
+	"time"
+)
+
+// 界面通过 /bodies/{id}/{part} 预览图片、音视频等内容，支持 Range 请求
+func (s *BodyStore) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /bodies/{id}/{part}", s.serveBody)
+	return mux
+}
+
+func (s *BodyStore) serveBody(w http.ResponseWriter, r *http.Request) {
+	b, ok := s.Get(r.PathValue("id"), r.PathValue("part"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	info := b.Info()
+	contentType := info.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	// 内容来自抓取的网站，禁止执行脚本，避免调用界面绑定的方法
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Security-Policy", "sandbox; default-src 'none'")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, r, "", time.Time{}, io.NewSectionReader(b, 0, info.Size))
+}
@@ -0,0 +1,299 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/dreamsxin/go-netsniffer/models"
+)
+
+// 全文索引中的字段
+const (
+	FieldURL            = "url"
+	FieldRequestHeader  = "request.header"
+	FieldResponseHeader = "response.header"
+	FieldPayload        = "payload" // IP 数据包的应用层数据
+)
+
+const (
+	// 每个内容最多索引的长度
+	maxIndexLen = 1 << 20
+
+	defaultSearchLimit = 100
+	maxSearchLimit     = 1000
+	maxSnippets        = 3
+	snippetContext     = 40
+	// trigram 索引只能查找至少 3 个字符的内容
+	minIndexedQuery = 3
+)
+
+func indexText(e execer, id string, ipSeq int64, field, content string) error {
+	if content == "" {
+		return nil
+	}
+	_, err := e.Exec("INSERT INTO search_index (id, ip_seq, field, content) VALUES (?, ?, ?, ?)", id, ipSeq, field, content)
+	return err
+}
+
+// 请求索引 URL 和 Header，响应索引 Header，内容在保存时单独索引
+func indexHTTP(e execer, p *models.HTTPPacket) error {
+	switch p.HTTPPacketType {
+	case models.HTTPPacketType_REQUEST:
+		if err := indexText(e, p.ID, 0, FieldURL, p.URL); err != nil {
+			return err
+		}
+		return indexText(e, p.ID, 0, FieldRequestHeader, headerText(p.Header))
+	case models.HTTPPacketType_RESPONSE:
+		return indexText(e, p.ID, 0, FieldResponseHeader, headerText(p.Header))
+	}
+	return nil
+}
+
+func headerText(header map[string][]string) string {
+	keys := make([]string, 0, len(header))
+	for k := range header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		for _, v := range header[k] {
+			b.WriteString(k + ": " + v + "\n")
+		}
+	}
+	return b.String()
+}
+
+// 只索引解码后的文本内容，原始数据和 multipart 文件不索引
+func indexed(part string) bool {
+	return part == PartRequest || part == PartResponse
+}
+
+func indexBody(e execer, id, part string, data []byte) error {
+	if !indexed(part) {
+		return nil
+	}
+	if _, err := e.Exec("DELETE FROM search_index WHERE id = ? AND field = ?", id, part); err != nil {
+		return err
+	}
+	if len(data) > maxIndexLen {
+		data = data[:maxIndexLen]
+	}
+	// 按开头部分判断是否为文本，截断处可能不是完整的字符
+	if !utf8.Valid(trimPartialRune(data[:min(len(data), 4096)])) {
+		return nil
+	}
+	return indexText(e, id, 0, part, strings.ToValidUTF8(string(data), ""))
+}
+
+// 去掉末尾不完整的 UTF-8 字符
+func trimPartialRune(b []byte) []byte {
+	for i := 1; i < utf8.UTFMax && i <= len(b); i++ {
+		if utf8.RuneStart(b[len(b)-i]) {
+			if !utf8.FullRune(b[len(b)-i:]) {
+				return b[:len(b)-i]
+			}
+			break
+		}
+	}
+	return b
+}
+
+func indexIP(e execer, seq int64, p *models.IPPacket) error {
+	if len(p.ApplicationPayload) == 0 {
+		return nil
+	}
+	return indexText(e, "", seq, FieldPayload, strings.ToValidUTF8(string(p.ApplicationPayload), ""))
+}
+
+// 重建全文索引，升级旧版本会话时在升级的事务中使用
+func reindex(tx *sql.Tx) error {
+	_, err := tx.Exec("DELETE FROM search_index")
+	if err != nil {
+		return err
+	}
+
+	// 只有一个连接，分批读取后再写入
+	var last int64
+	for {
+		var packets []models.HTTPPacket
+		err = eachRow(tx, "SELECT seq, packet FROM http_packets WHERE seq > ? ORDER BY seq LIMIT 500", []any{last}, func(rows *sql.Rows) error {
+			var data []byte
+			if err := rows.Scan(&last, &data); err != nil {
+				return err
+			}
+			var p models.HTTPPacket
+			if err := json.Unmarshal(data, &p); err != nil {
+				return err
+			}
+			packets = append(packets, p)
+			return nil
+		})
+		if err != nil || len(packets) == 0 {
+			break
+		}
+		for i := range packets {
+			if err = indexHTTP(tx, &packets[i]); err != nil {
+				return err
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	last = 0
+	for {
+		type ipRow struct {
+			seq int64
+			p   models.IPPacket
+		}
+		var packets []ipRow
+		err = eachRow(tx, "SELECT seq, packet FROM ip_packets WHERE seq > ? ORDER BY seq LIMIT 500", []any{last}, func(rows *sql.Rows) error {
+			var data []byte
+			if err := rows.Scan(&last, &data); err != nil {
+				return err
+			}
+			row := ipRow{seq: last}
+			if err := json.Unmarshal(data, &row.p); err != nil {
+				return err
+			}
+			packets = append(packets, row)
+			return nil
+		})
+		if err != nil || len(packets) == 0 {
+			break
+		}
+		for i := range packets {
+			if err = indexIP(tx, packets[i].seq, &packets[i].p); err != nil {
+				return err
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	// 只读取索引的开头部分
+	last = 0
+	for {
+		type bodyRow struct {
+			id, part string
+			data     []byte
+		}
+		var bodies []bodyRow
+		err = eachRow(tx, "SELECT rowid, id, part, substr(data, 1, ?) FROM body_chunks WHERE rowid > ? AND pos = 0 AND part IN (?, ?) ORDER BY rowid LIMIT 50",
+			[]any{maxIndexLen, last, PartRequest, PartResponse}, func(rows *sql.Rows) error {
+				var b bodyRow
+				if err := rows.Scan(&last, &b.id, &b.part, &b.data); err != nil {
+					return err
+				}
+				bodies = append(bodies, b)
+				return nil
+			})
+		if err != nil || len(bodies) == 0 {
+			break
+		}
+		for _, b := range bodies {
+			if err = indexBody(tx, b.id, b.part, b.data); err != nil {
+				return err
+			}
+		}
+	}
+	return err
+}
+
+func eachRow(tx *sql.Tx, query string, args []any, fn func(*sql.Rows) error) error {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err = fn(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// 搜索 URL、Header、文本内容和 IP 数据包的应用层数据，同一个请求的每个字段返回一个结果
+// 不是正则表达式且长度足够时先通过索引查找，其他情况逐个匹配
+func (s *Session) Search(opts models.SearchOptions) ([]models.SearchResult, error) {
+	if opts.Query == "" {
+		return nil, nil
+	}
+	pattern := opts.Query
+	if !opts.Regex {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	if !opts.CaseSensitive {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("正则表达式无效: %w", err)
+	}
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+	limit = min(limit, maxSearchLimit)
+
+	query := "SELECT id, ip_seq, field, content FROM search_index ORDER BY rowid"
+	var args []any
+	if !opts.Regex && utf8.RuneCountInString(opts.Query) >= minIndexedQuery {
+		// trigram 索引不区分大小写，区分大小写时由正则表达式再次检查
+		query = "SELECT id, ip_seq, field, content FROM search_index WHERE search_index MATCH ? ORDER BY rowid"
+		args = append(args, `"`+strings.ReplaceAll(opts.Query, `"`, `""`)+`"`)
+	}
+	rows, err := s.ro.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("搜索失败: %w", err)
+	}
+	defer rows.Close()
+
+	var results []models.SearchResult
+	for rows.Next() && len(results) < limit {
+		var r models.SearchResult
+		var content string
+		if err = rows.Scan(&r.ID, &r.IPSeq, &r.Field, &content); err != nil {
+			return nil, fmt.Errorf("搜索失败: %w", err)
+		}
+		matches := re.FindAllStringIndex(content, maxSearchLimit)
+		if len(matches) == 0 {
+			continue
+		}
+		r.Count = len(matches)
+		for _, m := range matches[:min(len(matches), maxSnippets)] {
+			r.Snippets = append(r.Snippets, snippet(content, m[0], m[1]))
+		}
+		results = append(results, r)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("搜索失败: %w", err)
+	}
+	return results, nil
+}
+
+// 匹配内容和前后的部分文字，不截断 UTF-8 字符
+func snippet(content string, start, end int) models.SearchSnippet {
+	from := max(start-snippetContext, 0)
+	for from > 0 && !utf8.RuneStart(content[from]) {
+		from--
+	}
+	to := min(end+snippetContext, len(content))
+	for to < len(content) && !utf8.RuneStart(content[to]) {
+		to++
+	}
+	return models.SearchSnippet{
+		Before: content[from:start],
+		Match:  content[start:end],
+		After:  content[end:to],
+	}
+}
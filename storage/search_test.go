@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dreamsxin/go-netsniffer/models"
+)
+
+func TestSearch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "s.db")
+	session, err := OpenSession(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.SaveHTTP(&models.HTTPPacket{ID: "1", URL: "http://example.com/login?next=%2F",
+		Header: http.Header{"Authorization": {"Bearer Token-ABC"}}})
+	session.SaveHTTP(&models.HTTPPacket{ID: "1", HTTPPacketType: models.HTTPPacketType_RESPONSE,
+		Header: http.Header{"Set-Cookie": {"sid=xyz"}}})
+	insertBody(session.db, "1", PartResponse, models.BodyInfo{}, strings.NewReader(`{"token":"Token-ABC","name":"中文"}`))
+	insertBody(session.db, "1", PartResponseRaw, models.BodyInfo{}, strings.NewReader("Token-ABC"))
+	insertBody(session.db, "2", PartResponse, models.BodyInfo{}, strings.NewReader("\x89PNG\r\n\x1a\n\x00\x00\xff\xfe Token-ABC"))
+	session.SaveIP(&models.IPPacket{ApplicationPayload: []byte("GET /?q=token-abc HTTP/1.1")})
+
+	// 改为版本 1 的格式：内容保存在 bodies.data 中，没有全文索引
+	for _, query := range []string{
+		"ALTER TABLE bodies ADD COLUMN data BLOB NOT NULL DEFAULT x''",
+		"UPDATE bodies SET data = (SELECT data FROM body_chunks c WHERE c.id = bodies.id AND c.part = bodies.part)",
+		"DELETE FROM body_chunks",
+		"DELETE FROM search_index",
+		"PRAGMA user_version = 1",
+	} {
+		if _, err = session.db.Exec(query); err != nil {
+			t.Fatal(query, err)
+		}
+	}
+	session.Close()
+
+	// 升级旧版本时内容移到 body_chunks 并重建索引，按 HTTP 数据包、IP 数据包、内容的顺序
+	if session, err = OpenSession(path); err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+	if data, err := session.readBody("1", PartResponseRaw, 0, 100); err != nil || string(data) != "Token-ABC" {
+		t.Fatalf("migrated body: %q %v", data, err)
+	}
+
+	cases := []struct {
+		opts   models.SearchOptions
+		fields []string
+	}{
+		{models.SearchOptions{Query: "token-abc"}, []string{FieldRequestHeader, FieldPayload, PartResponse}},
+		{models.SearchOptions{Query: "Token-ABC", CaseSensitive: true}, []string{FieldRequestHeader, PartResponse}},
+		{models.SearchOptions{Query: `sid=\w+`, Regex: true}, []string{FieldResponseHeader}},
+		{models.SearchOptions{Query: "中文"}, []string{PartResponse}},
+		{models.SearchOptions{Query: "token", Limit: 1}, []string{FieldRequestHeader}},
+	}
+	for _, c := range cases {
+		results, err := session.Search(c.opts)
+		if err != nil {
+			t.Fatalf("%+v: %v", c.opts, err)
+		}
+		var fields []string
+		for _, r := range results {
+			fields = append(fields, r.Field)
+		}
+		if len(fields) != len(c.fields) {
+			t.Errorf("%+v: got %v", c.opts, fields)
+			continue
+		}
+		for i := range fields {
+			if fields[i] != c.fields[i] {
+				t.Errorf("%+v: got %v", c.opts, fields)
+				break
+			}
+		}
+	}
+
+	results, _ := session.Search(models.SearchOptions{Query: "Token-ABC", CaseSensitive: true})
+	if sn := results[1].Snippets[0]; results[1].ID != "1" || sn.Before != `{"token":"` || sn.Match != "Token-ABC" || sn.After != `","name":"中文"}` {
+		t.Errorf("snippet: %+v", results[1])
+	}
+	results, _ = session.Search(models.SearchOptions{Query: "token-abc"})
+	if results[1].IPSeq != 1 || results[1].ID != "" {
+		t.Errorf("ip result: %+v", results[1])
+	}
+	if _, err = session.Search(models.SearchOptions{Query: "(", Regex: true}); err == nil {
+		t.Error("invalid regex accepted")
+	}
+}
@@ -0,0 +1,555 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dreamsxin/go-netsniffer/models"
+	_ "modernc.org/sqlite"
+)
+
+const (
+	appDirName = "go-netsniffer"
+	sessionExt = ".db"
+
+	// 会话文件格式的版本，保存在 user_version 中，2 增加了全文索引，3 内容分块保存
+	schemaVersion = 3
+
+	// 内容分块写入和读取，不需要一次读入整个内容
+	bodyChunkSize = 256 << 10
+	// 查询使用的只读连接数
+	maxReadConns = 4
+
+	defaultPageLimit = 100
+	maxPageLimit     = 1000
+)
+
+const schema = `
+PRAGMA journal_mode = WAL;
+PRAGMA synchronous = NORMAL;
+CREATE TABLE IF NOT EXISTS http_packets (
+	seq          INTEGER PRIMARY KEY AUTOINCREMENT,
+	id           TEXT NOT NULL,
+	type         INTEGER NOT NULL,
+	date         INTEGER NOT NULL,
+	method       TEXT NOT NULL,
+	host         TEXT NOT NULL,
+	url          TEXT NOT NULL,
+	status       INTEGER NOT NULL,
+	content_type TEXT NOT NULL,
+	packet       TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS http_packets_id ON http_packets (id);
+CREATE INDEX IF NOT EXISTS http_packets_host ON http_packets (host);
+CREATE TABLE IF NOT EXISTS bodies (
+	id           TEXT NOT NULL,
+	part         TEXT NOT NULL,
+	content_type TEXT NOT NULL,
+	total        INTEGER NOT NULL,
+	truncated    INTEGER NOT NULL,
+	PRIMARY KEY (id, part)
+);
+CREATE TABLE IF NOT EXISTS body_chunks (
+	id   TEXT NOT NULL,
+	part TEXT NOT NULL,
+	pos  INTEGER NOT NULL,
+	data BLOB NOT NULL,
+	PRIMARY KEY (id, part, pos)
+);
+CREATE TABLE IF NOT EXISTS ip_packets (
+	seq    INTEGER PRIMARY KEY AUTOINCREMENT,
+	date   INTEGER NOT NULL,
+	packet TEXT NOT NULL
+);
+CREATE VIRTUAL TABLE IF NOT EXISTS search_index USING fts5 (
+	id UNINDEXED,
+	ip_seq UNINDEXED,
+	field UNINDEXED,
+	content,
+	tokenize = 'trigram'
+);
+`
+
+var ErrInvalidSessionName = errors.New("会话名称无效")
+
+// 保存会话时同名会话已经存在，需要确认后覆盖
+var ErrSessionExists = errors.New("会话已经存在")
+
+// Session 一个抓包会话，HTTP 数据包、请求和响应内容以及 IP 数据包保存在一个 SQLite 文件中
+// 写入使用一个连接，查询和搜索使用只读连接，WAL 模式下不会等待写入
+type Session struct {
+	Name string
+	Path string
+
+	db *sql.DB
+	ro *sql.DB
+}
+
+// dir 为空时使用用户配置目录下的 sessions，目录不存在时创建
+func SessionDir(dir string) (string, error) {
+	if dir == "" {
+		configDir, err := os.UserConfigDir()
+		if err != nil {
+			return "", fmt.Errorf("获取用户配置目录失败: %w", err)
+		}
+		dir = filepath.Join(configDir, appDirName, "sessions")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("创建会话目录失败: %w", err)
+	}
+	return dir, nil
+}
+
+// 会话名称作为文件名，不能包含路径
+func SessionPath(dir, name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || strings.HasPrefix(name, ".") || strings.ContainsAny(name, `/\:*?"<>|`) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidSessionName, name)
+	}
+	return filepath.Join(dir, name+sessionExt), nil
+}
+
+// 按修改时间从新到旧排列
+func ListSessions(dir string) ([]models.SessionInfo, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("读取会话目录失败: %w", err)
+	}
+	var list []models.SessionInfo
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), sessionExt)
+		if !ok || entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		list = append(list, models.SessionInfo{Name: name, Size: info.Size(), ModTime: info.ModTime()})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ModTime.After(list[j].ModTime) })
+	return list, nil
+}
+
+// 删除会话文件和 WAL 日志
+func RemoveSession(path string) error {
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("删除会话失败: %w", err)
+	}
+	os.Remove(path + "-wal")
+	os.Remove(path + "-shm")
+	return nil
+}
+
+// 打开会话文件，不存在时创建
+func OpenSession(path string) (*Session, error) {
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, fmt.Errorf("打开会话失败: %w", err)
+	}
+	// PRAGMA 按连接生效，写入也需要串行
+	db.SetMaxOpenConns(1)
+	var version int
+	if err = db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("打开会话失败: %w", err)
+	}
+	if version > schemaVersion {
+		db.Close()
+		return nil, fmt.Errorf("会话文件版本 %d 不支持，需要更新程序", version)
+	}
+	if _, err = db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("初始化会话失败: %w", err)
+	}
+	name := strings.TrimSuffix(filepath.Base(path), sessionExt)
+	s := &Session{Name: name, Path: path, db: db}
+	if version < schemaVersion {
+		if err = s.migrate(version); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("升级会话失败: %w", err)
+		}
+	}
+	// 写入连接已经创建了文件和 WAL 日志，只读连接不会修改文件
+	if s.ro, err = sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)&_pragma=query_only(1)"); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("打开会话失败: %w", err)
+	}
+	s.ro.SetMaxOpenConns(maxReadConns)
+	return s, nil
+}
+
+// 从旧版本升级，新建的会话 version 为 0
+func (s *Session) migrate(version int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	// 3 之前内容整个保存在 bodies.data 中，作为一块移到 body_chunks
+	if version > 0 && version < 3 {
+		if _, err = tx.Exec("INSERT INTO body_chunks (id, part, pos, data) SELECT id, part, 0, data FROM bodies WHERE length(data) > 0"); err != nil {
+			return err
+		}
+		if _, err = tx.Exec("ALTER TABLE bodies DROP COLUMN data"); err != nil {
+			return err
+		}
+	}
+	if version == 1 {
+		if err = reindex(tx); err != nil {
+			return err
+		}
+	}
+	if _, err = tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", schemaVersion)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *Session) Close() error {
+	err := s.ro.Close()
+	if derr := s.db.Close(); err == nil {
+		err = derr
+	}
+	return err
+}
+
+// 没有任何数据包
+func (s *Session) Empty() bool {
+	var n int
+	err := s.db.QueryRow("SELECT (SELECT COUNT(*) FROM http_packets) + (SELECT COUNT(*) FROM ip_packets)").Scan(&n)
+	return err == nil && n == 0
+}
+
+// execer 为 *sql.DB 或 *sql.Tx，导入时在事务中批量写入
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+func (s *Session) SaveHTTP(p *models.HTTPPacket) error {
+	return insertHTTP(s.db, p)
+}
+
+func (s *Session) SaveIP(p *models.IPPacket) error {
+	return insertIP(s.db, p)
+}
+
+func insertHTTP(e execer, p *models.HTTPPacket) error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	_, err = e.Exec(`INSERT INTO http_packets (id, type, date, method, host, url, status, content_type, packet)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		p.ID, p.HTTPPacketType, p.DateTime.UnixNano(), p.Method, p.Host, p.URL, p.StatusCode, p.ContentType, data)
+	if err == nil {
+		err = indexHTTP(e, p)
+	}
+	if err != nil {
+		return fmt.Errorf("保存 HTTP 数据包失败: %w", err)
+	}
+	return nil
+}
+
+func insertIP(e execer, p *models.IPPacket) error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	res, err := e.Exec("INSERT INTO ip_packets (date, packet) VALUES (?, ?)", p.DateTime.UnixNano(), data)
+	if err == nil {
+		var seq int64
+		if seq, err = res.LastInsertId(); err == nil {
+			err = indexIP(e, seq, p)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("保存 IP 数据包失败: %w", err)
+	}
+	return nil
+}
+
+func insertBody(e execer, id, part string, info models.BodyInfo, r io.Reader) error {
+	if err := writeBody(e, id, part, info, r); err != nil {
+		return fmt.Errorf("保存内容失败: %w", err)
+	}
+	return nil
+}
+
+// 按块写入内容，同时保留开头部分用于全文索引
+func writeBody(e execer, id, part string, info models.BodyInfo, r io.Reader) error {
+	if _, err := e.Exec("DELETE FROM body_chunks WHERE id = ? AND part = ?", id, part); err != nil {
+		return err
+	}
+	_, err := e.Exec(`INSERT OR REPLACE INTO bodies (id, part, content_type, total, truncated) VALUES (?, ?, ?, ?, ?)`,
+		id, part, info.ContentType, info.Total, info.Truncated)
+	if err != nil {
+		return err
+	}
+	var head []byte
+	buf := make([]byte, bodyChunkSize)
+	var pos int64
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			if _, err := e.Exec("INSERT INTO body_chunks (id, part, pos, data) VALUES (?, ?, ?, ?)", id, part, pos, buf[:n]); err != nil {
+				return err
+			}
+			if indexed(part) && len(head) < maxIndexLen {
+				head = append(head, buf[:min(n, maxIndexLen-len(head))]...)
+			}
+			pos += int64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return indexBody(e, id, part, head)
+}
+
+// 已经保存到会话的内容，保存后从 BodyStore 中移除
+type savedBody struct {
+	key  bodyKey
+	body *Body
+}
+
+// 保存一个请求中已经接收完成的内容，保存后从 BodyStore 中移除，之后从会话中读取
+func (s *Session) SaveBodies(store *BodyStore, id string) error {
+	return s.inTx(store, func(tx *sql.Tx) ([]savedBody, error) {
+		saved, _, err := saveBodies(tx, store, id)
+		return saved, err
+	})
+}
+
+func (s *Session) inTx(store *BodyStore, fn func(tx *sql.Tx) ([]savedBody, error)) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("保存内容失败: %w", err)
+	}
+	defer tx.Rollback()
+	saved, err := fn(tx)
+	if err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("保存内容失败: %w", err)
+	}
+	s.evict(store, saved)
+	return nil
+}
+
+// 保存一个请求中已经接收完成的内容，done 为所有内容都已经完成
+func saveBodies(e execer, store *BodyStore, id string) (saved []savedBody, done bool, err error) {
+	done = true
+	for part, b := range store.Parts(id) {
+		info := b.Info()
+		if !info.Done {
+			done = false
+			continue
+		}
+		if err = insertBody(e, id, part, info, b.Reader()); err != nil {
+			return nil, false, err
+		}
+		saved = append(saved, savedBody{bodyKey{id, part}, b})
+	}
+	return saved, done, nil
+}
+
+// 事务提交后释放内存和临时文件
+func (s *Session) evict(store *BodyStore, saved []savedBody) {
+	for _, b := range saved {
+		store.evict(b.key, b.body, s)
+	}
+}
+
+// 会话中的内容，读取时按块查询，不放回 BodyStore
+func (s *Session) loadBody(store *BodyStore, id, part string) (*Body, bool) {
+	b := &Body{store: store, id: id, part: part, done: true, stored: s}
+	err := s.ro.QueryRow(`SELECT content_type, total, truncated,
+		(SELECT COALESCE(SUM(length(data)), 0) FROM body_chunks c WHERE c.id = b.id AND c.part = b.part)
+		FROM bodies b WHERE id = ? AND part = ?`, id, part).
+		Scan(&b.contentType, &b.total, &b.truncated, &b.size)
+	if err != nil {
+		return nil, false
+	}
+	return b, true
+}
+
+// 读取内容中 offset 开始的 length 字节
+func (s *Session) readBody(id, part string, offset, length int64) ([]byte, error) {
+	rows, err := s.ro.Query("SELECT pos, data FROM body_chunks WHERE id = ? AND part = ? AND pos < ? AND pos + length(data) > ? ORDER BY pos",
+		id, part, offset+length, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	data := make([]byte, 0, length)
+	for rows.Next() {
+		var pos int64
+		var chunk []byte
+		if err = rows.Scan(&pos, &chunk); err != nil {
+			return nil, err
+		}
+		start := max(offset-pos, 0)
+		end := min(offset+length-pos, int64(len(chunk)))
+		data = append(data, chunk[start:end]...)
+	}
+	return data, rows.Err()
+}
+
+// 按收到的顺序分页读取，limit 最大 1000
+func (s *Session) HTTPPackets(offset, limit int) (*models.HTTPPacketPage, error) {
+	page := &models.HTTPPacketPage{Offset: offset}
+	err := s.page("http_packets", offset, limit, &page.Total, func(data []byte) error {
+		var p models.HTTPPacket
+		if err := json.Unmarshal(data, &p); err != nil {
+			return err
+		}
+		page.Packets = append(page.Packets, p)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("读取 HTTP 数据包失败: %w", err)
+	}
+	return page, nil
+}
+
+// 扫描时读满一页后停止
+var errPageFull = errors.New("page full")
+
+// 按条件分页读取，where 为 http_packets 表的筛选条件，可以为空
+// match 为 nil 时 where 就是完整的条件，在数据库中分页，Total 为所有匹配的数量
+// 否则满足 where 的数据包再由 match 判断，读满一页后停止扫描，之后还有匹配时 Total 为已匹配的数量加一并设置 Estimated
+func (s *Session) FindHTTPPackets(where string, args []any, match func(*models.HTTPPacket) bool, offset, limit int) (*models.HTTPPacketPage, error) {
+	if limit <= 0 {
+		limit = defaultPageLimit
+	}
+	limit = min(limit, maxPageLimit)
+	offset = max(offset, 0)
+	page := &models.HTTPPacketPage{Offset: offset}
+	if where != "" {
+		where = " WHERE " + where
+	}
+	decode := func(rows *sql.Rows) (*models.HTTPPacket, error) {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var p models.HTTPPacket
+		if err := json.Unmarshal(data, &p); err != nil {
+			return nil, err
+		}
+		return &p, nil
+	}
+
+	var err error
+	if match == nil {
+		err = s.ro.QueryRow("SELECT COUNT(*) FROM http_packets"+where, args...).Scan(&page.Total)
+		if err == nil {
+			query := "SELECT packet FROM http_packets" + where + " ORDER BY seq LIMIT ? OFFSET ?"
+			err = s.each(query, append(args[:len(args):len(args)], limit, offset), func(rows *sql.Rows) error {
+				p, err := decode(rows)
+				if err == nil {
+					page.Packets = append(page.Packets, *p)
+				}
+				return err
+			})
+		}
+	} else {
+		err = s.each("SELECT packet FROM http_packets"+where+" ORDER BY seq", args, func(rows *sql.Rows) error {
+			p, err := decode(rows)
+			if err != nil {
+				return err
+			}
+			if !match(p) {
+				return nil
+			}
+			if len(page.Packets) == limit {
+				page.Total++
+				page.Estimated = true
+				return errPageFull
+			}
+			if page.Total >= int64(offset) {
+				page.Packets = append(page.Packets, *p)
+			}
+			page.Total++
+			return nil
+		})
+		if errors.Is(err, errPageFull) {
+			err = nil
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取 HTTP 数据包失败: %w", err)
+	}
+	return page, nil
+}
+
+func (s *Session) IPPackets(offset, limit int) (*models.IPPacketPage, error) {
+	page := &models.IPPacketPage{Offset: offset}
+	err := s.page("ip_packets", offset, limit, &page.Total, func(data []byte) error {
+		var p models.IPPacket
+		if err := json.Unmarshal(data, &p); err != nil {
+			return err
+		}
+		page.Packets = append(page.Packets, p)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("读取 IP 数据包失败: %w", err)
+	}
+	return page, nil
+}
+
+func (s *Session) page(table string, offset, limit int, total *int64, fn func([]byte) error) error {
+	if limit <= 0 {
+		limit = defaultPageLimit
+	}
+	limit = min(limit, maxPageLimit)
+	offset = max(offset, 0)
+	if err := s.ro.QueryRow("SELECT COUNT(*) FROM " + table).Scan(total); err != nil {
+		return err
+	}
+	rows, err := s.ro.Query("SELECT packet FROM "+table+" ORDER BY seq LIMIT ? OFFSET ?", limit, offset)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var data []byte
+		if err = rows.Scan(&data); err != nil {
+			return err
+		}
+		if err = fn(data); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// 另存为新的会话文件，已经存在时替换，记录中的会话需要在 Writer.Sync 中调用
+func (s *Session) SaveAs(path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("替换会话文件失败: %w", err)
+	}
+	// 原来文件的 WAL 日志不属于新文件，打开时会被当作新文件的日志
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err := os.Remove(path + suffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("替换会话文件失败: %w", err)
+		}
+	}
+	if _, err := s.db.Exec("VACUUM INTO ?", path); err != nil {
+		return fmt.Errorf("保存会话失败: %w", err)
+	}
+	return nil
+}
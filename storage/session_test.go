@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dreamsxin/go-netsniffer/models"
+)
+
+func TestSession(t *testing.T) {
+	dir := t.TempDir()
+	path, err := SessionPath(dir, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = SessionPath(dir, "../x"); err == nil {
+		t.Error("path in session name accepted")
+	}
+	session, err := OpenSession(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !session.Empty() {
+		t.Error("new session not empty")
+	}
+
+	store := NewBodyStore(models.Body{})
+	defer store.Close()
+	b := store.Create("1", PartResponse)
+	b.Write([]byte("hello"))
+	b.SetContentType("text/plain")
+	b.Close()
+	for i, typ := range []models.HTTPPacketType{models.HTTPPacketType_REQUEST, models.HTTPPacketType_RESPONSE} {
+		p := &models.HTTPPacket{ID: "1", HTTPPacketType: typ, DateTime: time.Now(), Host: "example.com", Seq: i}
+		if err = session.SaveHTTP(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = session.SaveBodies(store, "1"); err != nil {
+		t.Fatal(err)
+	}
+	if err = session.SaveIP(&models.IPPacket{SrcIP: "127.0.0.1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	page, err := session.HTTPPackets(1, 10)
+	if err != nil || page.Total != 2 || len(page.Packets) != 1 || page.Packets[0].HTTPPacketType != models.HTTPPacketType_RESPONSE {
+		t.Fatalf("HTTPPackets: %+v %v", page, err)
+	}
+	ipPage, err := session.IPPackets(0, 0)
+	if err != nil || ipPage.Total != 1 || ipPage.Packets[0].SrcIP != "127.0.0.1" {
+		t.Fatalf("IPPackets: %+v %v", ipPage, err)
+	}
+	response := func(p *models.HTTPPacket) bool { return p.HTTPPacketType == models.HTTPPacketType_RESPONSE }
+	page, err = session.FindHTTPPackets("host = ?", []any{"example.com"}, response, 0, 10)
+	if err != nil || page.Total != 1 || page.Packets[0].Seq != 1 {
+		t.Fatalf("FindHTTPPackets: %+v %v", page, err)
+	}
+	// 条件完全由 SQL 判断时在数据库中分页
+	page, err = session.FindHTTPPackets("host = ?", []any{"example.com"}, nil, 1, 10)
+	if err != nil || page.Total != 2 || page.Estimated || len(page.Packets) != 1 || page.Packets[0].Seq != 1 {
+		t.Fatalf("FindHTTPPackets in SQL: %+v %v", page, err)
+	}
+	// 读满一页后停止扫描，Total 为估计值
+	all := func(*models.HTTPPacket) bool { return true }
+	page, err = session.FindHTTPPackets("", nil, all, 0, 1)
+	if err != nil || page.Total != 2 || !page.Estimated || len(page.Packets) != 1 || page.Packets[0].Seq != 0 {
+		t.Fatalf("FindHTTPPackets first page: %+v %v", page, err)
+	}
+	page, err = session.FindHTTPPackets("", nil, all, 1, 1)
+	if err != nil || page.Total != 2 || page.Estimated || len(page.Packets) != 1 || page.Packets[0].Seq != 1 {
+		t.Fatalf("FindHTTPPackets last page: %+v %v", page, err)
+	}
+
+	// 另存后从文件中读取内容
+	saved := filepath.Join(dir, "saved"+sessionExt)
+	// 覆盖时删除原来文件留下的 WAL 日志
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		if err = os.WriteFile(saved+suffix, []byte("stale"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = session.SaveAs(saved); err != nil {
+		t.Fatal(err)
+	}
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if _, err = os.Stat(saved + suffix); !os.IsNotExist(err) {
+			t.Fatalf("stale %s not removed: %v", suffix, err)
+		}
+	}
+	session.Close()
+	session, err = OpenSession(saved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+	store.Clear()
+	store.SetSession(session)
+	r, err := store.Range("1", PartResponse, 0, 10, EncodingText)
+	if err != nil || r.Data != "hello" || r.ContentType != "text/plain" || !r.Done {
+		t.Fatalf("Range: %+v %v", r, err)
+	}
+
+	list, err := ListSessions(dir)
+	if err != nil || len(list) != 2 {
+		t.Fatalf("ListSessions: %+v %v", list, err)
+	}
+}
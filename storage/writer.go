@@ -0,0 +1,172 @@
+package storage
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/dreamsxin/go-netsniffer/models"
+)
+
+const (
+	// 每批数据包最多等待的时间和数量，每批在一个事务中写入
+	writeInterval = 100 * time.Millisecond
+	maxWriteBatch = 500
+	// 等待写入的数据包数量，写入跟不上时 SaveHTTP、SaveIP 阻塞
+	writeQueueSize = 8192
+)
+
+// Writer 在单独的协程中把数据包和接收完成的内容批量写入当前会话
+// 内容按块写入，保存后从 BodyStore 中移除，之后从会话中读取
+type Writer struct {
+	store *BodyStore
+	queue chan writeOp
+	done  chan struct{}
+
+	// 只在写入协程中访问
+	session *Session
+	pending map[string]bool // 内容还没有接收完成的请求，之后每批重试
+}
+
+type writeOp struct {
+	http *models.HTTPPacket
+	ip   *models.IPPacket
+	sync func() // 写入之前的数据后在写入协程中调用
+}
+
+func NewWriter(store *BodyStore) *Writer {
+	w := &Writer{
+		store:   store,
+		queue:   make(chan writeOp, writeQueueSize),
+		done:    make(chan struct{}),
+		pending: make(map[string]bool),
+	}
+	go w.run()
+	return w
+}
+
+// 保存 HTTP 数据包和请求中已经接收完成的内容，p 之后不能再修改
+func (w *Writer) SaveHTTP(p *models.HTTPPacket) {
+	w.queue <- writeOp{http: p}
+}
+
+func (w *Writer) SaveIP(p *models.IPPacket) {
+	w.queue <- writeOp{ip: p}
+}
+
+// 写入队列中之前的数据包和所有接收完成的内容，然后在写入协程中调用 fn，写入暂停
+// fn 返回之后写入的会话，返回错误时继续写入原来的会话
+func (w *Writer) Sync(fn func(current *Session) (*Session, error)) error {
+	var err error
+	done := make(chan struct{})
+	w.queue <- writeOp{sync: func() {
+		defer close(done)
+		var next *Session
+		if next, err = fn(w.session); err == nil {
+			w.session = next
+		}
+	}}
+	<-done
+	return err
+}
+
+// 写入剩余的数据后结束，之后不能再调用其他方法，会话由调用方关闭
+func (w *Writer) Close() {
+	close(w.queue)
+	<-w.done
+}
+
+func (w *Writer) run() {
+	defer close(w.done)
+	ticker := time.NewTicker(writeInterval)
+	defer ticker.Stop()
+	var batch []writeOp
+	for {
+		select {
+		case op, ok := <-w.queue:
+			if !ok {
+				w.write(batch, true)
+				return
+			}
+			if op.sync != nil {
+				w.write(batch, true)
+				batch = nil
+				op.sync()
+				continue
+			}
+			batch = append(batch, op)
+			if len(batch) < maxWriteBatch {
+				continue
+			}
+		case <-ticker.C:
+		}
+		w.write(batch, false)
+		batch = nil
+	}
+}
+
+// 在一个事务中写入数据包和内容，all 为保存所有接收完成的内容
+func (w *Writer) write(batch []writeOp, all bool) {
+	s := w.session
+	if s == nil || len(batch) == 0 && len(w.pending) == 0 && !all {
+		return
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		log.Println("Writer.Begin", err)
+		return
+	}
+	defer tx.Rollback()
+
+	ids := w.pending
+	w.pending = make(map[string]bool)
+	for _, op := range batch {
+		if op.http != nil {
+			if err = insertHTTP(tx, op.http); err != nil {
+				log.Println("Writer.SaveHTTP", err)
+			} else if op.http.ID != "" {
+				ids[op.http.ID] = true
+			}
+		} else if op.ip != nil {
+			if err = insertIP(tx, op.ip); err != nil {
+				log.Println("Writer.SaveIP", err)
+			}
+		}
+	}
+	if all {
+		for _, id := range w.store.IDs() {
+			ids[id] = true
+		}
+	}
+	saved := w.saveBodies(tx, ids)
+	if err = tx.Commit(); err != nil {
+		log.Println("Writer.Commit", err)
+		return
+	}
+	s.evict(w.store, saved)
+}
+
+func (w *Writer) saveBodies(tx *sql.Tx, ids map[string]bool) []savedBody {
+	var all []savedBody
+	for id := range ids {
+		// 一个内容保存失败时只撤销这个请求的内容，不影响同一批的其他数据
+		if _, err := tx.Exec("SAVEPOINT bodies"); err != nil {
+			log.Println("Writer.SaveBodies", id, err)
+			continue
+		}
+		saved, done, err := saveBodies(tx, w.store, id)
+		if err != nil {
+			log.Println("Writer.SaveBodies", id, err)
+			tx.Exec("ROLLBACK TO bodies")
+		}
+		tx.Exec("RELEASE bodies")
+		if err != nil {
+			continue
+		}
+		all = append(all, saved...)
+		if !done {
+			w.pending[id] = true
+		}
+	}
+	return all
+}
@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/dreamsxin/go-netsniffer/models"
+)
+
+func TestWriter(t *testing.T) {
+	session, err := OpenSession(filepath.Join(t.TempDir(), "w.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+	store := NewBodyStore(models.Body{MemoryLimit: 16, Dir: t.TempDir()})
+	defer store.Close()
+	w := NewWriter(store)
+	store.SetSession(session)
+	w.Sync(func(*Session) (*Session, error) { return session, nil })
+
+	// 超过一块的内容写入临时文件，保存后从 BodyStore 中移除
+	data := bytes.Repeat([]byte("0123456789"), bodyChunkSize/5)
+	b := store.Create("1", PartResponse)
+	b.Write(data)
+	b.Close()
+	// 没有完成的内容在完成后保存
+	stream := store.Create("2", PartResponse)
+	stream.Write([]byte("event"))
+
+	w.SaveHTTP(&models.HTTPPacket{ID: "1", HTTPPacketType: models.HTTPPacketType_RESPONSE})
+	w.SaveHTTP(&models.HTTPPacket{ID: "2", HTTPPacketType: models.HTTPPacketType_STREAM})
+	w.SaveIP(&models.IPPacket{SrcIP: "127.0.0.1"})
+	w.Sync(func(s *Session) (*Session, error) { return s, nil })
+
+	if parts := store.Parts("1"); len(parts) != 0 {
+		t.Errorf("saved body not evicted: %v", parts)
+	}
+	if info := b.Info(); info.Size != int64(len(data)) || !info.OnDisk {
+		t.Errorf("evicted body: %+v", info)
+	}
+	r, err := store.Range("1", PartResponse, bodyChunkSize-5, 10, EncodingText)
+	if err != nil || r.Data != string(data[bodyChunkSize-5:bodyChunkSize+5]) || r.Size != int64(len(data)) {
+		t.Fatalf("Range: %+v %v", r, err)
+	}
+	if _, ok := store.Parts("2")[PartResponse]; !ok {
+		t.Error("unfinished body evicted")
+	}
+
+	stream.Close()
+	w.Close()
+	r, err = store.Range("2", PartResponse, 0, 10, EncodingText)
+	if err != nil || r.Data != "event" || len(store.Parts("2")) != 0 {
+		t.Fatalf("stream body: %+v %v", r, err)
+	}
+	page, err := session.HTTPPackets(0, 10)
+	if err != nil || page.Total != 2 {
+		t.Fatalf("HTTPPackets: %+v %v", page, err)
+	}
+}